@@ -555,3 +555,276 @@ func (bm *WordVec) Alloc(nBits uint) {
 		bm.Validate(i)
 	}
 }
+
+// words gives read-only word slice for given bitmap.
+func (p *BitmapPool) words(b Bitmap) []Word {
+	if b.isInline() {
+		return []Word{Word(b)}
+	}
+	return p.bitmaps[^b]
+}
+
+// Strip trailing zero words of memory bitmap and possibly reduce to inline.
+func (p *BitmapPool) trim(r Bitmap) Bitmap {
+	bi := uint(^r)
+	l := len(p.bitmaps[bi])
+	for l > 0 && p.bitmaps[bi][l-1] == 0 {
+		l--
+	}
+	p.bitmaps[bi] = p.bitmaps[bi][:l]
+	return p.checkInline(r)
+}
+
+func (p *BitmapPool) And(b Bitmap, c Bitmap) (r Bitmap) {
+	r = b
+	if bothInline(b, c) {
+		r &= c
+		return
+	}
+	cs := p.words(c)
+	if b.isInline() {
+		// Result fits inline since b does.
+		r &= Bitmap(cs[0])
+		return
+	}
+	bi := uint(^r)
+	bs := p.bitmaps[bi]
+	for i := range bs {
+		if i < len(cs) {
+			bs[i] &= cs[i]
+		} else {
+			bs[i] = 0
+		}
+	}
+	r = p.trim(r)
+	return
+}
+
+func (b Bitmap) And(c Bitmap) Bitmap { return Bitmaps.And(b, c) }
+
+func (p *BitmapPool) Xor(b Bitmap, c Bitmap) (r Bitmap) {
+	r = b
+	if bothInline(b, c) {
+		r ^= c
+		return
+	}
+	r = p.inlineToMem(r)
+	bi := uint(^r)
+	cs := p.words(c)
+	p.bitmaps[bi].Validate(uint(len(cs) - 1))
+	for i := range cs {
+		p.bitmaps[bi][i] ^= cs[i]
+	}
+	r = p.trim(r)
+	return
+}
+
+func (b Bitmap) Xor(c Bitmap) Bitmap { return Bitmaps.Xor(b, c) }
+
+// Equal returns true if both bitmaps have the same bits set.
+func (p *BitmapPool) Equal(b Bitmap, c Bitmap) bool {
+	if bothInline(b, c) {
+		return b == c
+	}
+	bs, cs := p.words(b), p.words(c)
+	if len(bs) < len(cs) {
+		bs, cs = cs, bs
+	}
+	for i := range bs {
+		v := Word(0)
+		if i < len(cs) {
+			v = cs[i]
+		}
+		if bs[i] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (b Bitmap) Equal(c Bitmap) bool { return Bitmaps.Equal(b, c) }
+
+// Subset returns true if every bit set in b is also set in c.
+func (p *BitmapPool) Subset(b Bitmap, c Bitmap) bool {
+	if bothInline(b, c) {
+		return b&^c == 0
+	}
+	bs, cs := p.words(b), p.words(c)
+	for i := range bs {
+		v := Word(0)
+		if i < len(cs) {
+			v = cs[i]
+		}
+		if bs[i]&^v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (b Bitmap) Subset(c Bitmap) bool { return Bitmaps.Subset(b, c) }
+
+// Count returns number of set bits.
+func (p *BitmapPool) Count(b Bitmap) (n uint) {
+	if b.isInline() {
+		return NSetBits(Word(b))
+	}
+	for _, w := range p.bitmaps[^b] {
+		n += NSetBits(w)
+	}
+	return
+}
+
+func (b Bitmap) Count() uint { return Bitmaps.Count(b) }
+
+// Rank returns number of set bits strictly below bit X.
+func (p *BitmapPool) Rank(b Bitmap, x uint) (n uint) {
+	if b.isInline() {
+		if x < WordBits {
+			return NSetBits(Word(b) & (Word(1)<<x - 1))
+		}
+		return NSetBits(Word(b))
+	}
+	s := p.bitmaps[^b]
+	i, m := bitmapIndex(x)
+	for j := uint(0); j < i && j < uint(len(s)); j++ {
+		n += NSetBits(s[j])
+	}
+	if i < uint(len(s)) {
+		n += NSetBits(s[i] & (m - 1))
+	}
+	return
+}
+
+func (b Bitmap) Rank(x uint) uint { return Bitmaps.Rank(b, x) }
+
+// Select returns position of Nth set bit (counting from zero).
+// Ok is false if bitmap has N or fewer set bits.
+func (p *BitmapPool) Select(b Bitmap, n uint) (x uint, ok bool) {
+	s := p.words(b)
+	for i := range s {
+		w := s[i]
+		c := NSetBits(w)
+		if n >= c {
+			n -= c
+			continue
+		}
+		for ; n > 0; n-- {
+			w ^= w.FirstSet()
+		}
+		x = uint(i*WordBits) + w.FirstSet().MinLog2()
+		ok = true
+		return
+	}
+	return
+}
+
+func (b Bitmap) Select(n uint) (uint, bool) { return Bitmaps.Select(b, n) }
+
+// NextClear finds next clear bit after *px; starts at bit 0 when *px is ^uint(0).
+// Bitmaps are conceptually infinite so a clear bit is always found.
+func (p *BitmapPool) NextClear(b Bitmap, px *uint) (ok bool) {
+	x := *px + 1
+	s := p.words(b)
+	i, m := bitmapIndex(x)
+	for ; i < uint(len(s)); i, m = i+1, 1 {
+		// Bits not yet searched in this word.
+		w := ^s[i] &^ (m - 1)
+		if w != 0 {
+			*px = i*WordBits + w.FirstSet().MinLog2()
+			return true
+		}
+	}
+	if x < i*WordBits {
+		x = i * WordBits
+	}
+	*px = x
+	return true
+}
+
+func (b Bitmap) NextClear(px *uint) bool { return Bitmaps.NextClear(b, px) }
+
+// FirstClear returns index of lowest clear bit.
+func (p *BitmapPool) FirstClear(b Bitmap) (x uint) {
+	x = ^uint(0)
+	p.NextClear(b, &x)
+	return
+}
+
+func (b Bitmap) FirstClear() uint { return Bitmaps.FirstClear(b) }
+
+// Mask for bits X through X + N - 1 of a single word; requires x + n <= WordBits.
+func bitmapRangeMask(x, n uint) Word {
+	if n >= WordBits {
+		return ^Word(0)
+	}
+	return (Word(1)<<n - 1) << x
+}
+
+// SetRange sets bits X through X + N - 1, possibly resizing and returning new bitmap.
+func (p *BitmapPool) SetRange(b Bitmap, x, n uint) (r Bitmap) {
+	r = b
+	if n == 0 {
+		return
+	}
+	if r.isInline() {
+		if x+n <= WordBits-1 {
+			r |= Bitmap(bitmapRangeMask(x, n))
+			return
+		}
+		r = p.toMem(r)
+	}
+	bi := uint(^r)
+	i1, _ := bitmapIndex(x + n - 1)
+	p.bitmaps[bi].Validate(i1)
+	s := p.bitmaps[bi]
+	for n > 0 {
+		i, o := x/WordBits, x%WordBits
+		k := WordBits - o
+		if k > n {
+			k = n
+		}
+		s[i] |= bitmapRangeMask(o, k)
+		x += k
+		n -= k
+	}
+	return
+}
+
+func (b Bitmap) SetRange(x, n uint) Bitmap { return Bitmaps.SetRange(b, x, n) }
+
+// UnsetRange clears bits X through X + N - 1, possibly returning new bitmap.
+func (p *BitmapPool) UnsetRange(b Bitmap, x, n uint) (r Bitmap) {
+	r = b
+	if n == 0 {
+		return
+	}
+	if r.isInline() {
+		if x < WordBits-1 {
+			if x+n > WordBits-1 {
+				n = WordBits - 1 - x
+			}
+			r &^= Bitmap(bitmapRangeMask(x, n))
+		}
+		return
+	}
+	bi := uint(^r)
+	s := p.bitmaps[bi]
+	for n > 0 {
+		i, o := x/WordBits, x%WordBits
+		if i >= uint(len(s)) {
+			break
+		}
+		k := WordBits - o
+		if k > n {
+			k = n
+		}
+		s[i] &^= bitmapRangeMask(o, k)
+		x += k
+		n -= k
+	}
+	r = p.trim(r)
+	return
+}
+
+func (b Bitmap) UnsetRange(x, n uint) Bitmap { return Bitmaps.UnsetRange(b, x, n) }
@@ -95,3 +95,70 @@ func TestBitmap(t *testing.T) {
 		z.Free()
 	}
 }
+
+func TestBitmapOps(t *testing.T) {
+	b := Bitmap(0).Set(1).Set(5).Set(130)
+	c := Bitmap(0).Set(5).Set(7)
+
+	if got, want := b.Count(), uint(3); got != want {
+		t.Errorf("Count: got %d want %d", got, want)
+	}
+	if got, want := b.Rank(130), uint(2); got != want {
+		t.Errorf("Rank: got %d want %d", got, want)
+	}
+	if x, ok := b.Select(2); !ok || x != 130 {
+		t.Errorf("Select: got %d %v want 130", x, ok)
+	}
+	if _, ok := b.Select(3); ok {
+		t.Errorf("Select past end: got ok")
+	}
+
+	d := b.Dup().And(c)
+	if got, want := d.String(), "{5}"; got != want {
+		t.Errorf("And: got %s want %s", got, want)
+	}
+	if !d.isInline() {
+		t.Errorf("And: result not reduced to inline")
+	}
+	if !d.Subset(b) || !d.Subset(c) || b.Subset(c) {
+		t.Errorf("Subset")
+	}
+
+	e := b.Dup().Xor(c)
+	if got, want := e.String(), "{1, 7, 130}"; got != want {
+		t.Errorf("Xor: got %s want %s", got, want)
+	}
+	e = e.Xor(Bitmap(0).Set(130))
+	if !e.Equal(Bitmap(0).Set(1).Set(7)) || e.Equal(c) {
+		t.Errorf("Equal: %s", e)
+	}
+
+	f := Bitmap(0).SetRange(0, 200)
+	if got, want := f.Count(), uint(200); got != want {
+		t.Errorf("SetRange: got %d want %d", got, want)
+	}
+	if got, want := f.FirstClear(), uint(200); got != want {
+		t.Errorf("FirstClear: got %d want %d", got, want)
+	}
+	f = f.UnsetRange(60, 80)
+	if got, want := f.Count(), uint(120); got != want {
+		t.Errorf("UnsetRange: got %d want %d", got, want)
+	}
+	x := uint(10)
+	if f.NextClear(&x); x != 60 {
+		t.Errorf("NextClear: got %d want 60", x)
+	}
+	x = 139
+	if f.NextClear(&x); x != 200 {
+		t.Errorf("NextClear: got %d want 200", x)
+	}
+	if got, want := Bitmap(0).SetRange(0, 63).FirstClear(), uint(63); got != want {
+		t.Errorf("FirstClear inline: got %d want %d", got, want)
+	}
+
+	b.Free()
+	c.Free()
+	d.Free()
+	e.Free()
+	f.Free()
+}
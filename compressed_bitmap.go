@@ -0,0 +1,637 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elib
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// CompressedBitmap is a roaring-style bitmap for large sparse sets of bit indices.
+// Bits are split into 64K chunks keyed by the high bits of the index.
+// Each chunk is stored as a sorted array, a dense bitmap or a list of runs,
+// whichever is smaller, so a single high bit costs a few bytes instead of
+// a dense Word vector as with Bitmap.
+// Indices are limited to CompressedBitmapMaxIndex.
+type CompressedBitmap struct {
+	keys       []uint32
+	containers []cbContainer
+}
+
+const (
+	cbLog2ChunkBits = 16
+	cbChunkBits     = 1 << cbLog2ChunkBits
+	cbBitmapWords   = cbChunkBits / 64
+	// Arrays larger than this take more space than a dense bitmap.
+	cbMaxArrayLen = 4096
+)
+
+// CompressedBitmapMaxIndex is the largest bit index a CompressedBitmap can hold:
+// chunk keys are 32 bits wide so indices have at most 48 significant bits.
+const CompressedBitmapMaxIndex = 1<<(32+cbLog2ChunkBits) - 1
+
+type cbKind uint8
+
+const (
+	cbArray cbKind = iota
+	cbBitmap
+	cbRun
+)
+
+// Run of set bits start through start + len.
+type cbInterval struct{ start, len uint16 }
+
+func (r cbInterval) last() uint { return uint(r.start) + uint(r.len) }
+
+type cbContainer struct {
+	kind cbKind
+	// Number of set bits in container.
+	n uint32
+	// Sorted set bits for array containers.
+	array []uint16
+	// Dense bits for bitmap containers.
+	bitmap []uint64
+	// Sorted non-overlapping runs for run containers.
+	runs []cbInterval
+}
+
+func cbValid(x uint) bool { return uint64(x) <= CompressedBitmapMaxIndex }
+
+func cbSplit(x uint) (key uint32, low uint16) {
+	return uint32(x >> cbLog2ChunkBits), uint16(x)
+}
+
+func cbJoin(key uint32, low uint) uint { return uint(key)<<cbLog2ChunkBits | low }
+
+func (c *cbContainer) get(x uint16) bool {
+	switch c.kind {
+	case cbArray:
+		i := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= x })
+		return i < len(c.array) && c.array[i] == x
+	case cbBitmap:
+		return c.bitmap[x/64]&(1<<(x%64)) != 0
+	default:
+		i := sort.Search(len(c.runs), func(i int) bool { return c.runs[i].last() >= uint(x) })
+		return i < len(c.runs) && c.runs[i].start <= x
+	}
+}
+
+func (c *cbContainer) toBitmap() {
+	b := make([]uint64, cbBitmapWords)
+	c.foreach(func(x uint) { b[x/64] |= 1 << (x % 64) })
+	c.kind = cbBitmap
+	c.bitmap = b
+	c.array = nil
+	c.runs = nil
+}
+
+func (c *cbContainer) toArray() {
+	a := make([]uint16, 0, c.n)
+	c.foreach(func(x uint) { a = append(a, uint16(x)) })
+	c.kind = cbArray
+	c.array = a
+	c.bitmap = nil
+	c.runs = nil
+}
+
+// Convert run container to array or bitmap so it can be modified.
+func (c *cbContainer) fromRuns() {
+	if c.kind == cbRun {
+		if c.n > cbMaxArrayLen {
+			c.toBitmap()
+		} else {
+			c.toArray()
+		}
+	}
+}
+
+// Choose array or bitmap representation based on number of set bits.
+func (c *cbContainer) normalize() {
+	switch {
+	case c.kind == cbArray && c.n > cbMaxArrayLen:
+		c.toBitmap()
+	case c.kind == cbBitmap && c.n <= cbMaxArrayLen:
+		c.toArray()
+	}
+}
+
+func (c *cbContainer) set(x uint16) (old bool) {
+	c.fromRuns()
+	if c.kind == cbBitmap {
+		i, m := x/64, uint64(1)<<(x%64)
+		old = c.bitmap[i]&m != 0
+		if !old {
+			c.bitmap[i] |= m
+			c.n++
+		}
+		return
+	}
+	i := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= x })
+	if old = i < len(c.array) && c.array[i] == x; old {
+		return
+	}
+	c.array = append(c.array, 0)
+	copy(c.array[i+1:], c.array[i:])
+	c.array[i] = x
+	c.n++
+	c.normalize()
+	return
+}
+
+func (c *cbContainer) unset(x uint16) (old bool) {
+	if !c.get(x) {
+		return
+	}
+	old = true
+	c.fromRuns()
+	if c.kind == cbBitmap {
+		c.bitmap[x/64] &^= 1 << (x % 64)
+	} else {
+		i := sort.Search(len(c.array), func(i int) bool { return c.array[i] >= x })
+		c.array = append(c.array[:i], c.array[i+1:]...)
+	}
+	c.n--
+	c.normalize()
+	return
+}
+
+func (c *cbContainer) foreach(fn func(x uint)) {
+	switch c.kind {
+	case cbArray:
+		for _, x := range c.array {
+			fn(uint(x))
+		}
+	case cbBitmap:
+		for i, w := range c.bitmap {
+			Word(w).ForeachSetBit(func(j uint) { fn(uint(i)*64 + j) })
+		}
+	default:
+		for _, r := range c.runs {
+			for x := uint(r.start); x <= r.last(); x++ {
+				fn(x)
+			}
+		}
+	}
+}
+
+// next returns first set bit >= x.
+func (c *cbContainer) next(x uint) (y uint, ok bool) {
+	switch c.kind {
+	case cbArray:
+		i := sort.Search(len(c.array), func(i int) bool { return uint(c.array[i]) >= x })
+		if ok = i < len(c.array); ok {
+			y = uint(c.array[i])
+		}
+	case cbBitmap:
+		i := x / 64
+		w := Word(c.bitmap[i] &^ (uint64(1)<<(x%64) - 1))
+		for {
+			if w != 0 {
+				return i*64 + w.FirstSet().MinLog2(), true
+			}
+			if i++; i >= cbBitmapWords {
+				return
+			}
+			w = Word(c.bitmap[i])
+		}
+	default:
+		i := sort.Search(len(c.runs), func(i int) bool { return c.runs[i].last() >= x })
+		if ok = i < len(c.runs); ok {
+			y = uint(c.runs[i].start)
+			if y < x {
+				y = x
+			}
+		}
+	}
+	return
+}
+
+func (c *cbContainer) countRuns() (n uint) {
+	last := -2
+	c.foreach(func(x uint) {
+		if int(x) != last+1 {
+			n++
+		}
+		last = int(x)
+	})
+	return
+}
+
+func (c *cbContainer) toRuns() {
+	var rs []cbInterval
+	c.foreach(func(x uint) {
+		if l := len(rs); l > 0 && rs[l-1].last()+1 == x {
+			rs[l-1].len++
+		} else {
+			rs = append(rs, cbInterval{start: uint16(x)})
+		}
+	})
+	c.kind = cbRun
+	c.runs = rs
+	c.array = nil
+	c.bitmap = nil
+}
+
+// Size in bytes of container as array, bitmap or runs.
+func (c *cbContainer) sizes() (array, bitmap, runs uint) {
+	return 2 * uint(c.n), 8 * cbBitmapWords, 4 * c.countRuns()
+}
+
+// Bitwise or/and of two containers into a new one.
+func cbCombine(a, b *cbContainer, and bool) (r cbContainer) {
+	r.kind = cbBitmap
+	r.bitmap = make([]uint64, cbBitmapWords)
+	if and {
+		a.foreach(func(x uint) {
+			if b.get(uint16(x)) {
+				r.bitmap[x/64] |= 1 << (x % 64)
+			}
+		})
+	} else {
+		f := func(x uint) { r.bitmap[x/64] |= 1 << (x % 64) }
+		a.foreach(f)
+		b.foreach(f)
+	}
+	for _, w := range r.bitmap {
+		r.n += uint32(NSetBits(Word(w)))
+	}
+	r.normalize()
+	return
+}
+
+func (b *CompressedBitmap) find(key uint32) (i int, ok bool) {
+	i = sort.Search(len(b.keys), func(i int) bool { return b.keys[i] >= key })
+	ok = i < len(b.keys) && b.keys[i] == key
+	return
+}
+
+func (b *CompressedBitmap) insert(i int, key uint32, c cbContainer) {
+	b.keys = append(b.keys, 0)
+	copy(b.keys[i+1:], b.keys[i:])
+	b.keys[i] = key
+	b.containers = append(b.containers, cbContainer{})
+	copy(b.containers[i+1:], b.containers[i:])
+	b.containers[i] = c
+}
+
+func (b *CompressedBitmap) remove(i int) {
+	b.keys = append(b.keys[:i], b.keys[i+1:]...)
+	b.containers = append(b.containers[:i], b.containers[i+1:]...)
+}
+
+func (b *CompressedBitmap) Get(x uint) (v bool) {
+	if !cbValid(x) {
+		return
+	}
+	key, low := cbSplit(x)
+	if i, ok := b.find(key); ok {
+		v = b.containers[i].get(low)
+	}
+	return
+}
+
+// Set sets bit X and returns its previous value.
+// Set panics if X is larger than CompressedBitmapMaxIndex.
+func (b *CompressedBitmap) Set(x uint) (old bool) {
+	if !cbValid(x) {
+		panic(fmt.Errorf("compressed bitmap: index %d larger than max %d", x, uint64(CompressedBitmapMaxIndex)))
+	}
+	key, low := cbSplit(x)
+	i, ok := b.find(key)
+	if !ok {
+		b.insert(i, key, cbContainer{kind: cbArray})
+	}
+	return b.containers[i].set(low)
+}
+
+// Unset clears bit X and returns its previous value.
+func (b *CompressedBitmap) Unset(x uint) (old bool) {
+	if !cbValid(x) {
+		return
+	}
+	key, low := cbSplit(x)
+	i, ok := b.find(key)
+	if !ok {
+		return
+	}
+	c := &b.containers[i]
+	old = c.unset(low)
+	if c.n == 0 {
+		b.remove(i)
+	}
+	return
+}
+
+// Count returns number of set bits.
+func (b *CompressedBitmap) Count() (n uint) {
+	for i := range b.containers {
+		n += uint(b.containers[i].n)
+	}
+	return
+}
+
+func (b *CompressedBitmap) IsEmpty() bool { return len(b.keys) == 0 }
+
+func (b *CompressedBitmap) Reset() {
+	b.keys = b.keys[:0]
+	b.containers = b.containers[:0]
+}
+
+func (b *CompressedBitmap) ForeachSetBit(fn func(uint)) {
+	for i := range b.containers {
+		key := b.keys[i]
+		b.containers[i].foreach(func(x uint) { fn(cbJoin(key, x)) })
+	}
+}
+
+// Next finds next set bit after *px; starts at bit 0 when *px is ^uint(0).
+func (b *CompressedBitmap) Next(px *uint) (ok bool) {
+	x := *px + 1
+	if *px == ^uint(0) {
+		x = 0
+	}
+	if !cbValid(x) {
+		*px = ^uint(0)
+		return false
+	}
+	key, low := cbSplit(x)
+	i, _ := b.find(key)
+	for ; i < len(b.keys); i++ {
+		start := uint(0)
+		if b.keys[i] == key {
+			start = uint(low)
+		}
+		if y, found := b.containers[i].next(start); found {
+			*px = cbJoin(b.keys[i], y)
+			return true
+		}
+	}
+	*px = ^uint(0)
+	return false
+}
+
+// Or sets b to the union of b and c.
+func (b *CompressedBitmap) Or(c *CompressedBitmap) {
+	for j := range c.keys {
+		i, ok := b.find(c.keys[j])
+		if ok {
+			b.containers[i] = cbCombine(&b.containers[i], &c.containers[j], false)
+		} else {
+			b.insert(i, c.keys[j], c.containers[j].dup())
+		}
+	}
+}
+
+// And sets b to the intersection of b and c.
+func (b *CompressedBitmap) And(c *CompressedBitmap) {
+	l := 0
+	for i := range b.keys {
+		j, ok := c.find(b.keys[i])
+		if !ok {
+			continue
+		}
+		r := cbCombine(&b.containers[i], &c.containers[j], true)
+		if r.n == 0 {
+			continue
+		}
+		b.keys[l] = b.keys[i]
+		b.containers[l] = r
+		l++
+	}
+	b.keys = b.keys[:l]
+	b.containers = b.containers[:l]
+}
+
+func (c *cbContainer) dup() (d cbContainer) {
+	d = *c
+	d.array = append([]uint16(nil), c.array...)
+	d.bitmap = append([]uint64(nil), c.bitmap...)
+	d.runs = append([]cbInterval(nil), c.runs...)
+	return
+}
+
+func (b *CompressedBitmap) Dup() (d CompressedBitmap) {
+	d.keys = append([]uint32(nil), b.keys...)
+	d.containers = make([]cbContainer, len(b.containers))
+	for i := range b.containers {
+		d.containers[i] = b.containers[i].dup()
+	}
+	return
+}
+
+func (b *CompressedBitmap) Equal(c *CompressedBitmap) bool {
+	if len(b.keys) != len(c.keys) || b.Count() != c.Count() {
+		return false
+	}
+	for i := range b.keys {
+		if b.keys[i] != c.keys[i] || b.containers[i].n != c.containers[i].n {
+			return false
+		}
+		r := cbCombine(&b.containers[i], &c.containers[i], true)
+		if r.n != b.containers[i].n {
+			return false
+		}
+	}
+	return true
+}
+
+// RunOptimize converts containers with long runs of set bits to run containers when smaller.
+func (b *CompressedBitmap) RunOptimize() {
+	for i := range b.containers {
+		c := &b.containers[i]
+		if c.kind == cbRun {
+			continue
+		}
+		a, m, r := c.sizes()
+		if r < a && r < m {
+			c.toRuns()
+		}
+	}
+}
+
+// MemSize returns approximate number of bytes used to store set bits.
+func (b *CompressedBitmap) MemSize() (n uint) {
+	for i := range b.containers {
+		c := &b.containers[i]
+		n += 4 + 2*uint(len(c.array)) + 8*uint(len(c.bitmap)) + 4*uint(len(c.runs))
+	}
+	return
+}
+
+func (b *CompressedBitmap) String() string {
+	s := "{"
+	b.ForeachSetBit(func(x uint) {
+		if len(s) > 1 {
+			s += ", "
+		}
+		s += fmt.Sprintf("%d", x)
+	})
+	s += "}"
+	return s
+}
+
+// Serialization format: varint number of containers followed by, for each container,
+// varint key, kind byte, varint number of set bits and then
+// array: little endian uint16 set bits
+// bitmap: 1024 little endian uint64 words
+// runs: varint number of runs and little endian uint16 start, len pairs.
+var ErrCompressedBitmapCorrupt = errors.New("compressed bitmap: corrupt encoding")
+
+func (b *CompressedBitmap) MarshalBinary() (data []byte, err error) {
+	var buf [binary.MaxVarintLen64]byte
+	put := func(x uint64) {
+		n := binary.PutUvarint(buf[:], x)
+		data = append(data, buf[:n]...)
+	}
+	put16 := func(x uint16) { data = append(data, byte(x), byte(x>>8)) }
+	put(uint64(len(b.keys)))
+	for i := range b.keys {
+		c := &b.containers[i]
+		put(uint64(b.keys[i]))
+		data = append(data, byte(c.kind))
+		put(uint64(c.n))
+		switch c.kind {
+		case cbArray:
+			for _, x := range c.array {
+				put16(x)
+			}
+		case cbBitmap:
+			for _, w := range c.bitmap {
+				var u [8]byte
+				binary.LittleEndian.PutUint64(u[:], w)
+				data = append(data, u[:]...)
+			}
+		case cbRun:
+			put(uint64(len(c.runs)))
+			for _, r := range c.runs {
+				put16(r.start)
+				put16(r.len)
+			}
+		}
+	}
+	return
+}
+
+// validate checks decoded container: array bits must be strictly increasing,
+// runs sorted, non-overlapping and within chunk and count must match contents.
+func (c *cbContainer) validate() bool {
+	n := uint(0)
+	switch c.kind {
+	case cbArray:
+		for j := range c.array {
+			if j > 0 && c.array[j] <= c.array[j-1] {
+				return false
+			}
+		}
+		n = uint(len(c.array))
+	case cbBitmap:
+		if len(c.bitmap) != cbBitmapWords {
+			return false
+		}
+		for _, w := range c.bitmap {
+			n += Word(w).NSetBits()
+		}
+	case cbRun:
+		for j, r := range c.runs {
+			if r.last() >= cbChunkBits || j > 0 && uint(r.start) <= c.runs[j-1].last() {
+				return false
+			}
+			n += uint(r.len) + 1
+		}
+	default:
+		return false
+	}
+	return n == uint(c.n)
+}
+
+func (b *CompressedBitmap) UnmarshalBinary(data []byte) (err error) {
+	defer func() {
+		if err != nil {
+			b.Reset()
+		}
+	}()
+	get := func() (x uint64) {
+		var n int
+		if x, n = binary.Uvarint(data); n <= 0 {
+			err = ErrCompressedBitmapCorrupt
+			return
+		}
+		data = data[n:]
+		return
+	}
+	get16 := func() (x uint16) {
+		if len(data) < 2 {
+			err = ErrCompressedBitmapCorrupt
+			return
+		}
+		x = binary.LittleEndian.Uint16(data)
+		data = data[2:]
+		return
+	}
+
+	b.Reset()
+	nc := get()
+	if err != nil || nc > uint64(len(data)) {
+		return ErrCompressedBitmapCorrupt
+	}
+	b.keys = make([]uint32, 0, nc)
+	b.containers = make([]cbContainer, 0, nc)
+	for i := uint64(0); i < nc && err == nil; i++ {
+		var c cbContainer
+		key := get()
+		if len(data) < 1 {
+			return ErrCompressedBitmapCorrupt
+		}
+		c.kind = cbKind(data[0])
+		data = data[1:]
+		n := get()
+		if err != nil || n == 0 || n > cbChunkBits || key > uint64(^uint32(0)) {
+			return ErrCompressedBitmapCorrupt
+		}
+		if l := len(b.keys); l > 0 && uint32(key) <= b.keys[l-1] {
+			return ErrCompressedBitmapCorrupt
+		}
+		c.n = uint32(n)
+		switch c.kind {
+		case cbArray:
+			c.array = make([]uint16, n)
+			for j := range c.array {
+				c.array[j] = get16()
+			}
+		case cbBitmap:
+			if len(data) < 8*cbBitmapWords {
+				return ErrCompressedBitmapCorrupt
+			}
+			c.bitmap = make([]uint64, cbBitmapWords)
+			for j := range c.bitmap {
+				c.bitmap[j] = binary.LittleEndian.Uint64(data[8*j:])
+			}
+			data = data[8*cbBitmapWords:]
+		case cbRun:
+			nr := get()
+			if err != nil || nr > n {
+				return ErrCompressedBitmapCorrupt
+			}
+			c.runs = make([]cbInterval, nr)
+			for j := range c.runs {
+				c.runs[j].start = get16()
+				c.runs[j].len = get16()
+			}
+		default:
+			return ErrCompressedBitmapCorrupt
+		}
+		if err != nil || !c.validate() {
+			return ErrCompressedBitmapCorrupt
+		}
+		b.keys = append(b.keys, uint32(key))
+		b.containers = append(b.containers, c)
+	}
+	if err == nil && len(data) != 0 {
+		err = ErrCompressedBitmapCorrupt
+	}
+	return
+}
@@ -0,0 +1,146 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elib
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func checkCompressedBitmap(t *testing.T, tag string, b *CompressedBitmap, m map[uint]bool) {
+	if got, want := b.Count(), uint(len(m)); got != want {
+		t.Fatalf("%s: count got %d want %d", tag, got, want)
+	}
+	n := 0
+	for x := ^uint(0); b.Next(&x); n++ {
+		if !m[x] {
+			t.Fatalf("%s: Next returned unset bit %d", tag, x)
+		}
+	}
+	if n != len(m) {
+		t.Fatalf("%s: Next visited %d want %d", tag, n, len(m))
+	}
+	for x := range m {
+		if !b.Get(x) {
+			t.Fatalf("%s: bit %d not set", tag, x)
+		}
+	}
+}
+
+func TestCompressedBitmap(t *testing.T) {
+	var b, c CompressedBitmap
+	mb, mc := map[uint]bool{}, map[uint]bool{}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20000; i++ {
+		x := uint(r.Intn(1 << 18))
+		if i%4 == 0 {
+			x |= 1 << 40
+		}
+		if r.Intn(3) == 0 {
+			if got, want := b.Unset(x), mb[x]; got != want {
+				t.Fatalf("Unset %d: got %v want %v", x, got, want)
+			}
+			delete(mb, x)
+		} else {
+			if got, want := b.Set(x), mb[x]; got != want {
+				t.Fatalf("Set %d: got %v want %v", x, got, want)
+			}
+			mb[x] = true
+		}
+	}
+	checkCompressedBitmap(t, "set/unset", &b, mb)
+
+	// Dense run crosses chunk boundary.
+	for x := uint(1<<16 - 100); x < 1<<17+5000; x++ {
+		c.Set(x)
+		mc[x] = true
+	}
+	c.Set(1 << 30)
+	mc[1<<30] = true
+	before := c.MemSize()
+	c.RunOptimize()
+	if after := c.MemSize(); after >= before {
+		t.Errorf("RunOptimize: size %d not smaller than %d", after, before)
+	}
+	checkCompressedBitmap(t, "runs", &c, mc)
+
+	data, err := c.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d CompressedBitmap
+	if err = d.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !d.Equal(&c) {
+		t.Errorf("UnmarshalBinary: bitmaps differ")
+	}
+	if err = d.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Errorf("UnmarshalBinary: truncated data accepted")
+	}
+	for _, bad := range [][]byte{
+		// Array bits out of order.
+		{1, 0, byte(cbArray), 2, 5, 0, 3, 0},
+		// Array count does not match bits.
+		{1, 0, byte(cbArray), 1, 5, 0, 3, 0},
+		// Run extends past end of chunk.
+		{1, 0, byte(cbRun), 2, 1, 0xff, 0xff, 1, 0},
+		// Overlapping runs.
+		{1, 0, byte(cbRun), 4, 2, 0, 0, 1, 0, 1, 0, 1, 0},
+	} {
+		if err = d.UnmarshalBinary(bad); err == nil {
+			t.Errorf("UnmarshalBinary: corrupt data % x accepted", bad)
+		}
+		if !d.IsEmpty() {
+			t.Errorf("UnmarshalBinary: corrupt data % x left bits set", bad)
+		}
+	}
+
+	u := b.Dup()
+	u.Or(&c)
+	mu := map[uint]bool{}
+	for x := range mb {
+		mu[x] = true
+	}
+	for x := range mc {
+		mu[x] = true
+	}
+	checkCompressedBitmap(t, "or", &u, mu)
+
+	u.And(&b)
+	checkCompressedBitmap(t, "and", &u, mb)
+
+	var one CompressedBitmap
+	one.Set(1 << 24)
+	if got, want := one.String(), "{16777216}"; got != want {
+		t.Errorf("String: got %s want %s", got, want)
+	}
+	if one.MemSize() > 16 {
+		t.Errorf("single high bit uses %d bytes", one.MemSize())
+	}
+}
+
+func TestCompressedBitmapMaxIndex(t *testing.T) {
+	m := uint64(CompressedBitmapMaxIndex)
+	if uint64(^uint(0)) <= m {
+		t.Skip("uint too narrow to exceed max index")
+	}
+	var b CompressedBitmap
+	last := uint(m)
+	b.Set(last)
+	if !b.Get(last) || b.Get(last+1) || b.Unset(last+1) {
+		t.Fatalf("index past max aliases bit %d", last)
+	}
+	x := last
+	if b.Next(&x) {
+		t.Errorf("Next past max index returned %d", x)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Set %d: no panic", last+1)
+		}
+	}()
+	b.Set(last + 1)
+}
@@ -142,6 +142,7 @@ type sharedHeader struct {
 type shared struct {
 	sharedHeader
 	eventFilterShared
+	eventTrackShared
 	stringTable
 	// Protects fmtBuffer and string table.
 	fmtMu sync.Mutex
@@ -173,6 +174,10 @@ func (b *Buffer) lockIndex(wantLock bool) uint64 {
 		if !atomic.CompareAndSwapUint64(&b.index, i, i^lockBit) {
 			continue
 		}
+		// Wait for loggers which already have an event to finish writing it.
+		if wantLock {
+			waitCommitted(&b.committed, i)
+		}
 		// Return index sans lock bit to user.
 		return i &^ lockBit
 	}
@@ -187,6 +192,9 @@ type Buffer struct {
 	// Bit 63 is lock bit.
 	index uint64
 
+	// Number of events whose data has been written; lags index while loggers fill in events.
+	committed uint64
+
 	// Disable logging when index reaches limit.
 	disableIndex uint64
 
@@ -197,7 +205,11 @@ type Buffer struct {
 
 	panicSaveFile string
 
+	// Rings when in sharded mode; nil otherwise.
+	shards atomic.Pointer[bufferShards]
+
 	eventFilterMain
+	triggerMain
 	shared
 }
 
@@ -206,17 +218,38 @@ func (b *Buffer) Enable(v bool) {
 	b.cpuTimeUnitNsec = 1e9 / cyclesPerSec
 	b.lockIndex(true)
 	b.index &= lockBit
+	b.committed = 0
 	b.disableIndex = 0
 	if v {
 		// Enable => highest possible disable index.
 		b.disableIndex = ^b.disableIndex ^ lockBit
 	}
+	if ss := b.shards.Load(); ss != nil {
+		ss.enable(b.disableIndex)
+	}
 	b.lockIndex(false)
+	if v {
+		b.rearmTriggers()
+	}
+}
+
+// Spin until all events before (locked) index i have been written.
+func waitCommitted(committed *uint64, i uint64) {
+	for i &^= lockBit; atomic.LoadUint64(committed) < i; {
+		runtime.Gosched()
+	}
 }
 
-func (b *Buffer) getIndex() uint64    { return atomic.LoadUint64(&b.index) &^ lockBit }
-func (b *Buffer) GetSequence() uint64 { return b.getIndex() }
-func GetSequence() uint64             { return DefaultBuffer.getIndex() }
+func (b *Buffer) getIndex() uint64 { return atomic.LoadUint64(&b.index) &^ lockBit }
+
+// GetSequence returns number of events logged.
+func (b *Buffer) GetSequence() uint64 {
+	if ss := b.shards.Load(); ss != nil {
+		return ss.sequence()
+	}
+	return b.getIndex()
+}
+func GetSequence() uint64 { return DefaultBuffer.GetSequence() }
 
 func (b *Buffer) Enabled() bool {
 	return Enabled() && b.getIndex() < b.disableIndex
@@ -239,6 +272,9 @@ type callerCache struct {
 	callerIndex       uint32
 	callerInfo        CallerInfo
 	fe                fmtEvent
+	// Triggers fired by events from this caller; nil if none.
+	// Replaced when triggers are added or deleted while loggers are reading it.
+	triggers atomic.Pointer[[]*Trigger]
 }
 
 // Event filter info shared between Buffer and View.
@@ -254,21 +290,22 @@ func (dst *eventFilterShared) copyFrom(src *eventFilterShared) {
 	dst.callers = src.callers
 }
 
+// Entries are immutable once published so concurrent loggers never see a torn entry.
 type l1CacheEntry struct {
-	disable     bool
-	callerIndex uint32
-	pc          uint64
+	disable bool
+	pc      uint64
+	cc      *callerCache
 }
 
 type eventFilterMain struct {
 	filters      []*eventFilter
 	filterByName map[string]*eventFilter
-	l1Cache      [1 << log2HLen]l1CacheEntry
+	l1Cache      [1 << log2HLen]atomic.Pointer[l1CacheEntry]
 }
 
 func (m *eventFilterMain) invalidateL1Cache() {
 	for i := range m.l1Cache {
-		m.l1Cache[i] = l1CacheEntry{}
+		m.l1Cache[i].Store(nil)
 	}
 }
 
@@ -297,10 +334,9 @@ func (m *Buffer) getCaller(d Logger, caller Caller) (cc *callerCache, disable bo
 	// Check 1st level hash.  No lock required.
 	pc := caller.pc
 	pch := &m.l1Cache[caller.pcHash&(1<<log2HLen-1)]
-	disable = pch.disable
-	if pch.pc == pc {
-		cc = m.callers[pch.callerIndex]
-		cc.f.count++
+	if e := pch.Load(); e != nil && e.pc == pc {
+		cc, disable = e.cc, e.disable
+		atomic.AddUint32(&cc.f.count, 1)
 		return
 	}
 
@@ -309,12 +345,10 @@ func (m *Buffer) getCaller(d Logger, caller Caller) (cc *callerCache, disable bo
 	cc, ok := m.callerByPC[pc]
 	if ok {
 		disable = cc.f.disable
-		cc.f.count++
+		atomic.AddUint32(&cc.f.count, 1)
 		m.mu.RUnlock()
 		// Update 1st level cache. No lock required.
-		pch.pc = pc
-		pch.callerIndex = cc.callerIndex
-		pch.disable = disable
+		pch.Store(&l1CacheEntry{pc: pc, cc: cc, disable: disable})
 		return
 	}
 	m.mu.RUnlock()
@@ -347,10 +381,9 @@ func (m *Buffer) getCaller(d Logger, caller Caller) (cc *callerCache, disable bo
 		cc.f = *found
 		cc.f.count = 1
 	}
+	cc.setTriggers(m.callerTriggers(&ci))
 	m.callerByPC[pc] = cc
-	pch.pc = pc
-	pch.callerIndex = cc.callerIndex
-	pch.disable = disable
+	pch.Store(&l1CacheEntry{pc: pc, cc: cc, disable: disable})
 	m.mu.Unlock()
 	return
 }
@@ -485,18 +518,33 @@ func (b *Buffer) clear(resize uint) {
 		b.events = make([]bufferEvent, 1<<b.log2Len)
 	}
 	b.index = lockBit
+	b.committed = 0
 	b.lockIndex(false)
+	if ss := b.shards.Load(); ss != nil {
+		if resize != 0 {
+			b.SetShards(uint(len(ss.shards)))
+		} else {
+			ss.clear()
+		}
+	}
 }
 
 func (b *Buffer) Clear() { b.clear(0) }
 func Clear()             { DefaultBuffer.Clear() }
 
+// Largest number of events DisableAfter will wait for: half of buffer.
+func (b *Buffer) maxDisableAfter() uint64 { return 1 << (b.log2Len - 1) }
+
 // Disable logging after specified number of events have been logged.
 // This is used as a "debug trigger" when a certain target event has occurred.
 // Events will be logged both before and after the target event.
 func (b *Buffer) DisableAfter(n uint64) {
-	if n > 1<<(b.log2Len-1) {
-		n = 1 << (b.log2Len - 1)
+	if max := b.maxDisableAfter(); n > max {
+		n = max
+	}
+	if ss := b.shards.Load(); ss != nil {
+		ss.disableAfter(n)
+		return
 	}
 	b.lockIndex(true)
 	b.disableIndex = b.getIndex() + n
@@ -577,11 +625,28 @@ func (e *bufferEvent) setData(d Logger) {
 }
 
 func (b *Buffer) add1(d Logger, c Caller, t uint, r *callerCache) {
-	e := b.getEvent()
+	var (
+		e         *bufferEvent
+		committed *uint64
+	)
+	if ss := b.shards.Load(); ss != nil {
+		s := ss.get(&c)
+		if e = s.getEvent(); e == nil {
+			return
+		}
+		committed = &s.committed
+	} else {
+		e = b.getEvent()
+		committed = &b.committed
+	}
 	e.timestamp = c.time
 	e.callerIndex = r.callerIndex
 	e.trackIndex = uint32(t)
 	e.setData(d)
+	atomic.AddUint64(committed, 1)
+	if ts := r.triggers.Load(); ts != nil {
+		b.fireCallerTriggers(*ts, c.time)
+	}
 	return
 }
 
@@ -648,6 +713,7 @@ func Resize(n uint)             { DefaultBuffer.Resize(n) }
 func Configure(in *parse.Input) (err error) {
 	var (
 		save          string
+		stream        string
 		disable_after uint64
 	)
 	for !in.End() {
@@ -661,7 +727,10 @@ func Configure(in *parse.Input) (err error) {
 		case in.Parse("panic-save %v", &save):
 		case in.Parse("s%*ize %d", &i):
 			Resize(i)
+		case in.Parse("sh%*ards %d", &i):
+			SetShards(i)
 		case in.Parse("disable-after %d", &disable_after):
+		case in.Parse("stream %v", &stream):
 		default:
 			in.ParseError()
 		}
@@ -669,6 +738,11 @@ func Configure(in *parse.Input) (err error) {
 	if disable_after != 0 {
 		DisableAfter(disable_after)
 	}
+	if stream != "" {
+		if err = StreamToFile(stream, DefaultStreamMaxBytes, DefaultStreamMaxFiles, DefaultStreamInterval); err != nil {
+			return
+		}
+	}
 	// Save on signal 1 HUP.
 	if save != "" {
 		go SaveOnHangupSignal(save)
@@ -724,6 +798,10 @@ func (c *CallerInfo) Match(re *regexp.Regexp) bool {
 func callerInfoForPC(pc uint64) (c CallerInfo) {
 	fi := runtime.FuncForPC(uintptr(pc))
 	c.PC = pc
+	// Caller pc from getPC may be bogus when arguments are passed in registers.
+	if fi == nil {
+		return
+	}
 	c.Entry = uint64(fi.Entry())
 	c.Name = fi.Name()
 	c.File, c.Line = fi.FileLine(uintptr(pc))
@@ -883,6 +961,9 @@ func HexData(p []byte) string {
 }
 
 func (b *Buffer) Len() (n int) {
+	if ss := b.shards.Load(); ss != nil {
+		return ss.len()
+	}
 	n = int(b.index)
 	max := 1 << b.log2Len
 	if n > max {
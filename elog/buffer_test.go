@@ -0,0 +1,97 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elog
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestShardedBuffer(t *testing.T) {
+	if !Enabled() {
+		t.Skip("event log disabled; build with -tags elog")
+	}
+	b := New(14)
+	b.Enable(true)
+	b.SetShards(4)
+	if n := b.NumShards(); n != 4 {
+		t.Fatalf("shards %d", n)
+	}
+	const (
+		nLoggers = 8
+		nEvents  = 500
+	)
+	var wg sync.WaitGroup
+	for g := 0; g < nLoggers; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < nEvents; i++ {
+				b.F2u("logger %d event %d", uint64(g), uint64(i))
+			}
+		}(g)
+	}
+	wg.Wait()
+	if n := b.GetSequence(); n != nLoggers*nEvents {
+		t.Fatalf("sequence %d", n)
+	}
+	v := b.NewView()
+	if n := v.NumEvents(); n != nLoggers*nEvents {
+		t.Fatalf("view has %d events", n)
+	}
+	seen := make(map[string]bool)
+	for i := uint(0); i < v.NumEvents(); i++ {
+		if i > 0 && v.Event(i).timestamp < v.Event(i-1).timestamp {
+			t.Fatalf("event %d out of order", i)
+		}
+		seen[strings.Join(v.EventLines(i), "")] = true
+	}
+	// Each logger's events must survive intact.
+	for g := 0; g < nLoggers; g++ {
+		for i := 0; i < nEvents; i++ {
+			if s := fmt.Sprintf("logger %d event %d", g, i); !seen[s] {
+				t.Fatalf("missing event %q", s)
+			}
+		}
+	}
+
+	b.Clear()
+	if n := b.NewView().NumEvents(); n != 0 {
+		t.Fatalf("%d events after clear", n)
+	}
+	b.DisableAfter(100)
+	for i := 0; i < 1000; i++ {
+		b.F1u("after %d", uint64(i))
+	}
+	if n := b.NewView().NumEvents(); n == 0 || n > 100+4 {
+		t.Fatalf("%d events after disable", n)
+	}
+}
+
+// Each parallel goroutine stands in for a loop active poller.
+func benchmarkLogParallel(b *testing.B, nShards uint) {
+	if !Enabled() {
+		b.Skip("event log disabled; build with -tags elog")
+	}
+	buf := New(16)
+	buf.Enable(true)
+	buf.SetShards(nShards)
+	b.SetParallelism(4)
+	b.RunParallel(func(pb *testing.PB) {
+		i := uint64(0)
+		for pb.Next() {
+			buf.F1u("poller event %d", i)
+			i++
+		}
+	})
+}
+
+func BenchmarkLogParallel(b *testing.B) { benchmarkLogParallel(b, 0) }
+func BenchmarkLogParallelSharded(b *testing.B) {
+	benchmarkLogParallel(b, uint(runtime.GOMAXPROCS(0)))
+}
@@ -10,3 +10,16 @@ import (
 
 //go:noescape
 func getPC(argp unsafe.Pointer, PCHashSeed uint64) (Time, PC, PCHash uint64)
+
+// Returns cpu number from rdtscp instruction (linux sets TSC_AUX to cpu number).
+func cpuIndex() uint32
+
+func cpuid(op uint32) (eax, ebx, ecx, edx uint32)
+
+var haveCpuIndex = func() bool {
+	if max, _, _, _ := cpuid(0x80000000); max < 0x80000001 {
+		return false
+	}
+	_, _, _, edx := cpuid(0x80000001)
+	return edx&(1<<27) != 0
+}()
@@ -13,3 +13,21 @@ TEXT ·getPC(SB),4,$16-24
 	AESENC  X0, X0
 	MOVQ	X0, ret+32(FP)
 	RET
+
+// func cpuIndex() uint32
+TEXT ·cpuIndex(SB),4,$0-4
+	RDTSCP
+	ANDL	$0xfff, CX
+	MOVL	CX, ret+0(FP)
+	RET
+
+// func cpuid(op uint32) (eax, ebx, ecx, edx uint32)
+TEXT ·cpuid(SB),4,$0-24
+	MOVL	op+0(FP), AX
+	XORL	CX, CX
+	CPUID
+	MOVL	AX, eax+8(FP)
+	MOVL	BX, ebx+12(FP)
+	MOVL	CX, ecx+16(FP)
+	MOVL	DX, edx+20(FP)
+	RET
@@ -36,3 +36,7 @@ func getPC(argp unsafe.Pointer, pcHashSeed uint64) (time, pc, pcHash uint64) {
 	pcHash = pcHash(pc, pcHashSeed)
 	return
 }
+
+func cpuIndex() uint32 { return 0 }
+
+const haveCpuIndex = false
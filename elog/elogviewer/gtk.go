@@ -0,0 +1,21 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build elog_gtk
+
+package main
+
+import (
+	"github.com/platinasystems/elib/elog"
+	"github.com/platinasystems/elib/elog/elogview"
+)
+
+func display(v *elog.View, o *elog.HTMLOptions) {
+	cf := elogview.Config{
+		Width:              1200,
+		Height:             750,
+		EnableKeyboardQuit: true,
+	}
+	elogview.View(v, cf)
+}
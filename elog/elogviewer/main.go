@@ -1,11 +1,15 @@
-// +build ignore
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
 
+// Elogviewer shows event logs: statistics, diffs and dumps on the terminal, an HTML timeline
+// (standard library only) and, when built with tag elog_gtk, a GTK viewer.
+// Logs from several hosts given as [HOST=]FILE arguments are merged into one timeline.
 package main
 
 import (
 	"github.com/platinasystems/elib"
 	"github.com/platinasystems/elib/elog"
-	"github.com/platinasystems/elib/elog/elogview"
 
 	"flag"
 	"fmt"
@@ -13,6 +17,7 @@ import (
 	"math/rand"
 	"os"
 	"runtime"
+	"strings"
 	"time"
 )
 
@@ -36,6 +41,67 @@ type ev struct {
 
 func (e *ev) Elog(l *elog.Log) { l.Logf("%s %d", e.color, e.i) }
 
+// Event pairs given as NAME=START-REGEXP,END-REGEXP.
+type pairFlag []elog.EventPair
+
+func (f *pairFlag) String() string { return fmt.Sprint(*f) }
+func (f *pairFlag) Set(s string) (err error) {
+	var name, start, end string
+	if i := strings.Index(s, "="); i >= 0 {
+		name, s = s[:i], s[i+1:]
+	}
+	i := strings.Index(s, ",")
+	if i < 0 {
+		return fmt.Errorf("expected START,END: %s", s)
+	}
+	start, end = s[:i], s[i+1:]
+	if name == "" {
+		name = s
+	}
+	var p elog.EventPair
+	if p, err = elog.NewEventPair(name, start, end); err == nil {
+		*f = append(*f, p)
+	}
+	return
+}
+
+func loadView(file string) (v *elog.View) {
+	f, err := os.OpenFile(file, os.O_RDONLY, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	v = &elog.View{}
+	if err = v.Restore(f); err != nil {
+		log.Fatal(err)
+	}
+	v.SetName(file)
+	return
+}
+
+func mergeViews(args []string, pairs []elog.EventPair) (v *elog.View) {
+	var srcs []elog.MergeSource
+	for _, a := range args {
+		var s elog.MergeSource
+		if i := strings.Index(a, "="); i >= 0 {
+			s.Host, a = a[:i], a[i+1:]
+		}
+		s.View = loadView(a)
+		srcs = append(srcs, s)
+	}
+	o := &elog.MergeOptions{Pairs: pairs}
+	if len(pairs) > 0 {
+		o.Align = elog.AlignEventPairs
+	}
+	v, shifts := elog.MergeViews(o, srcs...)
+	if len(pairs) > 0 {
+		for i := range srcs {
+			fmt.Fprintf(os.Stderr, "%s: clock shifted %v\n", args[i], shifts[i])
+		}
+	}
+	return
+}
+
 func main() {
 	var (
 		n_events     uint
@@ -54,30 +120,47 @@ func main() {
 	}
 	flag.StringVar(&load, "load", "", "load log from file")
 	flag.BoolVar(&dump, "dump", false, "dump log to stdout")
+	var (
+		stats    bool
+		diff     string
+		pairs    pairFlag
+		from, to float64
+	)
+	flag.BoolVar(&stats, "stats", false, "print event statistics")
+	flag.StringVar(&diff, "diff", "", "print statistics of log compared with those of given file")
+	flag.Var(&pairs, "pair", "measure time between events matching NAME=START-REGEXP,END-REGEXP (may be repeated)")
+	flag.Float64Var(&from, "from", 0, "start time of events to show in seconds since log start time rounded down to a second")
+	flag.Float64Var(&to, "to", 0, "end time of events to show in seconds since log start time rounded down to a second")
+	var (
+		htmlFile  string
+		sourceURL string
+	)
+	flag.StringVar(&htmlFile, "html", "", "write self-contained HTML timeline to given file")
+	flag.StringVar(&sourceURL, "source-url", "", "HTML caller source link with %f for file and %l for line (e.g. vscode://file/%f:%l)")
+	var syncPairs pairFlag
+	flag.Var(&syncPairs, "sync", "when merging logs align host clocks with send/receive events matching NAME=SEND-REGEXP,RECEIVE-REGEXP\n"+
+		"(first submatch, e.g. a sequence number, pairs events; may be repeated)")
 	flag.Parse()
 
+	// Several files: merge logs from several hosts given as [HOST=]FILE.
+	var merge []string
 	if as := flag.Args(); len(as) == 1 {
 		load = as[0]
+	} else if len(as) > 1 {
+		merge = as
 	}
 
-	if !elib.Debug && len(load) == 0 {
+	if !elib.Debug && len(load) == 0 && len(merge) == 0 {
 		fmt.Println("expecting event log file to load")
 		return
 	}
 
 	var v *elog.View
 
-	if load != "" {
-		if f, err := os.OpenFile(load, os.O_RDONLY, 0); err != nil {
-			log.Fatal(err)
-		} else {
-			defer f.Close()
-			var r elog.View
-			if err = r.Restore(f); err != nil {
-				log.Fatal(err)
-			}
-			v = &r
-		}
+	if len(merge) > 0 {
+		v = mergeViews(merge, syncPairs)
+	} else if load != "" {
+		v = loadView(load)
 	} else {
 		elog.DefaultBuffer.Resize(n_events)
 		elog.Enable(true)
@@ -146,14 +229,35 @@ func main() {
 			}
 		}
 	}
-	if dump {
+	o := &elog.HTMLOptions{SourceURL: sourceURL}
+	if to > from {
+		v.SubView(from, to)
+	}
+	if htmlFile != "" {
+		if err := v.SaveHTMLFile(htmlFile, o); err != nil {
+			log.Fatal(err)
+		}
+	} else if stats || diff != "" {
+		views := []*elog.View{v}
+		if diff != "" {
+			views = append(views, loadView(diff))
+		}
+		var s []*elog.ViewStats
+		for i, x := range views {
+			if i > 0 && to > from {
+				x.SubView(from, to)
+			}
+			s = append(s, x.Stats(pairs...))
+		}
+		if diff != "" {
+			fmt.Printf("%s vs %s\n", v.Name(), diff)
+			elog.WriteStatsDiff(os.Stdout, s[0], s[1])
+		} else {
+			s[0].Write(os.Stdout)
+		}
+	} else if dump {
 		v.Print(os.Stdout, false)
 	} else {
-		cf := elogview.Config{
-			Width:              1200,
-			Height:             750,
-			EnableKeyboardQuit: true,
-		}
-		elogview.View(v, cf)
+		display(v, o)
 	}
 }
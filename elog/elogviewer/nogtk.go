@@ -0,0 +1,36 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !elog_gtk
+
+package main
+
+import (
+	"github.com/platinasystems/elib/elog"
+
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Without GTK write HTML timeline to a temporary file to be opened in a browser.
+func display(v *elog.View, o *elog.HTMLOptions) {
+	name := strings.TrimSuffix(filepath.Base(v.Name()), filepath.Ext(v.Name()))
+	if name == "" || name == "." {
+		name = "elog"
+	}
+	f, err := os.CreateTemp("", name+"-*.html")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = v.WriteHTML(f, o); err == nil {
+		err = f.Close()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("wrote", f.Name(), "(open in a web browser)")
+}
@@ -7,6 +7,7 @@ package elog
 import (
 	"github.com/platinasystems/elib"
 
+	"bytes"
 	"encoding/binary"
 	"encoding/gob"
 	"errors"
@@ -29,20 +30,31 @@ func PutUvarint(b []byte, i int) (c []byte) {
 }
 
 func (v *View) Save(w io.Writer) (err error) {
-	enc := gob.NewEncoder(w)
-	err = enc.Encode(v)
+	var b []byte
+	if b, err = v.MarshalBinary(); err != nil {
+		return
+	}
+	_, err = w.Write(b)
 	return
 }
 
+// Restore reads view in current format or legacy gob encoded format.
 func (v *View) Restore(r io.Reader) (err error) {
-	dec := gob.NewDecoder(r)
+	var b []byte
+	if b, err = io.ReadAll(r); err != nil {
+		return
+	}
+	if isFramed(b) {
+		return v.UnmarshalBinary(b)
+	}
+	dec := gob.NewDecoder(bytes.NewReader(b))
 	err = dec.Decode(v)
 	return
 }
 
 func (v *View) SaveFile(file string) (err error) {
 	var f *os.File
-	if f, err = os.OpenFile(file, os.O_CREATE|os.O_RDWR, 0666); err != nil {
+	if f, err = os.OpenFile(file, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0666); err != nil {
 		return
 	}
 	defer f.Close()
@@ -62,7 +74,7 @@ func (v *View) LoadFile(file string) (err error) {
 		return
 	}
 	defer f.Close()
-	v.Restore(f)
+	err = v.Restore(f)
 	return
 }
 
@@ -214,7 +226,9 @@ short:
 	return
 }
 
-func (v *View) MarshalBinary() ([]byte, error) {
+// Legacy format: bare varint stream without magic, version or checksums.
+// Written only to test that legacy files can still be read.
+func (v *View) marshalLegacy() ([]byte, error) {
 	var b elib.ByteVec
 
 	i := 0
@@ -269,10 +283,22 @@ func (v *View) MarshalBinary() ([]byte, error) {
 	// Event formats and arguments.
 	b, i = encodeString(b, i, string(v.viewEvents.b))
 
+	// Track names (not present in older files).
+	b.Validate(uint(i + binary.MaxVarintLen64))
+	i += binary.PutUvarint(b[i:], uint64(len(v.tracks)))
+	for _, t := range v.tracks {
+		b, i = encodeString(b, i, t.Name)
+	}
+
+	// Track hosts for merged views (not present in older files).
+	for _, t := range v.tracks {
+		b, i = encodeString(b, i, t.Host)
+	}
+
 	return b[:i], nil
 }
 
-func (v *View) UnmarshalBinary(b []byte) (err error) {
+func (v *View) unmarshalLegacy(b []byte) (err error) {
 	i := 0
 	bo := binary.BigEndian
 
@@ -286,6 +312,9 @@ func (v *View) UnmarshalBinary(b []byte) (err error) {
 		return errUnderflow
 	}
 
+	if i+8 > len(b) {
+		return errUnderflow
+	}
 	v.cpuTimeUnitNsec = math.Float64frombits(bo.Uint64(b[i:]))
 	i += 8
 
@@ -363,6 +392,33 @@ func (v *View) UnmarshalBinary(b []byte) (err error) {
 		v.viewEvents.b = []byte(s)
 	}
 
+	// Track names and hosts.
+	if i < len(b) {
+		var names []string
+		if x, n := binary.Uvarint(b[i:]); n > 0 {
+			i += n
+			names = make([]string, x)
+			for j := range names {
+				if names[j], i, err = decodeString(b, i, 0); err != nil {
+					return
+				}
+			}
+		} else {
+			return errUnderflow
+		}
+		hosts := make([]string, len(names))
+		if i < len(b) {
+			for j := range hosts {
+				if hosts[j], i, err = decodeString(b, i, 0); err != nil {
+					return
+				}
+			}
+		}
+		for j := range names {
+			v.addHostTrack(hosts[j], names[j])
+		}
+	}
+
 	v.currentViewEvents = v.allViewEvents
 	v.getViewTimes()
 
@@ -0,0 +1,154 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elog
+
+import (
+	"github.com/platinasystems/elib"
+
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Tabular export of events: one row per event with columns time, track, caller and event
+// (and host for views merged from several hosts) followed by the union of all structured
+// fields of the exported events.
+
+type eventColumns struct {
+	names []string
+	// Index of field column by name.
+	index map[string]int
+}
+
+func (v *View) eventColumns(events []uint) (c eventColumns) {
+	c.names = []string{"time", "track", "caller", "event"}
+	c.index = make(map[string]int)
+	if len(v.Hosts()) > 0 {
+		c.index["host"] = len(c.names)
+		c.names = append(c.names, "host")
+	}
+	for _, i := range events {
+		fields, _ := v.EventFields(i)
+		for _, f := range fields {
+			if _, ok := c.index[f.Name]; !ok {
+				c.index[f.Name] = len(c.names)
+				c.names = append(c.names, f.Name)
+			}
+		}
+	}
+	return
+}
+
+// All events in view if events is nil.
+func (v *View) exportEvents(events []uint) []uint {
+	if events == nil {
+		events = make([]uint, v.NumEvents())
+		for i := range events {
+			events[i] = uint(i)
+		}
+	}
+	return events
+}
+
+func (v *View) eventName(i uint) string {
+	if lines := v.EventLines(i); len(lines) > 0 {
+		return lines[0]
+	}
+	return ""
+}
+
+func formatFieldValue(x interface{}) string {
+	switch v := x.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(x)
+}
+
+// Row of strings for event; missing fields are empty.
+func (v *View) eventRow(c *eventColumns, i uint) (row []string) {
+	row = make([]string, len(c.names))
+	e := v.Event(i)
+	row[0] = fmt.Sprintf("%.9f", v.ElapsedTime(e))
+	row[1] = v.TrackName(uint(e.trackIndex))
+	row[2] = v.EventCaller(i).Name
+	row[3] = v.eventName(i)
+	if k, ok := c.index["host"]; ok {
+		row[k] = v.EventHost(i)
+	}
+	fields, values := v.EventFields(i)
+	for j := range fields {
+		row[c.index[fields[j].Name]] = formatFieldValue(values[j])
+	}
+	return
+}
+
+// WriteCSV writes given events (all events if nil) as comma separated values with header line.
+func (v *View) WriteCSV(w io.Writer, events []uint) (err error) {
+	events = v.exportEvents(events)
+	c := v.eventColumns(events)
+	cw := csv.NewWriter(w)
+	if err = cw.Write(c.names); err != nil {
+		return
+	}
+	for _, i := range events {
+		if err = cw.Write(v.eventRow(&c, i)); err != nil {
+			return
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes given events (all events if nil) as a JSON array of objects.
+// Field values keep their types; events without a given field omit it.
+func (v *View) WriteJSON(w io.Writer, events []uint) (err error) {
+	events = v.exportEvents(events)
+	enc := json.NewEncoder(w)
+	if _, err = io.WriteString(w, "[\n"); err != nil {
+		return
+	}
+	for k, i := range events {
+		e := v.Event(i)
+		m := map[string]interface{}{
+			"time":   v.ElapsedTime(e),
+			"track":  v.TrackName(uint(e.trackIndex)),
+			"caller": v.EventCaller(i).Name,
+			"event":  v.eventName(i),
+		}
+		if h := v.EventHost(i); h != "" {
+			m["host"] = h
+		}
+		fields, values := v.EventFields(i)
+		for j := range fields {
+			m[fields[j].Name] = values[j]
+		}
+		if k > 0 {
+			if _, err = io.WriteString(w, ","); err != nil {
+				return
+			}
+		}
+		if err = enc.Encode(m); err != nil {
+			return
+		}
+	}
+	_, err = io.WriteString(w, "]\n")
+	return
+}
+
+// WriteTable writes given events (all events if nil) as aligned columns.
+func (v *View) WriteTable(w io.Writer, events []uint) {
+	events = v.exportEvents(events)
+	c := v.eventColumns(events)
+	rows := make([][]string, len(events))
+	for k, i := range events {
+		rows[k] = v.eventRow(&c, i)
+	}
+	elib.TabulateRows(c.names, rows).Write(w)
+}
@@ -0,0 +1,313 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elog
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// Structured events: event data types may optionally be registered with RegisterType so that
+// views can extract named, typed field values from events without per-type code.
+// Field names default to struct field names; a struct tag elog:"name" renames a field and
+// elog:"-" omits it.
+// Event data is copied into buffers as raw bytes which the garbage collector does not scan,
+// so fields whose types contain pointers (strings, slices, pointers, interfaces, ...) are
+// never described: use StringRef or byte arrays for strings.
+
+type FieldKind uint8
+
+const (
+	FieldBool FieldKind = iota
+	FieldInt
+	FieldUint
+	FieldFloat
+	FieldString
+)
+
+var fieldKindChars = [...]byte{
+	FieldBool:   'b',
+	FieldInt:    'i',
+	FieldUint:   'u',
+	FieldFloat:  'f',
+	FieldString: 's',
+}
+
+var fieldKindNames = [...]string{
+	FieldBool:   "bool",
+	FieldInt:    "int",
+	FieldUint:   "uint",
+	FieldFloat:  "float",
+	FieldString: "string",
+}
+
+func (k FieldKind) String() string { return fieldKindNames[k] }
+
+type Field struct {
+	Name string
+	Kind FieldKind
+}
+
+// EventType describes fields of a registered event data type.
+type EventType struct {
+	// Package qualified type name.
+	Name   string
+	Fields []Field
+
+	// Index of each field in struct.
+	index [][]int
+	// Kind of value needing conversion: StringRef, byte array or fmt.Stringer.
+	conv []fieldConv
+}
+
+type fieldConv uint8
+
+const (
+	fieldConvNone fieldConv = iota
+	fieldConvStringRef
+	fieldConvBytes
+	fieldConvStringer
+)
+
+var eventTypes struct {
+	mu     sync.RWMutex
+	byType map[reflect.Type]*EventType
+}
+
+var (
+	stringerType  = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	stringRefType = reflect.TypeOf(StringRef(0))
+)
+
+func (t *EventType) addFields(rt reflect.Type, index []int) {
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		name := f.Name
+		if tag := f.Tag.Get("elog"); tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		idx := append(append([]int(nil), index...), i)
+		ft := f.Type
+		if ft.Kind() == reflect.Struct && f.Anonymous {
+			t.addFields(ft, idx)
+			continue
+		}
+		// Pointers in event data may be freed before event is viewed.
+		if hasPointers(ft) {
+			continue
+		}
+		var (
+			kind FieldKind
+			conv fieldConv
+		)
+		switch {
+		case ft == stringRefType:
+			kind, conv = FieldString, fieldConvStringRef
+		case reflect.PtrTo(ft).Implements(stringerType):
+			kind, conv = FieldString, fieldConvStringer
+		case ft.Kind() == reflect.Array && ft.Elem().Kind() == reflect.Uint8:
+			kind, conv = FieldString, fieldConvBytes
+		case ft.Kind() == reflect.Bool:
+			kind = FieldBool
+		case ft.Kind() >= reflect.Int && ft.Kind() <= reflect.Int64:
+			kind = FieldInt
+		case ft.Kind() >= reflect.Uint && ft.Kind() <= reflect.Uintptr:
+			kind = FieldUint
+		case ft.Kind() == reflect.Float32 || ft.Kind() == reflect.Float64:
+			kind = FieldFloat
+		default:
+			// Fields of other types are not described.
+			continue
+		}
+		t.Fields = append(t.Fields, Field{Name: name, Kind: kind})
+		t.index = append(t.index, idx)
+		t.conv = append(t.conv, conv)
+	}
+}
+
+// Returns whether values of type t contain pointers.
+func hasPointers(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Array:
+		return t.Len() > 0 && hasPointers(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if hasPointers(t.Field(i).Type) {
+				return true
+			}
+		}
+		return false
+	case reflect.Ptr, reflect.UnsafePointer, reflect.String, reflect.Slice, reflect.Map,
+		reflect.Chan, reflect.Func, reflect.Interface:
+		return true
+	default:
+		return false
+	}
+}
+
+// RegisterType describes fields of event data type of x (a pointer to struct) for views.
+// Registering a type more than once returns the same description.
+// Fields whose types contain pointers (including strings) are left out since event data is
+// not scanned by the garbage collector; fmt.Stringer fields are described only when pointer-free.
+func RegisterType(x Logger) (t *EventType) {
+	rt := reflect.TypeOf(x)
+	if rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+	}
+	if rt.Kind() != reflect.Struct {
+		panic(fmt.Errorf("elog: RegisterType %v: not a struct", rt))
+	}
+	eventTypes.mu.Lock()
+	defer eventTypes.mu.Unlock()
+	if t = eventTypes.byType[rt]; t != nil {
+		return
+	}
+	t = &EventType{Name: rt.String()}
+	t.addFields(rt, nil)
+	if eventTypes.byType == nil {
+		eventTypes.byType = make(map[reflect.Type]*EventType)
+	}
+	eventTypes.byType[rt] = t
+	return
+}
+
+func getEventType(rt reflect.Type) (t *EventType) {
+	eventTypes.mu.RLock()
+	t = eventTypes.byType[rt]
+	eventTypes.mu.RUnlock()
+	return
+}
+
+// Field values have types bool, int64, uint64, float64 or string.
+func (t *EventType) values(s *shared, data unsafe.Pointer, rt reflect.Type) (values []interface{}) {
+	v := reflect.NewAt(rt, data).Elem()
+	values = make([]interface{}, len(t.Fields))
+	for i := range t.Fields {
+		fv := v.FieldByIndex(t.index[i])
+		var x interface{}
+		switch t.conv[i] {
+		case fieldConvStringRef:
+			x = s.GetString(StringRef(fv.Uint()))
+		case fieldConvStringer:
+			// Access possibly unexported field via pointer.
+			x = reflect.NewAt(fv.Type(), unsafe.Pointer(fv.UnsafeAddr())).Interface().(fmt.Stringer).String()
+		case fieldConvBytes:
+			// Field may be unexported so copy bytes via pointer.
+			b := make([]byte, fv.Len())
+			copy(b, unsafe.Slice((*byte)(unsafe.Pointer(fv.UnsafeAddr())), len(b)))
+			x = String(b)
+		default:
+			switch t.Fields[i].Kind {
+			case FieldBool:
+				x = fv.Bool()
+			case FieldInt:
+				x = fv.Int()
+			case FieldUint:
+				x = fv.Uint()
+			case FieldFloat:
+				x = fv.Float()
+			}
+		}
+		values[i] = x
+	}
+	return
+}
+
+// In saved views field values are encoded as an extra format record with arguments.
+// Format is fieldsFormatPrefix followed by space separated NAME:KIND pairs.
+const fieldsFormatPrefix = "\x01fields"
+
+func isFieldsFormat(format string) bool { return strings.HasPrefix(format, fieldsFormatPrefix) }
+
+func (t *EventType) format() string {
+	s := fieldsFormatPrefix
+	for _, f := range t.Fields {
+		s += fmt.Sprintf(" %s:%c", f.Name, fieldKindChars[f.Kind])
+	}
+	return s
+}
+
+func parseFieldsFormat(format string) (fs []Field) {
+	for _, x := range strings.Fields(format[len(fieldsFormatPrefix):]) {
+		i := strings.LastIndexByte(x, ':')
+		if i < 0 || i+1 >= len(x) {
+			continue
+		}
+		f := Field{Name: x[:i]}
+		for k, c := range fieldKindChars {
+			if c == x[i+1] {
+				f.Kind = FieldKind(k)
+			}
+		}
+		fs = append(fs, f)
+	}
+	return
+}
+
+// Maximum length of encoded strings.
+const maxFieldStringLen = 255
+
+// Append field record for event to view buffer at index i.
+func (v *viewEvents) encodeFields(s *shared, e *bufferEvent, i uint) uint {
+	r := s.callers[e.callerIndex]
+	rt := r.getDataType()
+	t := getEventType(rt)
+	if t == nil {
+		return i
+	}
+	values := t.values(s, unsafe.Pointer(&e.data[0]), rt)
+	for j := range values {
+		if x, ok := values[j].(string); ok && len(x) > maxFieldStringLen {
+			values[j] = x[:maxFieldStringLen]
+		}
+	}
+	_, i = fmtEncode(s, &v.b, i, true, nil, StringRefNil, t.format(), values)
+	return i
+}
+
+// EventFields returns fields and values for event with given index in view.
+// Fields is nil if event's type has not been registered.
+func (v *View) EventFields(i uint) (fields []Field, values []interface{}) {
+	if v.currentBufferEvents != nil {
+		e := &v.currentBufferEvents[i]
+		r := v.callers[e.callerIndex]
+		rt := r.getDataType()
+		if t := getEventType(rt); t != nil {
+			fields, values = t.Fields, t.values(&v.shared, unsafe.Pointer(&e.data[0]), rt)
+		}
+		return
+	}
+	e := &v.currentViewEvents[i]
+	b := v.b[e.lo:e.hi]
+	for j := 0; j < len(b); {
+		var (
+			format string
+			args   []interface{}
+			n      int
+		)
+		n, format, args = fmtDecode(&v.shared, b[j:])
+		j += n
+		if isFieldsFormat(format) {
+			if v.fieldsByFormat == nil {
+				v.fieldsByFormat = make(map[string][]Field)
+			}
+			fs, ok := v.fieldsByFormat[format]
+			if !ok {
+				fs = parseFieldsFormat(format)
+				v.fieldsByFormat[format] = fs
+			}
+			if len(fs) == len(args) {
+				fields, values = fs, args
+			}
+			return
+		}
+	}
+	return
+}
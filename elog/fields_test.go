@@ -0,0 +1,155 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elog
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+)
+
+type testFieldEvent struct {
+	node    StringRef `elog:"node"`
+	vectors uint32    `elog:"vectors"`
+	delta   int16
+	rate    float32 `elog:"rate"`
+	input   bool    `elog:"input"`
+	skip    uint32  `elog:"-"`
+}
+
+func (e *testFieldEvent) Elog(l *Log) { l.Logf("test %v %d", e.node, e.vectors) }
+
+type testPointerFieldEvent struct {
+	name  string `elog:"name"`
+	ptr   *int
+	list  []uint32
+	inner struct {
+		s string
+		n uint32
+	}
+	count uint32  `elog:"count"`
+	tag   [4]byte `elog:"tag"`
+}
+
+func (e *testPointerFieldEvent) Elog(l *Log) { l.Logf("test %d", e.count) }
+
+func TestFieldPointersOmitted(t *testing.T) {
+	et := RegisterType(&testPointerFieldEvent{})
+	want := []Field{{"count", FieldUint}, {"tag", FieldString}}
+	if len(et.Fields) != len(want) || et.Fields[0] != want[0] || et.Fields[1] != want[1] {
+		t.Fatalf("fields %v", et.Fields)
+	}
+
+	if !Enabled() {
+		t.Skip("event log disabled; build with -tags elog")
+	}
+	Enable(true)
+	Clear()
+	e := testPointerFieldEvent{count: 7, tag: [4]byte{'a', 'b'}}
+	Add(&e)
+	_, vs := NewView().EventFields(0)
+	if len(vs) != 2 || vs[0] != uint64(7) || vs[1] != "ab" {
+		t.Fatalf("values %v", vs)
+	}
+}
+
+func TestFieldFilter(t *testing.T) {
+	et := RegisterType(&testFieldEvent{})
+	want := []Field{{"node", FieldString}, {"vectors", FieldUint}, {"delta", FieldInt}, {"rate", FieldFloat}, {"input", FieldBool}}
+	if len(et.Fields) != len(want) {
+		t.Fatalf("fields %v", et.Fields)
+	}
+	for i := range want {
+		if et.Fields[i] != want[i] {
+			t.Fatalf("field %d: %v != %v", i, et.Fields[i], want[i])
+		}
+	}
+	for _, s := range []string{"", "a ==", "a <", "(a == 1", "a == 1 b", "a =~ \"(\""} {
+		if _, err := ParseFieldFilter(s); err == nil {
+			t.Fatalf("%q: expected error", s)
+		}
+	}
+
+	if !Enabled() {
+		t.Skip("event log disabled; build with -tags elog")
+	}
+	Enable(true)
+	Clear()
+	nodes := [2]StringRef{SetString("fe1-rx"), SetString("fe1-tx")}
+	for i := 0; i < 100; i++ {
+		e := testFieldEvent{node: nodes[i%2], vectors: uint32(4 * i), delta: int16(50 - i), rate: float32(i) / 2, input: i%3 == 0}
+		Add(&e)
+	}
+	v := NewView()
+
+	// Save and restore must preserve fields.
+	var b bytes.Buffer
+	if err := v.Save(&b); err != nil {
+		t.Fatal(err)
+	}
+	var r View
+	if err := r.Restore(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		expr string
+		n    int
+	}{
+		{`node == "fe1-rx" && vectors > 200`, 24},
+		{`node != "fe1-rx" || vectors <= 8`, 52},
+		{`!(node =~ "rx$") && input`, 17},
+		{`delta < 0 && rate >= 40.5`, 19},
+		{`input == true`, 34},
+		{`caller =~ "TestFieldFilter" && track == ""`, 100},
+		{`missing == 1`, 0},
+	}
+	for _, x := range []*View{v, &r} {
+		if x.NumEvents() != 100 {
+			t.Fatalf("%d events", x.NumEvents())
+		}
+		for _, c := range cases {
+			es, err := x.EventsWhere(c.expr, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(es) != c.n {
+				t.Errorf("%s: %d matches, expected %d", c.expr, len(es), c.n)
+			}
+		}
+	}
+
+	es, _ := r.EventsWhere(`vectors >= 392`, nil)
+	b.Reset()
+	if err := r.WriteCSV(&b, es); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0][4] != "node" || rows[2][4] != "fe1-tx" || rows[2][5] != "396" || rows[2][7] != "49.5" {
+		t.Fatalf("csv %v", rows)
+	}
+
+	b.Reset()
+	if err := r.WriteJSON(&b, es); err != nil {
+		t.Fatal(err)
+	}
+	var objs []map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &objs); err != nil {
+		t.Fatalf("%v\n%s", err, b.String())
+	}
+	if len(objs) != 2 || objs[1]["vectors"] != float64(396) || objs[1]["input"] != true {
+		t.Fatalf("json %v", objs)
+	}
+
+	b.Reset()
+	r.WriteTable(&b, es)
+	if n := bytes.Count(b.Bytes(), []byte("\n")); n != 3 {
+		t.Fatalf("table %d lines:\n%s", n, b.String())
+	}
+}
@@ -0,0 +1,316 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elog
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Field filter expressions select events by structured field values, for example:
+//	node == "fe1-rx" && vectors > 200
+//	!(kind =~ "^suspend") || caller =~ "loop"
+// Operators are == != < <= > >= =~ (regexp match) && || ! and parentheses.
+// Operands are field names, numbers, quoted strings, true and false; a field name by
+// itself is true when the field's value is non-zero or non-empty.
+// Besides event fields, names caller, track, host (for merged views) and time (seconds since
+// view start) are defined for all events.  Comparisons involving a field which is not present are false.
+
+type filterToken struct {
+	kind byte // 'i' identifier, 's' string, 'n' number, 'o' operator
+	s    string
+}
+
+type filterLexer struct {
+	s   string
+	tok filterToken
+	err error
+}
+
+var errFilterSyntax = errors.New("filter syntax error")
+
+func (l *filterLexer) next() {
+	l.s = strings.TrimLeftFunc(l.s, unicode.IsSpace)
+	l.tok = filterToken{}
+	if l.s == "" {
+		return
+	}
+	c := l.s[0]
+	n := 1
+	switch {
+	case c == '"':
+		q, err := strconv.QuotedPrefix(l.s)
+		if err != nil {
+			l.err = fmt.Errorf("bad string: %s", l.s)
+			return
+		}
+		l.tok.kind, n = 's', len(q)
+		l.tok.s, _ = strconv.Unquote(q)
+	case c == '_' || unicode.IsLetter(rune(c)):
+		for n < len(l.s) && (l.s[n] == '_' || l.s[n] == '.' || unicode.IsLetter(rune(l.s[n])) || unicode.IsDigit(rune(l.s[n]))) {
+			n++
+		}
+		l.tok = filterToken{kind: 'i', s: l.s[:n]}
+	case c == '-' || c == '.' || unicode.IsDigit(rune(c)):
+		for n < len(l.s) && strings.IndexByte("0123456789abcdefABCDEFxX.+-", l.s[n]) >= 0 &&
+			!((l.s[n] == '-' || l.s[n] == '+') && l.s[n-1] != 'e' && l.s[n-1] != 'E') {
+			n++
+		}
+		l.tok = filterToken{kind: 'n', s: l.s[:n]}
+	default:
+		for _, op := range []string{"==", "!=", "<=", ">=", "=~", "&&", "||", "<", ">", "!", "(", ")"} {
+			if strings.HasPrefix(l.s, op) {
+				l.tok = filterToken{kind: 'o', s: op}
+				n = len(op)
+				break
+			}
+		}
+		if l.tok.kind == 0 {
+			l.err = fmt.Errorf("unexpected %q", l.s)
+			return
+		}
+	}
+	l.s = l.s[n:]
+}
+
+func (l *filterLexer) isOp(op string) bool { return l.tok.kind == 'o' && l.tok.s == op }
+
+// Values of fields for one event.
+type filterEnv func(name string) (interface{}, bool)
+
+type filterExpr interface {
+	eval(env filterEnv) bool
+}
+
+type filterAnd struct{ a, b filterExpr }
+type filterOr struct{ a, b filterExpr }
+type filterNot struct{ a filterExpr }
+
+func (x *filterAnd) eval(env filterEnv) bool { return x.a.eval(env) && x.b.eval(env) }
+func (x *filterOr) eval(env filterEnv) bool  { return x.a.eval(env) || x.b.eval(env) }
+func (x *filterNot) eval(env filterEnv) bool { return !x.a.eval(env) }
+
+type filterCompare struct {
+	field string
+	// Comparison operator or empty for truth test of field.
+	op string
+	// Literal as string, number (if valid) and regexp for =~.
+	s     string
+	f     float64
+	isNum bool
+	re    *regexp.Regexp
+}
+
+func filterNumber(x interface{}) (f float64, ok bool) {
+	ok = true
+	switch v := x.(type) {
+	case int64:
+		f = float64(v)
+	case uint64:
+		f = float64(v)
+	case float64:
+		f = v
+	case bool:
+		if v {
+			f = 1
+		}
+	default:
+		ok = false
+	}
+	return
+}
+
+func (x *filterCompare) eval(env filterEnv) bool {
+	v, ok := env(x.field)
+	if !ok {
+		return false
+	}
+	if x.re != nil {
+		return x.re.MatchString(fmt.Sprint(v))
+	}
+	if x.op == "" {
+		if f, ok := filterNumber(v); ok {
+			return f != 0
+		}
+		return fmt.Sprint(v) != ""
+	}
+	var c int
+	if f, ok := filterNumber(v); ok && x.isNum {
+		switch {
+		case f < x.f:
+			c = -1
+		case f > x.f:
+			c = 1
+		}
+	} else {
+		c = strings.Compare(fmt.Sprint(v), x.s)
+	}
+	switch x.op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+func (l *filterLexer) parseOr() (x filterExpr) {
+	x = l.parseAnd()
+	for l.err == nil && l.isOp("||") {
+		l.next()
+		x = &filterOr{a: x, b: l.parseAnd()}
+	}
+	return
+}
+
+func (l *filterLexer) parseAnd() (x filterExpr) {
+	x = l.parseUnary()
+	for l.err == nil && l.isOp("&&") {
+		l.next()
+		x = &filterAnd{a: x, b: l.parseUnary()}
+	}
+	return
+}
+
+func (l *filterLexer) parseUnary() (x filterExpr) {
+	if l.err != nil {
+		return
+	}
+	switch {
+	case l.isOp("!"):
+		l.next()
+		return &filterNot{a: l.parseUnary()}
+	case l.isOp("("):
+		l.next()
+		x = l.parseOr()
+		if l.err == nil && !l.isOp(")") {
+			l.err = errors.New("missing )")
+		}
+		l.next()
+		return
+	case l.tok.kind == 'i':
+		c := &filterCompare{field: l.tok.s}
+		l.next()
+		if l.tok.kind != 'o' || strings.IndexByte("=!<>", l.tok.s[0]) < 0 || l.tok.s == "!" {
+			// Bare field name: true when field is non-zero or non-empty.
+			return c
+		}
+		c.op = l.tok.s
+		l.next()
+		switch l.tok.kind {
+		case 's', 'i':
+			c.s = l.tok.s
+			switch c.s {
+			case "true":
+				c.f, c.isNum = 1, l.tok.kind == 'i'
+			case "false":
+				c.isNum = l.tok.kind == 'i'
+			}
+		case 'n':
+			c.s = l.tok.s
+			if i, err := strconv.ParseInt(c.s, 0, 64); err == nil {
+				c.f = float64(i)
+			} else if f, err := strconv.ParseFloat(c.s, 64); err == nil {
+				c.f = f
+			} else {
+				l.err = fmt.Errorf("bad number %s", c.s)
+				return
+			}
+			c.isNum = true
+		default:
+			l.err = fmt.Errorf("expected value after %s %s", c.field, c.op)
+			return
+		}
+		if c.op == "=~" {
+			if c.re, l.err = regexp.Compile(c.s); l.err != nil {
+				return
+			}
+		}
+		l.next()
+		return c
+	}
+	l.err = errFilterSyntax
+	return
+}
+
+// FieldFilter is a compiled field filter expression.
+type FieldFilter struct {
+	expr filterExpr
+}
+
+// ParseFieldFilter compiles given filter expression.
+func ParseFieldFilter(s string) (f *FieldFilter, err error) {
+	l := &filterLexer{s: s}
+	l.next()
+	x := l.parseOr()
+	if l.err == nil && l.tok.kind != 0 {
+		l.err = fmt.Errorf("unexpected %q", l.tok.s)
+	}
+	if err = l.err; err != nil {
+		err = fmt.Errorf("filter %q: %v", s, err)
+		return
+	}
+	f = &FieldFilter{expr: x}
+	return
+}
+
+// Field value for event including implicit caller, track, host and time fields.
+func (v *View) eventField(i uint, fields []Field, values []interface{}, name string) (x interface{}, ok bool) {
+	for j := range fields {
+		if fields[j].Name == name {
+			return values[j], true
+		}
+	}
+	switch name {
+	case "caller":
+		return v.EventCaller(i).Name, true
+	case "track":
+		return v.TrackName(uint(v.Event(i).trackIndex)), true
+	case "host":
+		return v.EventHost(i), true
+	case "time":
+		return v.ElapsedTime(v.Event(i)), true
+	}
+	return
+}
+
+// Match returns whether event with given index in view matches filter.
+func (f *FieldFilter) Match(v *View, i uint) bool {
+	fields, values := v.EventFields(i)
+	return f.expr.eval(func(name string) (interface{}, bool) {
+		return v.eventField(i, fields, values, name)
+	})
+}
+
+// EventsWhere returns indices of events in view matching given field filter expression.
+func (v *View) EventsWhere(expr string, events0 []uint) (events []uint, err error) {
+	// Non-nil even when empty since nil means all events for export.
+	events = events0[:0]
+	if events == nil {
+		events = []uint{}
+	}
+	var f *FieldFilter
+	if f, err = ParseFieldFilter(expr); err != nil {
+		return
+	}
+	for i := uint(0); i < v.NumEvents(); i++ {
+		if f.Match(v, i) {
+			events = append(events, i)
+		}
+	}
+	return
+}
@@ -197,13 +197,16 @@ func fmtEncode(s *shared, b *elib.ByteVec, i0 uint, doArgs bool, e *fmtEvent, r
 	return
 }
 
-func (e *fmtEvent) encode(s *shared, doArgs bool, r StringRef, format string, args []interface{}) (f StringRef, i uint) {
+// Encode format and args into e.  Format string reference cached in *r is read and
+// updated with lock held since callers share it across goroutines.
+func (e *fmtEvent) encode(s *shared, doArgs bool, r *StringRef, format string, args []interface{}) (i uint) {
 	s.fmtMu.Lock()
 	defer s.fmtMu.Unlock()
 	if s.fmtBuffer != nil {
 		s.fmtBuffer = s.fmtBuffer[:0]
 	}
-	return fmtEncode(s, &s.fmtBuffer, 0, doArgs, e, r, format, args)
+	*r, i = fmtEncode(s, &s.fmtBuffer, 0, doArgs, e, *r, format, args)
+	return
 }
 
 func (s *shared) decodeArg(b []byte, i0 int) (a interface{}, kind byte, i int) {
@@ -282,14 +285,14 @@ func (b *Buffer) fmt(c Caller, t uint, format string, args []interface{}) {
 		return
 	}
 	if r, disabled := b.getCaller(nil, c); !disabled {
-		f := &r.fe
-		r.fmtIndex, _ = f.encode(&b.shared, true, r.fmtIndex, format, args)
-		b.add1(f, c, t, r)
+		var f fmtEvent
+		f.encode(&b.shared, true, &r.fmtIndex, format, args)
+		b.add1(&f, c, t, r)
 	}
 }
 
 func (b *Buffer) F(format string, args ...interface{}) {
-	c := b.GetCaller(PointerToFirstArg(&format))
+	c := b.GetCaller(PointerToFirstArg(&b))
 	b.fmt(c, 0, format, args)
 }
 func (b *Buffer) Fc(format string, c Caller, args ...interface{}) {
@@ -334,12 +337,11 @@ func (b *Buffer) Fc1b(format string, c Caller, v bool) {
 		return
 	}
 	if r, disabled := b.getCaller(nil, c); !disabled {
-		f := &r.fe
-		var i uint
-		r.fmtIndex, i = f.encode(&b.shared, false, r.fmtIndex, format, nil)
+		var f fmtEvent
+		i := f.encode(&b.shared, false, &r.fmtIndex, format, nil)
 		i = encodeBoolb(f.b[:], i, v)
 		f.b[i] = fmtEnd
-		b.add1(f, c, 0, r)
+		b.add1(&f, c, 0, r)
 	}
 }
 func F1b(f string, v bool) {
@@ -350,7 +352,7 @@ func F1b(f string, v bool) {
 func Fc1b(f string, c Caller, v bool) { DefaultBuffer.Fc1b(f, c, v) }
 
 func (b *Buffer) F1u(format string, v uint64) {
-	c := b.GetCaller(PointerToFirstArg(&format))
+	c := b.GetCaller(PointerToFirstArg(&b))
 	b.Fc1u(format, c, v)
 }
 func (b *Buffer) Fc1u(format string, c Caller, v uint64) {
@@ -361,12 +363,11 @@ func (b *Buffer) Fc1u(format string, c Caller, v uint64) {
 		return
 	}
 	if r, disabled := b.getCaller(nil, c); !disabled {
-		f := &r.fe
-		var i uint
-		r.fmtIndex, i = f.encode(&b.shared, false, r.fmtIndex, format, nil)
+		var f fmtEvent
+		i := f.encode(&b.shared, false, &r.fmtIndex, format, nil)
 		i = encodeUintb(f.b[:], i, v, fmtUint)
 		f.b[i] = fmtEnd
-		b.add1(f, c, 0, r)
+		b.add1(&f, c, 0, r)
 	}
 }
 func F1u(f string, v uint64) {
@@ -377,7 +378,7 @@ func F1u(f string, v uint64) {
 func Fc1u(f string, c Caller, v uint64) { DefaultBuffer.Fc1u(f, c, v) }
 
 func (b *Buffer) F2u(format string, v0, v1 uint64) {
-	c := b.GetCaller(PointerToFirstArg(&format))
+	c := b.GetCaller(PointerToFirstArg(&b))
 	b.Fc2u(format, c, v0, v1)
 }
 func (b *Buffer) Fc2u(format string, c Caller, v0, v1 uint64) {
@@ -388,13 +389,12 @@ func (b *Buffer) Fc2u(format string, c Caller, v0, v1 uint64) {
 		return
 	}
 	if r, disabled := b.getCaller(nil, c); !disabled {
-		f := &r.fe
-		var i uint
-		r.fmtIndex, i = f.encode(&b.shared, false, r.fmtIndex, format, nil)
+		var f fmtEvent
+		i := f.encode(&b.shared, false, &r.fmtIndex, format, nil)
 		i = encodeUintb(f.b[:], i, v0, fmtUint)
 		i = encodeUintb(f.b[:], i, v1, fmtUint)
 		f.b[i] = fmtEnd
-		b.add1(f, c, 0, r)
+		b.add1(&f, c, 0, r)
 	}
 }
 func F2u(f string, v0, v1 uint64) {
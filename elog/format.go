@@ -0,0 +1,357 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elog
+
+import (
+	"github.com/platinasystems/elib"
+
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// Event log file format:
+//
+//	magic (8 bytes) version (uvarint)
+//	sections: id, flags, length (uvarints) then length bytes of data and
+//	  crc32 (IEEE, big endian) of uncompressed data
+//	end section: id 0
+//
+// Readers skip sections with unknown ids so that sections may be added without breaking
+// older readers; version changes only for incompatible changes to existing sections.
+// Data without magic is in legacy format (bare varint stream).
+
+const (
+	fileMagic   = "\x89ELOG\r\n\n"
+	fileVersion = 2
+)
+
+const (
+	sectionEnd = iota
+	// Name, host, cpu frequency and start times.
+	sectionHeader
+	sectionStrings
+	sectionCallers
+	// Track names and hosts.
+	sectionTracks
+	// Event times, callers, tracks and offsets of event data.
+	sectionEvents
+	// Encoded formats and arguments.
+	sectionEventData
+	nSection
+)
+
+var sectionNames = [...]string{
+	sectionEnd:       "end",
+	sectionHeader:    "header",
+	sectionStrings:   "strings",
+	sectionCallers:   "callers",
+	sectionTracks:    "tracks",
+	sectionEvents:    "events",
+	sectionEventData: "event data",
+}
+
+func sectionName(id uint64) string {
+	if id < nSection {
+		return sectionNames[id]
+	}
+	return fmt.Sprintf("section %d", id)
+}
+
+// Section flags.
+const (
+	// Data is compressed with deflate.
+	sectionFlate = 1 << iota
+)
+
+// Sections smaller than this are not worth compressing.
+const minCompressLen = 256
+
+// Compressed sections may inflate to at most this times file length so that corrupt or
+// hostile files cannot exhaust memory.
+const maxInflateRatio = 256
+
+var (
+	ErrFileVersion = errors.New("unsupported event log file version")
+	ErrTruncated   = errors.New("truncated")
+	ErrChecksum    = errors.New("checksum mismatch")
+	ErrMissing     = errors.New("missing")
+	ErrTooLarge    = errors.New("decompressed data too large")
+)
+
+// FormatError describes an error decoding a section of an event log file.
+type FormatError struct {
+	Section string
+	Err     error
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("event log %s section: %v", e.Section, e.Err)
+}
+func (e *FormatError) Unwrap() error { return e.Err }
+
+func isFramed(b []byte) bool { return bytes.HasPrefix(b, []byte(fileMagic)) }
+
+func appendSection(b []byte, id uint64, d []byte, compress bool) []byte {
+	sum := crc32.ChecksumIEEE(d)
+	flags := uint64(0)
+	if compress && len(d) >= minCompressLen {
+		var c bytes.Buffer
+		w, _ := flate.NewWriter(&c, flate.DefaultCompression)
+		w.Write(d)
+		w.Close()
+		if c.Len() < len(d) {
+			d = c.Bytes()
+			flags |= sectionFlate
+		}
+	}
+	b = binary.AppendUvarint(b, id)
+	b = binary.AppendUvarint(b, flags)
+	b = binary.AppendUvarint(b, uint64(len(d)))
+	b = append(b, d...)
+	return binary.BigEndian.AppendUint32(b, sum)
+}
+
+func (v *View) MarshalBinary() ([]byte, error) {
+	v.convertBufferEvents()
+	b := binary.AppendUvarint([]byte(fileMagic), fileVersion)
+
+	var (
+		d elib.ByteVec
+		i int
+	)
+	section := func(id uint64) {
+		b = appendSection(b, id, d[:i], v.compress)
+		i = 0
+	}
+
+	// Header
+	d, i = encodeString(d, i, v.name)
+	d, i = encodeString(d, i, v.host)
+	d.Validate(uint(i + 8 + binary.MaxVarintLen64))
+	binary.BigEndian.PutUint64(d[i:], math.Float64bits(1e9/v.cpuTimeUnitNsec))
+	i += 8
+	i += binary.PutUvarint(d[i:], v.cpuStartTime)
+	t, err := v.StartTime.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	d, i = encodeString(d, i, string(t))
+	section(sectionHeader)
+
+	d, i = encodeString(d, i, string(v.stringTable.strings))
+	section(sectionStrings)
+
+	d.Validate(uint(i + binary.MaxVarintLen64))
+	i += binary.PutUvarint(d[i:], uint64(len(v.callers)))
+	for _, r := range v.callers {
+		_, c := v.getCallerInfo(r.callerIndex)
+		d, i = c.encode(d, i)
+	}
+	section(sectionCallers)
+
+	d.Validate(uint(i + binary.MaxVarintLen64))
+	i += binary.PutUvarint(d[i:], uint64(len(v.tracks)))
+	for _, t := range v.tracks {
+		d, i = encodeString(d, i, t.Name)
+		d, i = encodeString(d, i, t.Host)
+	}
+	section(sectionTracks)
+
+	d.Validate(uint(i + binary.MaxVarintLen64))
+	i += binary.PutUvarint(d[i:], uint64(len(v.allViewEvents)))
+	tm := v.cpuStartTime
+	for ei := range v.allViewEvents {
+		d, tm, i = v.allViewEvents[ei].encode(d, tm, i)
+	}
+	section(sectionEvents)
+
+	b = appendSection(b, sectionEventData, v.viewEvents.b, v.compress)
+
+	b = binary.AppendUvarint(b, sectionEnd)
+	return b, nil
+}
+
+// UnmarshalBinary decodes view in current or legacy format.
+func (v *View) UnmarshalBinary(b []byte) (err error) {
+	if !isFramed(b) {
+		return v.unmarshalLegacy(b)
+	}
+	var sections [nSection][]byte
+	if sections, err = readSections(b); err != nil {
+		return
+	}
+	for id := uint64(sectionHeader); id < nSection; id++ {
+		if sections[id] == nil {
+			return &FormatError{Section: sectionName(id), Err: ErrMissing}
+		}
+		if err = v.decodeSection(id, sections[id]); err == errUnderflow {
+			err = ErrTruncated
+		}
+		if err != nil {
+			return &FormatError{Section: sectionName(id), Err: err}
+		}
+	}
+	v.currentViewEvents = v.allViewEvents
+	v.getViewTimes()
+	return
+}
+
+// Check and decompress sections; unknown sections are skipped.
+func readSections(b []byte) (sections [nSection][]byte, err error) {
+	i := len(fileMagic)
+	version, n := binary.Uvarint(b[i:])
+	if n <= 0 {
+		return sections, &FormatError{Section: "version", Err: ErrTruncated}
+	}
+	if version > fileVersion {
+		return sections, ErrFileVersion
+	}
+	i += n
+	var id uint64
+	truncated := func() error { return &FormatError{Section: sectionName(id), Err: ErrTruncated} }
+	for {
+		// Data ending between sections is missing end section.
+		id = sectionEnd
+		var x [3]uint64
+		for k := range x {
+			if x[k], n = binary.Uvarint(b[i:]); n <= 0 {
+				return sections, truncated()
+			}
+			i += n
+			if k == 0 {
+				if id = x[0]; id == sectionEnd {
+					return
+				}
+			}
+		}
+		flags, l := x[1], x[2]
+		if l > uint64(len(b)-i) || len(b)-i-int(l) < 4 {
+			return sections, truncated()
+		}
+		d := b[i : i+int(l)]
+		i += int(l)
+		sum := binary.BigEndian.Uint32(b[i:])
+		i += 4
+		if id >= nSection {
+			continue
+		}
+		if flags&sectionFlate != 0 {
+			max := int64(len(b)) * maxInflateRatio
+			if d, err = io.ReadAll(io.LimitReader(flate.NewReader(bytes.NewReader(d)), max+1)); err != nil {
+				return sections, &FormatError{Section: sectionName(id), Err: err}
+			}
+			if int64(len(d)) > max {
+				return sections, &FormatError{Section: sectionName(id), Err: ErrTooLarge}
+			}
+		}
+		if crc32.ChecksumIEEE(d) != sum {
+			return sections, &FormatError{Section: sectionName(id), Err: ErrChecksum}
+		}
+		// Non-nil even when empty to mark section present.
+		sections[id] = append([]byte{}, d...)
+	}
+}
+
+func (v *View) decodeSection(id uint64, b elib.ByteVec) (err error) {
+	i := 0
+	switch id {
+	case sectionHeader:
+		if v.name, i, err = decodeString(b, i, 0); err != nil {
+			return
+		}
+		if v.host, i, err = decodeString(b, i, 0); err != nil {
+			return
+		}
+		if i+8 > len(b) {
+			return errUnderflow
+		}
+		v.cpuTimeUnitNsec = 1e9 / math.Float64frombits(binary.BigEndian.Uint64(b[i:]))
+		i += 8
+		x, n := binary.Uvarint(b[i:])
+		if n <= 0 {
+			return errUnderflow
+		}
+		v.cpuStartTime = x
+		i += n
+		var t string
+		if t, i, err = decodeString(b, i, 0); err != nil {
+			return
+		}
+		err = v.StartTime.UnmarshalBinary([]byte(t))
+
+	case sectionStrings:
+		var s string
+		if s, i, err = decodeString(b, i, 0); err != nil {
+			return
+		}
+		v.stringTable.init(s)
+
+	case sectionCallers:
+		x, n := binary.Uvarint(b[i:])
+		if n <= 0 {
+			return errUnderflow
+		}
+		i += n
+		for j := uint64(0); j < x; j++ {
+			var c CallerInfo
+			if i, err = c.decode(b, i); err != nil {
+				return
+			}
+			v.addCallerInfo(c)
+		}
+
+	case sectionTracks:
+		x, n := binary.Uvarint(b[i:])
+		if n <= 0 {
+			return errUnderflow
+		}
+		i += n
+		for j := uint64(0); j < x; j++ {
+			var name, host string
+			if name, i, err = decodeString(b, i, 0); err != nil {
+				return
+			}
+			if host, i, err = decodeString(b, i, 0); err != nil {
+				return
+			}
+			v.addHostTrack(host, name)
+		}
+
+	case sectionEvents:
+		x, n := binary.Uvarint(b[i:])
+		if n <= 0 || x > uint64(len(b)) {
+			return errUnderflow
+		}
+		i += n
+		v.allViewEvents = make([]viewEvent, x)
+		t := v.cpuStartTime
+		for ei := range v.allViewEvents {
+			e := &v.allViewEvents[ei]
+			if t, i, err = e.decode(b, t, i); err != nil {
+				return
+			}
+			if int(e.callerIndex) >= len(v.callers) {
+				return fmt.Errorf("event %d: caller index %d out of range", ei, e.callerIndex)
+			}
+		}
+
+	case sectionEventData:
+		v.viewEvents.b = b
+		// Event data offsets must be within section.
+		for ei := range v.allViewEvents {
+			e := &v.allViewEvents[ei]
+			if e.lo > e.hi || int(e.hi) > len(b) {
+				return errUnderflow
+			}
+		}
+	}
+	return
+}
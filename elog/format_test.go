@@ -0,0 +1,148 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func formatTestView(t *testing.T) *View {
+	if !Enabled() {
+		t.Skip("event log disabled; build with -tags elog")
+	}
+	b := New(10)
+	b.Enable(true)
+	for i := uint64(0); i < 300; i++ {
+		b.F2u("format event %d of %d", i, 300)
+	}
+	v := b.NewView()
+	v.SetName("test")
+	v.SetHost("host0")
+	return v
+}
+
+func checkSameEvents(t *testing.T, a, b *View) {
+	if a.NumEvents() != b.NumEvents() {
+		t.Fatalf("%d events, expected %d", b.NumEvents(), a.NumEvents())
+	}
+	for i := uint(0); i < a.NumEvents(); i++ {
+		ea, eb := a.Event(i), b.Event(i)
+		if !reflect.DeepEqual(a.EventLines(i), b.EventLines(i)) || a.ElapsedTime(ea) != b.ElapsedTime(eb) {
+			t.Fatalf("event %d: %q at %g, expected %q at %g", i, b.EventLines(i), b.ElapsedTime(eb),
+				a.EventLines(i), a.ElapsedTime(ea))
+		}
+	}
+}
+
+// Saves view in legacy format as older versions did.
+type legacyView struct{ v *View }
+
+func (l legacyView) MarshalBinary() ([]byte, error) { return l.v.marshalLegacy() }
+
+func TestFileFormat(t *testing.T) {
+	v := formatTestView(t)
+	plain, err := v.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.SetCompress(true)
+	compressed, err := v.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compressed) >= len(plain) {
+		t.Fatalf("compressed %d bytes, uncompressed %d", len(compressed), len(plain))
+	}
+	for _, d := range [][]byte{plain, compressed} {
+		var w View
+		if err = w.UnmarshalBinary(d); err != nil {
+			t.Fatal(err)
+		}
+		checkSameEvents(t, v, &w)
+		if w.Name() != "test" || w.Host() != "host0" {
+			t.Fatalf("name %q host %q", w.Name(), w.Host())
+		}
+	}
+
+	// Legacy bare and gob encoded formats.
+	legacy, err := v.marshalLegacy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var w View
+	if err = w.UnmarshalBinary(legacy); err != nil {
+		t.Fatal(err)
+	}
+	checkSameEvents(t, v, &w)
+	var g bytes.Buffer
+	if err = gob.NewEncoder(&g).Encode(legacyView{v}); err != nil {
+		t.Fatal(err)
+	}
+	w = View{}
+	if err = w.Restore(&g); err != nil {
+		t.Fatal(err)
+	}
+	checkSameEvents(t, v, &w)
+
+	// Save and restore.
+	g.Reset()
+	if err = v.Save(&g); err != nil {
+		t.Fatal(err)
+	}
+	w = View{}
+	if err = w.Restore(&g); err != nil {
+		t.Fatal(err)
+	}
+	checkSameEvents(t, v, &w)
+}
+
+func TestFileFormatErrors(t *testing.T) {
+	v := formatTestView(t)
+	d, err := v.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for l := len(fileMagic); l < len(d); l++ {
+		var w View
+		if err = w.UnmarshalBinary(d[:l]); !errors.Is(err, ErrTruncated) {
+			t.Fatalf("truncated at %d: %v", l, err)
+		}
+	}
+
+	// Corrupt last byte of event data.
+	c := append([]byte(nil), d...)
+	c[len(c)-6] ^= 1
+	var w View
+	if err = w.UnmarshalBinary(c); !errors.Is(err, ErrChecksum) {
+		t.Fatalf("corrupt: %v", err)
+	}
+
+	// Unknown sections are skipped.
+	c = appendSection(d[:len(d)-1:len(d)-1], 99, []byte("from the future"), false)
+	c = binary.AppendUvarint(c, sectionEnd)
+	w = View{}
+	if err = w.UnmarshalBinary(c); err != nil {
+		t.Fatal(err)
+	}
+	checkSameEvents(t, v, &w)
+
+	// Sections may not inflate without bound.
+	c = appendSection(d[:len(d)-1:len(d)-1], sectionHeader, make([]byte, 16<<20), true)
+	c = binary.AppendUvarint(c, sectionEnd)
+	if err = w.UnmarshalBinary(c); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("inflate: %v", err)
+	}
+
+	c = binary.AppendUvarint([]byte(fileMagic), fileVersion+1)
+	if err = w.UnmarshalBinary(c); err != ErrFileVersion {
+		t.Fatalf("version: %v", err)
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elog
+
+import (
+	"bufio"
+	"encoding/json"
+	"html"
+	"io"
+	"strings"
+)
+
+// Export of views to a self-contained HTML page with an interactive timeline:
+// one lane per track, mouse wheel zoom and drag to pan, regexp search over event text
+// and caller names, and event details with links to caller source file and line.
+// The page needs no network access; data and script are embedded.
+
+// HTMLOptions configures HTML export.
+type HTMLOptions struct {
+	// Link for caller source: %f is replaced by file name and %l by line number.
+	// Default is file://%f; an editor URL (e.g. vscode://file/%f:%l) can be given instead.
+	SourceURL string
+}
+
+type htmlCaller struct {
+	Name string `json:"name"`
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+type htmlData struct {
+	Name      string       `json:"name"`
+	Start     string       `json:"start"`
+	SourceURL string       `json:"sourceURL"`
+	Tracks    []string     `json:"tracks"`
+	Callers   []htmlCaller `json:"callers"`
+	// Each event is [seconds since start, track, caller, text].
+	Events [][4]interface{} `json:"events"`
+}
+
+func (v *View) htmlData(o *HTMLOptions) (d *htmlData) {
+	d = &htmlData{
+		Name:      v.traceProcessName(),
+		Start:     v.Times.StartTime.Format("2006-01-02 15:04:05.000000000 MST"),
+		SourceURL: "file://%f",
+	}
+	if o != nil && o.SourceURL != "" {
+		d.SourceURL = o.SourceURL
+	}
+	for t := uint(0); t < v.NumTracks(); t++ {
+		d.Tracks = append(d.Tracks, v.traceThreadName(t))
+	}
+	callers := make(map[uint32]int)
+	d.Events = make([][4]interface{}, 0, v.NumEvents())
+	for i := uint(0); i < v.NumEvents(); i++ {
+		e := v.Event(i)
+		ci, ok := callers[e.callerIndex]
+		if !ok {
+			c := v.EventCaller(i)
+			ci = len(d.Callers)
+			callers[e.callerIndex] = ci
+			d.Callers = append(d.Callers, htmlCaller{Name: c.Name, File: c.File, Line: c.Line})
+		}
+		d.Events = append(d.Events, [4]interface{}{
+			v.ElapsedTime(e), e.trackIndex, ci, strings.Join(v.EventLines(i), "\n"),
+		})
+	}
+	return
+}
+
+// WriteHTML writes current events of view as self-contained HTML page.
+// Use SubView beforehand to export a time range.
+func (v *View) WriteHTML(w io.Writer, o *HTMLOptions) (err error) {
+	bw := bufio.NewWriter(w)
+	var data []byte
+	// Marshal escapes <, > and & so data is safe within script element.
+	if data, err = json.Marshal(v.htmlData(o)); err != nil {
+		return
+	}
+	title := html.EscapeString(v.traceProcessName())
+	io.WriteString(bw, strings.Replace(htmlHead, "{{title}}", title, 1))
+	io.WriteString(bw, "<script>const elogData = ")
+	bw.Write(data)
+	io.WriteString(bw, ";</script>\n<script>")
+	io.WriteString(bw, htmlScript)
+	io.WriteString(bw, "</script>\n</body>\n</html>\n")
+	return bw.Flush()
+}
+
+func (v *View) SaveHTMLFile(file string, o *HTMLOptions) error {
+	return v.writeFile(file, func(w io.Writer) error { return v.WriteHTML(w, o) })
+}
+
+const htmlHead = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{title}}</title>
+<style>
+body { font-family: sans-serif; font-size: 13px; margin: 8px; }
+#bar { display: flex; gap: 8px; align-items: center; margin-bottom: 4px; }
+#search { width: 30em; font-family: monospace; }
+#search.bad { background: #fdd; }
+#timeline { width: 100%; height: 400px; border: 1px solid #ccc; cursor: crosshair; display: block; }
+#panes { display: flex; gap: 8px; margin-top: 6px; }
+#detail { flex: 1; white-space: pre-wrap; font-family: monospace; border: 1px solid #ccc; padding: 4px; min-height: 8em; }
+#matches { flex: 1; max-height: 20em; overflow: auto; border: 1px solid #ccc; font-family: monospace; }
+#matches div { cursor: pointer; white-space: nowrap; padding: 0 4px; }
+#matches div:hover { background: #eef; }
+</style>
+</head>
+<body>
+<div id="bar">
+<b id="title"></b>
+<input id="search" placeholder="search regexp (event text or caller)">
+<span id="status"></span>
+<button id="reset">reset zoom</button>
+</div>
+<canvas id="timeline"></canvas>
+<div id="panes"><div id="detail">click an event for details; wheel zooms, drag pans</div><div id="matches"></div></div>
+`
+
+const htmlScript = `
+(function() {
+const d = elogData;
+const evs = d.events;
+const T = 0, TRACK = 1, CALLER = 2, TEXT = 3;
+const canvas = document.getElementById("timeline");
+const ctx = canvas.getContext("2d");
+const laneH = 22, axisH = 24, labelW = 140;
+let tMin = evs.length ? evs[0][T] : 0, tMax = evs.length ? evs[evs.length - 1][T] : 1;
+if (tMax <= tMin) tMax = tMin + 1e-6;
+const full = [tMin, tMax];
+let selected = -1, matched = null;
+
+// Lanes only for tracks with events.
+const laneOf = new Map();
+for (const e of evs) if (!laneOf.has(e[TRACK])) laneOf.set(e[TRACK], 0);
+[...laneOf.keys()].sort((a, b) => a - b).forEach((t, i) => laneOf.set(t, i));
+
+document.getElementById("title").textContent = d.name + " " + d.start;
+
+function fmtTime(s) {
+	const a = Math.abs(s);
+	if (a >= 1) return s.toFixed(6) + "s";
+	if (a >= 1e-3) return (s * 1e3).toFixed(3) + "ms";
+	if (a >= 1e-6) return (s * 1e6).toFixed(3) + "us";
+	return (s * 1e9).toFixed(0) + "ns";
+}
+function x(t) { return labelW + (t - tMin) / (tMax - tMin) * (canvas.width - labelW); }
+function tOf(px) { return tMin + (px - labelW) / (canvas.width - labelW) * (tMax - tMin); }
+// Index of first event with time >= t.
+function lower(t) {
+	let lo = 0, hi = evs.length;
+	while (lo < hi) { const m = (lo + hi) >> 1; if (evs[m][T] < t) lo = m + 1; else hi = m; }
+	return lo;
+}
+
+function draw() {
+	canvas.width = canvas.clientWidth;
+	canvas.height = Math.max(400, axisH + laneOf.size * laneH + 4);
+	canvas.style.height = canvas.height + "px";
+	ctx.clearRect(0, 0, canvas.width, canvas.height);
+	ctx.font = "11px sans-serif";
+	// Axis.
+	ctx.fillStyle = "#000";
+	const n = 8;
+	for (let i = 0; i <= n; i++) {
+		const t = tMin + i * (tMax - tMin) / n, px = x(t);
+		ctx.fillRect(px, axisH - 6, 1, 6);
+		ctx.fillText(fmtTime(t), Math.min(px + 2, canvas.width - 60), axisH - 10);
+	}
+	// Lanes.
+	for (const [track, lane] of laneOf) {
+		const y = axisH + lane * laneH;
+		ctx.fillStyle = lane % 2 ? "#f4f4f4" : "#fff";
+		ctx.fillRect(0, y, canvas.width, laneH);
+		ctx.fillStyle = "#333";
+		ctx.fillText(d.tracks[track] || "track " + track, 4, y + 15);
+	}
+	// Events; at most one mark per pixel column per lane.
+	const last = new Map();
+	for (let i = lower(tMin); i < evs.length && evs[i][T] <= tMax; i++) {
+		const e = evs[i], px = Math.floor(x(e[T])), lane = laneOf.get(e[TRACK]);
+		const isMatch = matched && matched.has(i);
+		const k = lane * 2 + (isMatch ? 1 : 0);
+		if (last.get(k) === px && i !== selected) continue;
+		last.set(k, px);
+		ctx.fillStyle = i === selected ? "#f00" : isMatch ? "#e80" : "#36c";
+		ctx.fillRect(px, axisH + lane * laneH + 3, i === selected ? 3 : 1, laneH - 6);
+	}
+	document.getElementById("status").textContent =
+		(lower(tMax + 1e-15) - lower(tMin)) + " of " + evs.length + " events, " + fmtTime(tMax - tMin) +
+		(matched ? ", " + matched.size + " matches" : "");
+}
+
+function sourceLink(c) {
+	return d.sourceURL.replace("%f", encodeURI(c.file)).replace("%l", c.line);
+}
+
+function select(i, center) {
+	selected = i;
+	const e = evs[i], c = d.callers[e[CALLER]];
+	const det = document.getElementById("detail");
+	det.textContent = fmtTime(e[T]) + "  " + (d.tracks[e[TRACK]] || "") + "\n" + e[TEXT] + "\n\n" + c.name + "\n";
+	const a = document.createElement("a");
+	a.href = sourceLink(c);
+	a.textContent = c.file + ":" + c.line;
+	det.appendChild(a);
+	if (center && (e[T] < tMin || e[T] > tMax)) {
+		const w = tMax - tMin;
+		tMin = e[T] - w / 2; tMax = e[T] + w / 2;
+	}
+	draw();
+}
+
+canvas.addEventListener("wheel", ev => {
+	ev.preventDefault();
+	const t = tOf(ev.offsetX), f = ev.deltaY > 0 ? 1.25 : 0.8;
+	tMin = t - (t - tMin) * f; tMax = t + (tMax - t) * f;
+	if (tMax - tMin < 1e-9) tMax = tMin + 1e-9;
+	draw();
+}, {passive: false});
+
+let drag = null;
+canvas.addEventListener("mousedown", ev => { drag = {x: ev.offsetX, tMin: tMin, tMax: tMax, moved: false}; });
+window.addEventListener("mouseup", ev => {
+	if (drag && !drag.moved && ev.target === canvas) {
+		// Select nearest event in lane under pointer.
+		const lane = Math.floor((ev.offsetY - axisH) / laneH), t = tOf(ev.offsetX);
+		const tol = 4 * (tMax - tMin) / (canvas.width - labelW);
+		let best = -1, bd = tol;
+		for (let i = lower(t - tol); i < evs.length && evs[i][T] <= t + tol; i++) {
+			const dt = Math.abs(evs[i][T] - t);
+			if (laneOf.get(evs[i][TRACK]) === lane && dt <= bd) { best = i; bd = dt; }
+		}
+		if (best >= 0) select(best, false);
+	}
+	drag = null;
+});
+canvas.addEventListener("mousemove", ev => {
+	if (!drag) return;
+	const dx = ev.offsetX - drag.x;
+	if (Math.abs(dx) > 2) drag.moved = true;
+	const dt = dx / (canvas.width - labelW) * (drag.tMax - drag.tMin);
+	tMin = drag.tMin - dt; tMax = drag.tMax - dt;
+	draw();
+});
+document.getElementById("reset").onclick = () => { [tMin, tMax] = full; draw(); };
+
+const search = document.getElementById("search");
+search.addEventListener("change", () => {
+	const list = document.getElementById("matches");
+	list.textContent = "";
+	matched = null;
+	search.classList.remove("bad");
+	if (search.value !== "") {
+		let re;
+		try { re = new RegExp(search.value); } catch (err) { search.classList.add("bad"); draw(); return; }
+		matched = new Set();
+		evs.forEach((e, i) => {
+			if (re.test(e[TEXT]) || re.test(d.callers[e[CALLER]].name)) matched.add(i);
+		});
+		let n = 0;
+		for (const i of matched) {
+			if (++n > 1000) break;
+			const div = document.createElement("div");
+			div.textContent = fmtTime(evs[i][T]) + " " + evs[i][TEXT].split("\n")[0];
+			div.onclick = () => select(i, true);
+			list.appendChild(div);
+		}
+	}
+	draw();
+});
+window.addEventListener("resize", draw);
+draw();
+})();
+`
@@ -0,0 +1,372 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Appending views: events of one view are re-encoded into another with callers,
+// strings and tracks remapped and timestamps converted to the destination's time base.
+
+type viewRemap struct {
+	src *View
+	// Host for tracks of source events when source is not itself merged.
+	host    string
+	callers []uint32
+	tracks  []uint32
+	strings map[StringRef]StringRef
+}
+
+func (m *viewRemap) caller(v *View, ci uint32) uint32 {
+	for uint32(len(m.callers)) <= ci {
+		m.callers = append(m.callers, ^uint32(0))
+	}
+	if x := m.callers[ci]; x != ^uint32(0) {
+		return x
+	}
+	_, c := m.src.getCallerInfo(ci)
+	if r, ok := v.callerByPC[c.PC]; ok && r.callerInfo.Name == c.Name {
+		m.callers[ci] = r.callerIndex
+	} else {
+		v.addCallerInfo(*c)
+		m.callers[ci] = uint32(len(v.callers) - 1)
+	}
+	return m.callers[ci]
+}
+
+func (m *viewRemap) track(v *View, t uint32) uint32 {
+	for uint32(len(m.tracks)) <= t {
+		m.tracks = append(m.tracks, ^uint32(0))
+	}
+	if m.tracks[t] == ^uint32(0) {
+		if len(v.tracks) == 0 {
+			v.addTrack("")
+		}
+		host := m.src.TrackHost(uint(t))
+		if host == "" {
+			host = m.host
+		}
+		m.tracks[t] = v.addHostTrack(host, m.src.TrackName(uint(t))).index
+	}
+	return m.tracks[t]
+}
+
+func (m *viewRemap) string(v *View, r StringRef) StringRef {
+	x, ok := m.strings[r]
+	if !ok {
+		x = v.SetString(m.src.GetString(r))
+		m.strings[r] = x
+	}
+	return x
+}
+
+// Copy encoded formats and arguments b to end of view buffer remapping string references.
+func (m *viewRemap) data(v *View, b []byte) (lo, hi uint32) {
+	lo = uint32(len(v.b))
+	i := 0
+	putRef := func(n int) {
+		x, l := binary.Uvarint(b[i+n:])
+		var t [binary.MaxVarintLen64]byte
+		k := binary.PutUvarint(t[:], uint64(m.string(v, StringRef(x))))
+		v.b = append(v.b, b[i:i+n]...)
+		v.b = append(v.b, t[:k]...)
+		i += n + l
+	}
+	for i < len(b) {
+		// Format.
+		putRef(0)
+		for i < len(b) {
+			kind := b[i]
+			switch kind {
+			case fmtEnd, fmtNil, fmtBoolTrue, fmtBoolFalse:
+				v.b = append(v.b, kind)
+				i++
+			case fmtStringRef:
+				putRef(1)
+			case fmtString:
+				l := 2 + int(b[i+1])
+				v.b = append(v.b, b[i:i+l]...)
+				i += l
+			default:
+				_, l := binary.Uvarint(b[i+1:])
+				v.b = append(v.b, b[i:i+1+l]...)
+				i += 1 + l
+			}
+			if kind == fmtEnd {
+				break
+			}
+		}
+	}
+	hi = uint32(len(v.b))
+	return
+}
+
+// Make callers and tracks private to view since views made by NewView share them with buffer.
+func (v *View) ownShared() {
+	byPC := make(map[uint64]*callerCache, len(v.callerByPC))
+	for pc, r := range v.callerByPC {
+		byPC[pc] = r
+	}
+	v.callerByPC = byPC
+	v.callers = append([]*callerCache(nil), v.callers...)
+}
+
+// Move view's time base so that it starts at given time.
+func (v *View) rebase(t time.Time) {
+	if d := v.StartTime.Sub(t); d > 0 {
+		dt := uint64(float64(d.Nanoseconds()) / v.cpuTimeUnitNsec)
+		for i := range v.allViewEvents {
+			v.allViewEvents[i].timestamp += dt
+		}
+		v.StartTime = t
+	}
+}
+
+// appendView adds events of src to view; events stay sorted by time.
+func (v *View) appendView(src *View) { v.appendHostView(src, "", 0) }
+
+// appendHostView adds events of src with tracks labeled with given host and times shifted by dt.
+func (v *View) appendHostView(src *View, host string, dt time.Duration) {
+	v.convertBufferEvents()
+	src.convertBufferEvents()
+	if len(src.allViewEvents) == 0 {
+		return
+	}
+	v.ownShared()
+	srcStart := src.StartTime.Add(dt)
+	sameBase := v.cpuStartTime == src.cpuStartTime && v.cpuTimeUnitNsec == src.cpuTimeUnitNsec &&
+		v.StartTime.Equal(srcStart)
+	if len(v.allViewEvents) == 0 && len(v.callers) == 0 {
+		v.sharedHeader = src.sharedHeader
+		v.StartTime = srcStart
+		sameBase = true
+	}
+	if !sameBase {
+		v.rebase(srcStart)
+	}
+	offset := float64(srcStart.Sub(v.StartTime).Nanoseconds())
+
+	m := &viewRemap{src: src, host: host, strings: make(map[StringRef]StringRef)}
+	sorted := true
+	for i := range src.allViewEvents {
+		s := &src.allViewEvents[i]
+		var e viewEvent
+		e.eventHeader = s.eventHeader
+		if !sameBase {
+			nsec := offset + float64(s.timestamp-src.cpuStartTime)*src.cpuTimeUnitNsec
+			e.timestamp = v.cpuStartTime + uint64(nsec/v.cpuTimeUnitNsec)
+		}
+		e.callerIndex = m.caller(v, s.callerIndex)
+		e.trackIndex = m.track(v, s.trackIndex)
+		e.lo, e.hi = m.data(v, src.b[s.lo:s.hi])
+		if n := len(v.allViewEvents); n > 0 && e.timestamp < v.allViewEvents[n-1].timestamp {
+			sorted = false
+		}
+		v.allViewEvents = append(v.allViewEvents, e)
+	}
+	if !sorted {
+		es := v.allViewEvents
+		sort.SliceStable(es, func(i, j int) bool { return es[i].timestamp < es[j].timestamp })
+	}
+	v.currentViewEvents = v.allViewEvents
+	v.Times.StartTime = time.Time{}
+	v.getViewTimes()
+}
+
+// Merging views from several hosts: each host's events are placed on tracks labeled with
+// the host and clocks are aligned either by wall clock time or by matching events sent on
+// one host with events received on another (e.g. rpc requests and replies).
+
+type ClockAlign uint8
+
+const (
+	// Use wall clock time recorded in each view.
+	AlignWallClock ClockAlign = iota
+	// Estimate clock offsets between hosts from send/receive event pairs.
+	AlignEventPairs
+)
+
+// MergeSource is a view to merge with host name labeling its events.
+type MergeSource struct {
+	// Defaults to view's host or, if not known, its name.
+	Host string
+	View *View
+}
+
+type MergeOptions struct {
+	Align ClockAlign
+	// For AlignEventPairs: Start matches send events and End matches receive events.
+	// A send and a receive on different hosts pair when their first regexp submatches
+	// (e.g. rpc sequence number) are equal.  Without submatches the entire match is used.
+	Pairs []EventPair
+}
+
+// Key of send or receive event.
+func clockPairKey(re *regexp.Regexp, s string) (k string, ok bool) {
+	m := re.FindStringSubmatch(s)
+	switch {
+	case m == nil:
+	case len(m) > 1:
+		k, ok = m[1], true
+	default:
+		k, ok = m[0], true
+	}
+	return
+}
+
+// Send/receive times in wall clock nanoseconds by host.
+type clockPairEvents struct {
+	send, recv map[int][]int64
+}
+
+// Bounds for clock offset of host b relative to host a (with a < b) given by messages between them.
+type clockBounds struct {
+	// Messages a to b give upper bound; b to a give lower bound.
+	lo, hi       int64
+	hasLo, hasHi bool
+}
+
+// Offset estimate: midpoint when bounded on both sides otherwise least change from wall clock
+// which keeps receives after sends.
+func (c *clockBounds) offset() (d int64) {
+	switch {
+	case c.hasLo && c.hasHi:
+		d = c.lo + (c.hi-c.lo)/2
+	case c.hasHi && c.hi < 0:
+		d = c.hi
+	case c.hasLo && c.lo > 0:
+		d = c.lo
+	}
+	return
+}
+
+// Clock of each host minus clock of first host in nanoseconds estimated from event pairs.
+// Hosts without pairs linking them to the first host keep their wall clock.
+func clockOffsets(srcs []MergeSource, pairs []EventPair) (offsets []int64) {
+	events := make(map[string]*clockPairEvents)
+	get := func(p int, k string) *clockPairEvents {
+		k = fmt.Sprintf("%d\x00%s", p, k)
+		e := events[k]
+		if e == nil {
+			e = &clockPairEvents{send: make(map[int][]int64), recv: make(map[int][]int64)}
+			events[k] = e
+		}
+		return e
+	}
+	for h := range srcs {
+		v := srcs[h].View
+		for i := uint(0); i < v.NumEvents(); i++ {
+			name := v.eventName(i)
+			for p := range pairs {
+				if k, ok := clockPairKey(pairs[p].Start, name); ok {
+					e := get(p, k)
+					e.send[h] = append(e.send[h], v.goTime(v.Event(i)).UnixNano())
+				} else if k, ok := clockPairKey(pairs[p].End, name); ok {
+					e := get(p, k)
+					e.recv[h] = append(e.recv[h], v.goTime(v.Event(i)).UnixNano())
+				}
+			}
+		}
+	}
+
+	bounds := make(map[[2]int]*clockBounds)
+	for _, e := range events {
+		for a, ts := range e.send {
+			for b, tr := range e.recv {
+				if a == b {
+					continue
+				}
+				// Pair sends and receives with same key in order.
+				for i := 0; i < len(ts) && i < len(tr); i++ {
+					k, d := [2]int{a, b}, tr[i]-ts[i]
+					if a > b {
+						k = [2]int{b, a}
+					}
+					c := bounds[k]
+					if c == nil {
+						c = &clockBounds{}
+						bounds[k] = c
+					}
+					if a < b {
+						if !c.hasHi || d < c.hi {
+							c.hi, c.hasHi = d, true
+						}
+					} else {
+						// Receive on host k[0] of message sent by k[1].
+						if d = -d; !c.hasLo || d > c.lo {
+							c.lo, c.hasLo = d, true
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// Propagate offsets outward from first host; host pairs are sorted so result is deterministic.
+	keys := make([][2]int, 0, len(bounds))
+	for k := range bounds {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	offsets = make([]int64, len(srcs))
+	aligned := make([]bool, len(srcs))
+	aligned[0] = true
+	for changed := true; changed; {
+		changed = false
+		for _, k := range keys {
+			a, b, c := k[0], k[1], bounds[k]
+			switch {
+			case aligned[a] && !aligned[b]:
+				offsets[b] = offsets[a] + c.offset()
+				aligned[b] = true
+			case aligned[b] && !aligned[a]:
+				offsets[a] = offsets[b] - c.offset()
+				aligned[a] = true
+			default:
+				continue
+			}
+			changed = true
+		}
+	}
+	return
+}
+
+// MergeViews returns a view with events of all given views labeled with their hosts and
+// the time shift applied to each host's events to align clocks.
+func MergeViews(o *MergeOptions, srcs ...MergeSource) (v *View, shifts []time.Duration) {
+	v = &View{}
+	shifts = make([]time.Duration, len(srcs))
+	if len(srcs) == 0 {
+		return
+	}
+	if o != nil && o.Align == AlignEventPairs && len(o.Pairs) > 0 {
+		for h, d := range clockOffsets(srcs, o.Pairs) {
+			shifts[h] = -time.Duration(d)
+		}
+	}
+	hosts := make([]string, len(srcs))
+	for h := range srcs {
+		if hosts[h] = srcs[h].Host; hosts[h] == "" {
+			hosts[h] = srcs[h].View.Host()
+		}
+		if hosts[h] == "" {
+			hosts[h] = srcs[h].View.Name()
+		}
+		v.appendHostView(srcs[h].View, hosts[h], shifts[h])
+	}
+	v.SetName(strings.Join(hosts, ","))
+	return
+}
@@ -0,0 +1,91 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elog
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestMergeViews(t *testing.T) {
+	if !Enabled() {
+		t.Skip("event log disabled; build with -tags elog")
+	}
+	var bs [2]*Buffer
+	for h := range bs {
+		bs[h] = New(10)
+		bs[h].Enable(true)
+	}
+	client, server := bs[0], bs[1]
+	const n = 50
+	for i := uint64(0); i < n; i++ {
+		client.F1u("rpc send %d", i)
+		server.F1u("rpc recv %d", i)
+		server.F1u("rpc reply %d", i)
+		client.F1u("rpc done %d", i)
+	}
+	var vs [2]*View
+	for h := range vs {
+		vs[h] = bs[h].NewView()
+	}
+	// Server clock is one second ahead.
+	const skew = time.Second
+	vs[1].StartTime = vs[1].StartTime.Add(skew)
+
+	srcs := []MergeSource{{Host: "client", View: vs[0]}, {Host: "server", View: vs[1]}}
+	v, shifts := MergeViews(nil, srcs...)
+	if got := v.NumEvents(); got != 4*n {
+		t.Fatalf("%d events", got)
+	}
+	if shifts[1] != 0 {
+		t.Fatalf("wall clock shift %v", shifts[1])
+	}
+	// With skew server events all come after client events.
+	if h := v.EventHost(2 * n); h != "server" {
+		t.Fatalf("event %d host %q", 2*n, h)
+	}
+
+	o := &MergeOptions{Align: AlignEventPairs}
+	o.Pairs = []EventPair{
+		{Name: "request", Start: regexp.MustCompile(`^rpc send (\d+)$`), End: regexp.MustCompile(`^rpc recv (\d+)$`)},
+		{Name: "reply", Start: regexp.MustCompile(`^rpc reply (\d+)$`), End: regexp.MustCompile(`^rpc done (\d+)$`)},
+	}
+	v, shifts = MergeViews(o, srcs...)
+	if d := shifts[1] + skew; d < -time.Millisecond || d > time.Millisecond {
+		t.Fatalf("shift %v, expected about %v", shifts[1], -skew)
+	}
+	if got := v.NumEvents(); got != 4*n {
+		t.Fatalf("%d events", got)
+	}
+	// Aligned events are interleaved as logged.
+	want := []string{"client", "server", "server", "client"}
+	for i := uint(0); i < v.NumEvents(); i++ {
+		if h := v.EventHost(i); h != want[i%4] {
+			t.Fatalf("event %d %q host %q", i, v.EventLines(i), h)
+		}
+	}
+	if hs := v.Hosts(); len(hs) != 2 || hs[0] != "client" || hs[1] != "server" || v.Name() != "client,server" {
+		t.Fatalf("hosts %v name %s", hs, v.Name())
+	}
+	if es, err := v.EventsWhere(`host == "server"`, nil); err != nil || len(es) != 2*n {
+		t.Fatalf("server events %d %v", len(es), err)
+	}
+
+	// Hosts are saved.
+	b, err := v.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var w View
+	if err = w.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	for i := uint(0); i < w.NumEvents(); i++ {
+		if w.EventHost(i) != v.EventHost(i) || w.TrackLabel(uint(w.Event(i).trackIndex)) != v.TrackLabel(uint(v.Event(i).trackIndex)) {
+			t.Fatalf("event %d host %q label %q", i, w.EventHost(i), w.TrackLabel(uint(w.Event(i).trackIndex)))
+		}
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elog
+
+import (
+	"github.com/platinasystems/elib"
+
+	"sync/atomic"
+)
+
+// Sharded buffer mode: each cpu logs into its own ring so that concurrent loggers
+// (e.g. loop active pollers) do not contend on a single buffer index.
+// Views merge all rings by timestamp.
+
+// One ring of a sharded buffer.
+type bufferShard struct {
+	events []bufferEvent
+	// As Buffer index, committed and disableIndex.
+	index, committed, disableIndex uint64
+	log2Len                        uint64
+	// Pad to cache line so that indices of different shards are not shared.
+	_ [64 - 24 - 4*8]byte
+}
+
+type bufferShards struct {
+	shards []bufferShard
+	mask   uint
+}
+
+func (s *bufferShard) capMask() int { return 1<<s.log2Len - 1 }
+
+func (s *bufferShard) getEvent() *bufferEvent {
+	for {
+		i := atomic.LoadUint64(&s.index)
+		if i&^lockBit >= s.disableIndex {
+			return nil
+		}
+		if i&lockBit == 0 && atomic.CompareAndSwapUint64(&s.index, i, i+1) {
+			return &s.events[int(i)&s.capMask()]
+		}
+	}
+}
+
+func (s *bufferShard) lockIndex(wantLock bool) uint64 {
+	for {
+		i := atomic.LoadUint64(&s.index)
+		if isLocked := i&lockBit != 0; isLocked == wantLock {
+			continue
+		}
+		if atomic.CompareAndSwapUint64(&s.index, i, i^lockBit) {
+			if wantLock {
+				waitCommitted(&s.committed, i)
+			}
+			return i &^ lockBit
+		}
+	}
+}
+
+func (s *bufferShard) getIndex() uint64 { return atomic.LoadUint64(&s.index) &^ lockBit }
+
+func (s *bufferShard) len() (n int) {
+	n = int(s.getIndex())
+	if max := 1 << s.log2Len; n > max {
+		n = max
+	}
+	return
+}
+
+// Smallest ring size for each shard.
+const minLog2ShardLen = 10
+
+// SetShards switches buffer into sharded mode with n rings (rounded up to a power of 2)
+// which split buffer capacity.  Zero or one selects a single ring.  Clears buffer.
+func (b *Buffer) SetShards(n uint) {
+	b.lockIndex(true)
+	defer b.lockIndex(false)
+	if n <= 1 {
+		b.shards.Store(nil)
+		return
+	}
+	log2n := elib.MaxLog2(elib.Word(n))
+	ss := &bufferShards{shards: make([]bufferShard, 1<<log2n), mask: 1<<log2n - 1}
+	l := uint64(minLog2ShardLen)
+	if b.log2Len > log2n+minLog2ShardLen {
+		l = uint64(b.log2Len - log2n)
+	}
+	for i := range ss.shards {
+		s := &ss.shards[i]
+		s.log2Len = l
+		s.events = make([]bufferEvent, 1<<l)
+		s.disableIndex = b.disableIndex
+	}
+	b.shards.Store(ss)
+}
+func SetShards(n uint) { DefaultBuffer.SetShards(n) }
+
+// NumShards returns number of rings in sharded mode or 0 if buffer is not sharded.
+func (b *Buffer) NumShards() uint {
+	if ss := b.shards.Load(); ss != nil {
+		return uint(len(ss.shards))
+	}
+	return 0
+}
+
+func (ss *bufferShards) get(c *Caller) *bufferShard {
+	i := uint(c.pcHash)
+	if haveCpuIndex {
+		i = uint(cpuIndex())
+	}
+	return &ss.shards[i&ss.mask]
+}
+
+// Apply f to each shard with shard locked.
+func (ss *bufferShards) foreach(f func(s *bufferShard, i uint64)) {
+	for j := range ss.shards {
+		s := &ss.shards[j]
+		i := s.lockIndex(true)
+		f(s, i)
+		s.lockIndex(false)
+	}
+}
+
+func (ss *bufferShards) sequence() (n uint64) {
+	for j := range ss.shards {
+		n += ss.shards[j].getIndex()
+	}
+	return
+}
+
+func (ss *bufferShards) len() (n int) {
+	for j := range ss.shards {
+		n += ss.shards[j].len()
+	}
+	return
+}
+
+func (ss *bufferShards) clear() {
+	ss.foreach(func(s *bufferShard, i uint64) {
+		s.index = lockBit
+		s.committed = 0
+	})
+}
+
+// Each shard gets an equal share of remaining events.
+func (ss *bufferShards) disableAfter(n uint64) {
+	n = (n + uint64(len(ss.shards)) - 1) / uint64(len(ss.shards))
+	ss.foreach(func(s *bufferShard, i uint64) {
+		if max := uint64(1) << (s.log2Len - 1); n > max {
+			n = max
+		}
+		s.disableIndex = i + n
+	})
+}
+
+func (ss *bufferShards) enable(disableIndex uint64) {
+	ss.foreach(func(s *bufferShard, i uint64) {
+		s.index = lockBit
+		s.committed = 0
+		s.disableIndex = disableIndex
+	})
+}
+
+// Append events in ring (which has been locked with index i) to v.
+func appendRing(v bufferEventVec, events []bufferEvent, i int) bufferEventVec {
+	mask := len(events) - 1
+	if i >= len(events) {
+		v = append(v, events[i&mask:]...)
+	}
+	return append(v, events[0:i&mask]...)
+}
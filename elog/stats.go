@@ -0,0 +1,346 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elog
+
+import (
+	"github.com/platinasystems/elib"
+
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// Statistical summaries of views: per-caller event counts, inter-event latency histograms and
+// latencies between matched start/end event pairs.  Summaries of two views (e.g. a good and a
+// bad run) may be diffed.  Statistics cover current events of view (see SubView).
+
+// LatencyHistogram summarizes durations; bin i counts durations in [2^i, 2^(i+1)) nanoseconds.
+type LatencyHistogram struct {
+	Bins [64]uint64
+	// Number, sum, min and max of durations in seconds.
+	N             uint64
+	Sum, Min, Max float64
+}
+
+func (h *LatencyHistogram) add(dt float64) {
+	if h.N == 0 || dt < h.Min {
+		h.Min = dt
+	}
+	if dt > h.Max {
+		h.Max = dt
+	}
+	h.N++
+	h.Sum += dt
+	ns := uint64(0)
+	if dt > 0 {
+		ns = uint64(dt * 1e9)
+	}
+	b := bits.Len64(ns)
+	if b > 0 {
+		b--
+	}
+	h.Bins[b]++
+}
+
+// Mean returns mean duration in seconds.
+func (h *LatencyHistogram) Mean() float64 {
+	if h.N == 0 {
+		return 0
+	}
+	return h.Sum / float64(h.N)
+}
+
+// Quantile returns approximate q quantile (0 <= q <= 1) in seconds: the upper bound of
+// the bin containing the quantile clipped to maximum.
+func (h *LatencyHistogram) Quantile(q float64) float64 {
+	if h.N == 0 {
+		return 0
+	}
+	want := uint64(math.Ceil(q * float64(h.N)))
+	if want == 0 {
+		want = 1
+	}
+	n := uint64(0)
+	for i := range h.Bins {
+		if n += h.Bins[i]; n >= want {
+			return math.Min(1e-9*float64(uint64(2)<<uint(i)), h.Max)
+		}
+	}
+	return h.Max
+}
+
+func formatSeconds(s float64) string { return time.Duration(s * 1e9).String() }
+
+func (h *LatencyHistogram) String() string {
+	return fmt.Sprintf("n %d, min %s, mean %s, p50 %s, p99 %s, max %s", h.N,
+		formatSeconds(h.Min), formatSeconds(h.Mean()), formatSeconds(h.Quantile(.5)),
+		formatSeconds(h.Quantile(.99)), formatSeconds(h.Max))
+}
+
+// LatencyHistogramRow is one row of tabulated latency histogram.
+type LatencyHistogramRow struct {
+	Latency string `format:"%24s"`
+	Count   uint64 `format:"%12d"`
+}
+
+// Histogram returns non-empty bins of histogram as rows suitable for elib.Tabulate.
+func (h *LatencyHistogram) Histogram() (rows []LatencyHistogramRow) {
+	for i := range h.Bins {
+		if h.Bins[i] == 0 {
+			continue
+		}
+		rows = append(rows, LatencyHistogramRow{
+			Latency: fmt.Sprintf("%s-%s", time.Duration(uint64(1)<<uint(i)), time.Duration(uint64(2)<<uint(i))),
+			Count:   h.Bins[i],
+		})
+	}
+	return
+}
+
+// CallerStats summarizes events from one caller.
+type CallerStats struct {
+	// Caller function name and line.
+	Name string
+	Line int
+	// Number of events.
+	Count uint64
+	// Time between consecutive events from this caller.
+	Interval LatencyHistogram
+}
+
+// Key identifies caller across views.
+func (c *CallerStats) Key() string { return fmt.Sprintf("%s:%d", c.Name, c.Line) }
+
+// EventPair describes start and end events whose time difference is measured.
+// Events match when first line of their text matches Start or End regular expression.
+// An end event is paired with most recent unpaired start event of same caller function and track.
+type EventPair struct {
+	Name       string
+	Start, End *regexp.Regexp
+}
+
+// NewEventPair compiles given start and end regular expressions.
+func NewEventPair(name, start, end string) (p EventPair, err error) {
+	p.Name = name
+	if p.Start, err = regexp.Compile(start); err != nil {
+		return
+	}
+	p.End, err = regexp.Compile(end)
+	return
+}
+
+// PairStats summarizes latencies of an event pair.
+type PairStats struct {
+	Name    string
+	Latency LatencyHistogram
+	// Number of start events without end and end events without start.
+	UnmatchedStart, UnmatchedEnd uint64
+}
+
+// ViewStats summarizes events in a view.
+type ViewStats struct {
+	Events uint64
+	// Time between first and last events in seconds.
+	Duration float64
+	// Time between consecutive events of all callers.
+	Interval LatencyHistogram
+	// Callers sorted by decreasing count.
+	Callers []CallerStats
+	Pairs   []PairStats
+}
+
+type pairKey struct {
+	name  string
+	track uint32
+}
+
+// Stats computes statistics for current events of view and given event pairs.
+func (v *View) Stats(pairs ...EventPair) (s *ViewStats) {
+	s = &ViewStats{}
+	n := v.NumEvents()
+	s.Events = uint64(n)
+	byCaller := make(map[uint32]int)
+	lastByCaller := make(map[uint32]float64)
+	s.Pairs = make([]PairStats, len(pairs))
+	starts := make([]map[pairKey][]float64, len(pairs))
+	for i := range pairs {
+		s.Pairs[i].Name = pairs[i].Name
+		starts[i] = make(map[pairKey][]float64)
+	}
+	var t0, tPrev float64
+	for i := uint(0); i < n; i++ {
+		e := v.Event(i)
+		t := v.ElapsedTime(e)
+		if i == 0 {
+			t0 = t
+		} else {
+			s.Interval.add(t - tPrev)
+		}
+		tPrev = t
+
+		ci, ok := byCaller[e.callerIndex]
+		if !ok {
+			c := v.EventCaller(i)
+			ci = len(s.Callers)
+			byCaller[e.callerIndex] = ci
+			s.Callers = append(s.Callers, CallerStats{Name: c.Name, Line: c.Line})
+		}
+		cs := &s.Callers[ci]
+		cs.Count++
+		if tl, ok := lastByCaller[e.callerIndex]; ok {
+			cs.Interval.add(t - tl)
+		}
+		lastByCaller[e.callerIndex] = t
+
+		if len(pairs) == 0 {
+			continue
+		}
+		name := ""
+		if lines := v.EventLines(i); len(lines) > 0 {
+			name = lines[0]
+		}
+		k := pairKey{name: cs.Name, track: e.trackIndex}
+		for j := range pairs {
+			p, ps := &pairs[j], &s.Pairs[j]
+			switch {
+			case p.Start.MatchString(name):
+				starts[j][k] = append(starts[j][k], t)
+			case p.End.MatchString(name):
+				if st := starts[j][k]; len(st) > 0 {
+					ps.Latency.add(t - st[len(st)-1])
+					starts[j][k] = st[:len(st)-1]
+				} else {
+					ps.UnmatchedEnd++
+				}
+			}
+		}
+	}
+	s.Duration = tPrev - t0
+	for j := range starts {
+		for _, st := range starts[j] {
+			s.Pairs[j].UnmatchedStart += uint64(len(st))
+		}
+	}
+	sort.SliceStable(s.Callers, func(i, j int) bool { return s.Callers[i].Count > s.Callers[j].Count })
+	return
+}
+
+type statsCallerRow struct {
+	Caller   string `align:"left"`
+	Count    uint64 `format:" %11d"`
+	Rate     string `format:" %11s"`
+	Interval string `format:" %11s"`
+}
+
+func (s *ViewStats) rate(n uint64) string {
+	if s.Duration <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.3g/s", float64(n)/s.Duration)
+}
+
+// Write writes summary of statistics.
+func (s *ViewStats) Write(w io.Writer) {
+	fmt.Fprintf(w, "%d events in %s, interval %v\n", s.Events, formatSeconds(s.Duration), &s.Interval)
+	rows := make([]statsCallerRow, len(s.Callers))
+	for i := range s.Callers {
+		c := &s.Callers[i]
+		rows[i] = statsCallerRow{Caller: c.Key(), Count: c.Count, Rate: s.rate(c.Count), Interval: formatSeconds(c.Interval.Mean())}
+	}
+	elib.Tabulate(rows).Write(w)
+	for i := range s.Pairs {
+		p := &s.Pairs[i]
+		fmt.Fprintf(w, "%s: %v, unmatched start %d end %d\n", p.Name, &p.Latency, p.UnmatchedStart, p.UnmatchedEnd)
+		elib.Tabulate(p.Latency.Histogram()).Write(w)
+	}
+}
+
+// StatsDiffRow compares counts and latencies of a caller or event pair in two views.
+type StatsDiffRow struct {
+	Name string
+	// Counts in each view.
+	Count [2]uint64
+	// Mean and 99th percentile interval or pair latency in seconds.
+	Mean, P99 [2]float64
+}
+
+// CountChange returns relative change of count from first to second view.
+func (r *StatsDiffRow) CountChange() float64 {
+	switch {
+	case r.Count[0] == r.Count[1]:
+		return 0
+	case r.Count[0] == 0:
+		return math.Inf(1)
+	}
+	return float64(r.Count[1])/float64(r.Count[0]) - 1
+}
+
+// Diff compares statistics of s with those of t; rows are sorted by decreasing magnitude
+// of count change.  Callers are identified by function name and line; pairs by name.
+func (s *ViewStats) Diff(t *ViewStats) (rows []StatsDiffRow) {
+	index := make(map[string]int)
+	add := func(k int, name string, count uint64, h *LatencyHistogram) {
+		i, ok := index[name]
+		if !ok {
+			i = len(rows)
+			index[name] = i
+			rows = append(rows, StatsDiffRow{Name: name})
+		}
+		r := &rows[i]
+		r.Count[k] = count
+		r.Mean[k] = h.Mean()
+		r.P99[k] = h.Quantile(.99)
+	}
+	for k, x := range [2]*ViewStats{s, t} {
+		add(k, "all events", x.Events, &x.Interval)
+		for i := range x.Callers {
+			c := &x.Callers[i]
+			add(k, c.Key(), c.Count, &c.Interval)
+		}
+		for i := range x.Pairs {
+			p := &x.Pairs[i]
+			add(k, "pair "+p.Name, p.Latency.N, &p.Latency)
+		}
+	}
+	sort.SliceStable(rows[1:], func(i, j int) bool {
+		return math.Abs(rows[1+i].CountChange()) > math.Abs(rows[1+j].CountChange())
+	})
+	return
+}
+
+type statsDiffRow struct {
+	Name   string `align:"left"`
+	CountA uint64 `format:" %11d"`
+	CountB uint64 `format:" %11d"`
+	Change string `format:" %9s"`
+	MeanA  string `format:" %11s"`
+	MeanB  string `format:" %11s"`
+	P99A   string `format:" %11s"`
+	P99B   string `format:" %11s"`
+}
+
+// WriteStatsDiff writes table comparing statistics of two views.
+func WriteStatsDiff(w io.Writer, a, b *ViewStats) {
+	diff := a.Diff(b)
+	rows := make([]statsDiffRow, len(diff))
+	for i := range diff {
+		d := &diff[i]
+		rows[i] = statsDiffRow{
+			Name:   d.Name,
+			CountA: d.Count[0],
+			CountB: d.Count[1],
+			Change: fmt.Sprintf("%+.1f%%", 100*d.CountChange()),
+			MeanA:  formatSeconds(d.Mean[0]),
+			MeanB:  formatSeconds(d.Mean[1]),
+			P99A:   formatSeconds(d.P99[0]),
+			P99B:   formatSeconds(d.P99[1]),
+		}
+	}
+	elib.Tabulate(rows).Write(w)
+}
@@ -0,0 +1,88 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elog
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestLatencyHistogram(t *testing.T) {
+	var (
+		h  LatencyHistogram
+		dt []float64
+	)
+	for i := 1; i <= 100; i++ {
+		dt = append(dt, float64(i)*1e-6)
+		h.add(dt[i-1])
+	}
+	if h.N != 100 || h.Min != dt[0] || h.Max != dt[99] {
+		t.Fatalf("%v", &h)
+	}
+	if m := h.Mean(); m < 50.4e-6 || m > 50.6e-6 {
+		t.Fatalf("mean %g", m)
+	}
+	// Quantiles are bin upper bounds: within factor of 2.
+	if q := h.Quantile(.5); q < 50e-6 || q > 100e-6 {
+		t.Fatalf("p50 %g", q)
+	}
+	if q := h.Quantile(1); q != h.Max {
+		t.Fatalf("p100 %g", q)
+	}
+}
+
+func statsTestOp(b *Buffer, i uint64, exit bool) {
+	b.F1u("enter %d", i)
+	if exit {
+		b.F1u("exit %d", i)
+	}
+}
+
+func TestViewStats(t *testing.T) {
+	if !Enabled() {
+		t.Skip("event log disabled; build with -tags elog")
+	}
+	p, err := NewEventPair("op", "^enter", "^exit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats [2]*ViewStats
+	for k, n := range [2]int{100, 150} {
+		b := New(12)
+		b.Enable(true)
+		for i := 0; i < n; i++ {
+			statsTestOp(b, uint64(i), i%10 != 0)
+		}
+		b.F1u("other %d", 0)
+		stats[k] = b.NewView().Stats(p)
+	}
+	s := stats[0]
+	if s.Events != 100+90+1 || len(s.Callers) != 3 {
+		t.Fatalf("%d events %d callers", s.Events, len(s.Callers))
+	}
+	if c := &s.Callers[0]; c.Count != 100 || c.Interval.N != 99 {
+		t.Fatalf("caller %s count %d", c.Key(), c.Count)
+	}
+	// Every tenth enter has no exit and stays unmatched.
+	if ps := &s.Pairs[0]; ps.Latency.N != 90 || ps.UnmatchedStart != 10 || ps.UnmatchedEnd != 0 {
+		t.Fatalf("pair %v unmatched %d %d", &ps.Latency, ps.UnmatchedStart, ps.UnmatchedEnd)
+	}
+
+	d := stats[0].Diff(stats[1])
+	if len(d) != 5 || d[0].Name != "all events" || d[0].Count != [2]uint64{191, 286} {
+		t.Fatalf("diff %+v", d)
+	}
+	for i := range d {
+		if d[i].Name == "pair op" && d[i].Count != [2]uint64{90, 135} {
+			t.Fatalf("pair diff %+v", d[i])
+		}
+	}
+	var w bytes.Buffer
+	WriteStatsDiff(&w, stats[0], stats[1])
+	stats[1].Write(&w)
+	if w.Len() == 0 {
+		t.Fatal("no output")
+	}
+}
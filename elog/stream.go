@@ -0,0 +1,384 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elog
+
+import (
+	"github.com/platinasystems/elib/iomux"
+	"github.com/platinasystems/elib/socket"
+
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Streaming: events are drained from a buffer incrementally and written as a sequence of chunks.
+// Each chunk is a self-contained encoded view (as written by Save) of the events logged
+// since the previous chunk so that history is not limited by buffer size.
+// Chunks are framed as 4 byte magic, 4 byte big endian length and encoded view.
+
+const streamMagic = "elgS"
+
+var errStreamMagic = errors.New("elog stream: bad chunk magic")
+
+type Stream struct {
+	b *Buffer
+	w io.Writer
+
+	mu sync.Mutex
+
+	// Next sequence number to drain from buffer and from each shard.
+	seq      uint64
+	shards   *bufferShards
+	shardSeq []uint64
+
+	// Number of chunks and events written.
+	Chunks, Events uint64
+	// Number of events overwritten in buffer before they could be drained or
+	// which could not be written.
+	Dropped uint64
+	// Last write error.
+	Err error
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewStream returns stream writing events from given buffer to w.
+// Events already in buffer will be written with first chunk.
+func (b *Buffer) NewStream(w io.Writer) (s *Stream) {
+	s = &Stream{b: b, w: w}
+	if n, c := b.getIndex(), uint64(b.Cap()); n > c {
+		s.seq = n - c
+	}
+	return
+}
+func NewStream(w io.Writer) *Stream { return DefaultBuffer.NewStream(w) }
+
+// Append events in ring locked with index i which have not been drained.
+func (s *Stream) drainRing(es bufferEventVec, events []bufferEvent, seq *uint64, i uint64) bufferEventVec {
+	// Buffer cleared or re-enabled.
+	if i < *seq {
+		*seq = 0
+	}
+	if c := uint64(len(events)); i-*seq > c {
+		s.Dropped += i - *seq - c
+		*seq = i - c
+	}
+	mask := uint64(len(events) - 1)
+	for ; *seq < i; *seq++ {
+		es = append(es, events[*seq&mask])
+	}
+	return es
+}
+
+func (s *Stream) drain() (es bufferEventVec) {
+	b := s.b
+	if ss := b.shards.Load(); ss != nil {
+		if ss != s.shards {
+			s.shards = ss
+			s.shardSeq = make([]uint64, len(ss.shards))
+		}
+		j := 0
+		ss.foreach(func(r *bufferShard, i uint64) {
+			es = s.drainRing(es, r.events, &s.shardSeq[j], i)
+			j++
+		})
+	} else {
+		i := b.lockIndex(true)
+		es = s.drainRing(es, b.events, &s.seq, i)
+		b.lockIndex(false)
+	}
+	return
+}
+
+// Flush writes a chunk with all events logged since previous chunk.
+func (s *Stream) Flush() (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	es := s.drain()
+	if len(es) == 0 {
+		return
+	}
+	v := s.b.newView()
+	v.setBufferEvents(es)
+	var d []byte
+	if d, err = v.MarshalBinary(); err == nil {
+		var h [8]byte
+		copy(h[:], streamMagic)
+		binary.BigEndian.PutUint32(h[4:], uint32(len(d)))
+		if _, err = s.w.Write(append(h[:], d...)); err == nil {
+			s.Chunks++
+			s.Events += uint64(len(es))
+		}
+	}
+	if err != nil {
+		s.Dropped += uint64(len(es))
+		s.Err = err
+	}
+	return
+}
+
+// Start flushes stream periodically with given interval until Stop is called.
+func (s *Stream) Start(interval time.Duration) {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		defer close(s.done)
+		for {
+			select {
+			case <-t.C:
+				s.Flush()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops periodic flushing, writes final chunk and closes writer (if it is an io.Closer).
+func (s *Stream) Stop() (err error) {
+	if s.stop != nil {
+		close(s.stop)
+		<-s.done
+		s.stop = nil
+	}
+	err = s.Flush()
+	if c, ok := s.w.(io.Closer); ok {
+		if e := c.Close(); err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+func (s *Stream) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fmt.Sprintf("%d chunks, %d events, %d dropped", s.Chunks, s.Events, s.Dropped)
+}
+
+// RotatingFile is a writer which switches to a new file when file would exceed given size.
+// Older files are named FILE.1, FILE.2, ... up to MaxFiles-1 with higher suffix being older.
+type RotatingFile struct {
+	Path     string
+	MaxBytes int64
+	MaxFiles int
+
+	f    *os.File
+	size int64
+}
+
+func NewRotatingFile(path string, maxBytes int64, maxFiles int) (r *RotatingFile, err error) {
+	if maxFiles < 1 {
+		maxFiles = 1
+	}
+	r = &RotatingFile{Path: path, MaxBytes: maxBytes, MaxFiles: maxFiles}
+	err = r.open()
+	return
+}
+
+func (r *RotatingFile) fileName(i int) string {
+	if i == 0 {
+		return r.Path
+	}
+	return fmt.Sprintf("%s.%d", r.Path, i)
+}
+
+func (r *RotatingFile) open() (err error) {
+	r.f, err = os.OpenFile(r.Path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	r.size = 0
+	return
+}
+
+func (r *RotatingFile) rotate() (err error) {
+	if err = r.f.Close(); err != nil {
+		return
+	}
+	os.Remove(r.fileName(r.MaxFiles - 1))
+	for i := r.MaxFiles - 2; i >= 0; i-- {
+		if err = os.Rename(r.fileName(i), r.fileName(i+1)); err != nil && !os.IsNotExist(err) {
+			return
+		}
+	}
+	return r.open()
+}
+
+// Write writes p to current file; p is never split across files.
+func (r *RotatingFile) Write(p []byte) (n int, err error) {
+	if r.MaxBytes > 0 && r.size > 0 && r.size+int64(len(p)) > r.MaxBytes {
+		if err = r.rotate(); err != nil {
+			return
+		}
+	}
+	n, err = r.f.Write(p)
+	r.size += int64(n)
+	return
+}
+
+func (r *RotatingFile) Close() error { return r.f.Close() }
+
+// Files returns names of existing files oldest first.
+func (r *RotatingFile) Files() (names []string) { return rotatedFiles(r.Path) }
+
+func rotatedFiles(path string) (names []string) {
+	for i := 0; ; i++ {
+		n := path
+		if i > 0 {
+			n = fmt.Sprintf("%s.%d", path, i)
+		}
+		if _, err := os.Stat(n); err != nil {
+			break
+		}
+		names = append([]string{n}, names...)
+	}
+	return
+}
+
+// Maximum amount of data to queue for socket before dropping chunks.
+const maxStreamSocketPending = 16 << 20
+
+var errStreamSocketBacklog = errors.New("elog stream: socket backlog")
+
+type streamSocket struct {
+	*socket.Client
+}
+
+func (s streamSocket) Write(p []byte) (n int, err error) {
+	if s.IsClosed() {
+		return 0, io.ErrClosedPipe
+	}
+	if s.TxLen()+len(p) > maxStreamSocketPending {
+		return 0, errStreamSocketBacklog
+	}
+	return s.Client.Write(p)
+}
+
+func (s streamSocket) Close() error {
+	iomux.Del(s.Client)
+	return s.Client.Close()
+}
+
+// NewSocketStream returns stream writing to socket client connected to given address (e.g. host:port).
+// Socket I/O is driven by iomux.Default.
+func (b *Buffer) NewSocketStream(cfg string) (s *Stream, err error) {
+	var c *socket.Client
+	if c, err = socket.NewClient(cfg); err != nil {
+		return
+	}
+	c.SetWriteOnly()
+	iomux.Add(c)
+	s = b.NewStream(streamSocket{c})
+	return
+}
+func NewSocketStream(cfg string) (*Stream, error) { return DefaultBuffer.NewSocketStream(cfg) }
+
+// ReadStream reads chunks from r and appends their events to view.
+// A truncated final chunk (e.g. from a crash while writing) is ignored.
+func (v *View) ReadStream(r io.Reader) (err error) {
+	br := bufio.NewReader(r)
+	var d bytes.Buffer
+	for {
+		var h [8]byte
+		if _, err = io.ReadFull(br, h[:]); err != nil {
+			break
+		}
+		if string(h[:4]) != streamMagic {
+			return errStreamMagic
+		}
+		// Length may be corrupt: buffer grows only as data is read so truncated chunk fails cheaply.
+		l := int64(binary.BigEndian.Uint32(h[4:]))
+		d.Reset()
+		if _, err = io.CopyN(&d, br, l); err != nil {
+			break
+		}
+		var c View
+		if err = c.UnmarshalBinary(d.Bytes()); err != nil {
+			return
+		}
+		v.appendView(&c)
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return
+}
+
+// LoadStreamFiles reads stream written to given rotating file and its older rotations.
+func (v *View) LoadStreamFiles(path string) (err error) {
+	names := rotatedFiles(path)
+	if len(names) == 0 {
+		return fmt.Errorf("elog stream: no files %s", path)
+	}
+	v.SetName(path)
+	for _, n := range names {
+		var f *os.File
+		if f, err = os.Open(n); err != nil {
+			return
+		}
+		err = v.ReadStream(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", n, err)
+		}
+	}
+	return
+}
+
+var defaultStream atomic.Pointer[Stream]
+
+// Defaults for streaming configured with "stream FILE".
+const (
+	DefaultStreamMaxBytes = 64 << 20
+	DefaultStreamMaxFiles = 8
+	DefaultStreamInterval = 1 * time.Second
+)
+
+// StreamToFile starts streaming default buffer to rotating file; chunks are written
+// with given interval.  Any previous stream is stopped.
+func StreamToFile(path string, maxBytes int64, maxFiles int, interval time.Duration) (err error) {
+	var f *RotatingFile
+	if f, err = NewRotatingFile(path, maxBytes, maxFiles); err != nil {
+		return
+	}
+	startDefaultStream(NewStream(f), interval)
+	return
+}
+
+// StreamToSocket starts streaming default buffer to socket.
+func StreamToSocket(cfg string, interval time.Duration) (err error) {
+	var s *Stream
+	if s, err = NewSocketStream(cfg); err != nil {
+		return
+	}
+	startDefaultStream(s, interval)
+	return
+}
+
+func startDefaultStream(s *Stream, interval time.Duration) {
+	if old := defaultStream.Swap(s); old != nil {
+		old.Stop()
+	}
+	s.Start(interval)
+}
+
+// StopStream stops streaming of default buffer.
+func StopStream() (err error) {
+	if s := defaultStream.Swap(nil); s != nil {
+		err = s.Stop()
+	}
+	return
+}
+
+// GetStream returns stream of default buffer or nil if not streaming.
+func GetStream() *Stream { return defaultStream.Load() }
@@ -0,0 +1,129 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elog
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// Check view has events "stream N" with N increasing ending at last.
+func checkStreamView(t *testing.T, v *View, n uint, last uint64) {
+	if got := v.NumEvents(); got != n {
+		t.Fatalf("%d events, expected %d", got, n)
+	}
+	prev := int64(-1)
+	for i := uint(0); i < n; i++ {
+		var x int64
+		if _, err := fmt.Sscanf(v.EventLines(i)[0], "stream %d", &x); err != nil {
+			t.Fatalf("event %d: %q", i, v.EventLines(i))
+		}
+		if x <= prev {
+			t.Fatalf("event %d: %d after %d", i, x, prev)
+		}
+		prev = x
+	}
+	if uint64(prev) != last {
+		t.Fatalf("last event %d, expected %d", prev, last)
+	}
+}
+
+func TestStream(t *testing.T) {
+	if !Enabled() {
+		t.Skip("event log disabled; build with -tags elog")
+	}
+	b := New(12)
+	b.Enable(true)
+	var w bytes.Buffer
+	s := b.NewStream(&w)
+	i := uint64(0)
+	log := func(n uint64) {
+		for ; n > 0; n-- {
+			b.F1u("stream %d", i)
+			i++
+		}
+		if err := s.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	log(3000)
+	log(3000)
+	// Overflows buffer.
+	log(5000)
+	// Empty flush writes nothing.
+	log(0)
+	if s.Chunks != 3 || s.Dropped != 5000-uint64(b.Cap()) {
+		t.Fatalf("stream %v", s)
+	}
+	b.SetShards(2)
+	log(1000)
+
+	var v View
+	if err := v.ReadStream(bytes.NewReader(w.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	checkStreamView(t, &v, uint(s.Events), i-1)
+
+	// Truncated final chunk is ignored.
+	var u View
+	if err := u.ReadStream(bytes.NewReader(w.Bytes()[:w.Len()-10])); err != nil {
+		t.Fatal(err)
+	}
+	checkStreamView(t, &u, uint(s.Events-1000), 11000-1)
+
+	// Corrupt chunk length does not allocate whole claimed length.
+	c := append([]byte(streamMagic), 0xff, 0xff, 0xff, 0xff, 1, 2, 3)
+	var ms0, ms1 runtime.MemStats
+	runtime.ReadMemStats(&ms0)
+	if err := u.ReadStream(bytes.NewReader(c)); err != nil {
+		t.Fatal(err)
+	}
+	runtime.ReadMemStats(&ms1)
+	if n := ms1.TotalAlloc - ms0.TotalAlloc; n > 1<<20 {
+		t.Fatalf("allocated %d bytes for corrupt chunk", n)
+	}
+}
+
+func TestStreamRotatingFile(t *testing.T) {
+	if !Enabled() {
+		t.Skip("event log disabled; build with -tags elog")
+	}
+	b := New(12)
+	b.Enable(true)
+	path := filepath.Join(t.TempDir(), "elog")
+	f, err := NewRotatingFile(path, 16<<10, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := b.NewStream(f)
+	i := uint64(0)
+	for c := 0; c < 20; c++ {
+		for j := 0; j < 500; j++ {
+			b.F1u("stream %d", i)
+			i++
+		}
+		if err = s.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = s.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(f.Files()); n != 3 {
+		t.Fatalf("%d files", n)
+	}
+	var v View
+	if err = v.LoadStreamFiles(path); err != nil {
+		t.Fatal(err)
+	}
+	n := v.NumEvents()
+	if n == 0 || n%500 != 0 || n >= 20*500 {
+		t.Fatalf("%d events", n)
+	}
+	checkStreamView(t, &v, n, i-1)
+}
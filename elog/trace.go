@@ -0,0 +1,264 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Export of views to trace formats understood by chrome://tracing and ui.perfetto.dev.
+// Each event becomes an instant event on a thread named after its track (e.g. loop node).
+
+// Track index for event; tracks are numbered from 1 since thread id 0 is reserved by viewers.
+func (v *View) traceTid(e *eventHeader) uint64 { return uint64(e.trackIndex) + 1 }
+
+func (v *View) traceThreadName(track uint) string {
+	if n := v.TrackLabel(track); n != "" {
+		return n
+	}
+	return "events"
+}
+
+func (v *View) traceProcessName() string {
+	if v.name != "" {
+		return v.name
+	}
+	return "elog"
+}
+
+type traceEventArgs struct {
+	Caller string `json:"caller"`
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type chromeTraceEvent struct {
+	Name  string      `json:"name"`
+	Phase string      `json:"ph"`
+	Time  float64     `json:"ts"`
+	Pid   uint64      `json:"pid"`
+	Tid   uint64      `json:"tid"`
+	Scope string      `json:"s,omitempty"`
+	Args  interface{} `json:"args,omitempty"`
+}
+
+// Split event lines into name (first line) and detail (remaining lines).
+func (v *View) traceEventName(i uint) (name, detail string) {
+	lines := v.EventLines(i)
+	if len(lines) > 0 {
+		name = lines[0]
+		detail = strings.Join(lines[1:], "\n")
+	}
+	return
+}
+
+func (v *View) traceEventArgs(i uint, detail string) traceEventArgs {
+	c := v.EventCaller(i)
+	return traceEventArgs{Caller: c.Name, File: c.File, Line: c.Line, Detail: detail}
+}
+
+// Time of event in nanoseconds since unix epoch.
+func (v *View) traceTimeNsec(e *eventHeader) uint64 { return uint64(v.goTime(e).UnixNano()) }
+
+// WriteChromeTrace writes events in current view in JSON trace event format.
+func (v *View) WriteChromeTrace(w io.Writer) (err error) {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	const pid = 1
+
+	if _, err = io.WriteString(bw, "{\"displayTimeUnit\":\"ns\",\"traceEvents\":[\n"); err != nil {
+		return
+	}
+	add := func(first bool, e *chromeTraceEvent) error {
+		if !first {
+			if _, err := io.WriteString(bw, ","); err != nil {
+				return err
+			}
+		}
+		return enc.Encode(e)
+	}
+	type nameArg struct {
+		Name string `json:"name"`
+	}
+	if err = add(true, &chromeTraceEvent{Name: "process_name", Phase: "M", Pid: pid, Args: nameArg{v.traceProcessName()}}); err != nil {
+		return
+	}
+	for t := uint(0); t < v.NumTracks(); t++ {
+		e := &chromeTraceEvent{Name: "thread_name", Phase: "M", Pid: pid, Tid: uint64(t) + 1, Args: nameArg{v.traceThreadName(t)}}
+		if err = add(false, e); err != nil {
+			return
+		}
+	}
+
+	t0 := v.Times.StartTime
+	for i := uint(0); i < v.NumEvents(); i++ {
+		h := v.Event(i)
+		name, detail := v.traceEventName(i)
+		e := &chromeTraceEvent{
+			Name:  name,
+			Phase: "i",
+			Scope: "t",
+			// Microseconds relative to view start time.
+			Time: 1e6 * v.goTime(h).Sub(t0).Seconds(),
+			Pid:  pid,
+			Tid:  v.traceTid(h),
+			Args: v.traceEventArgs(i, detail),
+		}
+		if err = add(false, e); err != nil {
+			return
+		}
+	}
+	if _, err = io.WriteString(bw, "]}\n"); err != nil {
+		return
+	}
+	return bw.Flush()
+}
+
+// Minimal protobuf encoder for perfetto trace format (protos/perfetto/trace/trace.proto).
+type protoBuf []byte
+
+const (
+	protoVarint = 0
+	protoBytes  = 2
+)
+
+func (b *protoBuf) tag(field, wireType uint) {
+	*b = binary.AppendUvarint(*b, uint64(field<<3|wireType))
+}
+func (b *protoBuf) uint(field uint, x uint64) {
+	b.tag(field, protoVarint)
+	*b = binary.AppendUvarint(*b, x)
+}
+func (b *protoBuf) bytes(field uint, x []byte) {
+	b.tag(field, protoBytes)
+	*b = binary.AppendUvarint(*b, uint64(len(x)))
+	*b = append(*b, x...)
+}
+func (b *protoBuf) string(field uint, x string) { b.bytes(field, []byte(x)) }
+
+// Perfetto field numbers.
+const (
+	perfettoTracePacket = 1
+
+	perfettoPacketTimestamp       = 8
+	perfettoPacketSequenceId      = 10
+	perfettoPacketTrackEvent      = 11
+	perfettoPacketTrackDescriptor = 60
+
+	perfettoTrackUuid    = 1
+	perfettoTrackName    = 2
+	perfettoTrackProcess = 3
+	perfettoTrackThread  = 4
+
+	perfettoProcessPid  = 1
+	perfettoProcessName = 6
+
+	perfettoThreadPid  = 1
+	perfettoThreadTid  = 2
+	perfettoThreadName = 5
+
+	perfettoEventAnnotation = 4
+	perfettoEventType       = 9
+	perfettoEventTrackUuid  = 11
+	perfettoEventName       = 23
+	perfettoEventInstant    = 3
+
+	perfettoAnnotationString = 6
+	perfettoAnnotationName   = 10
+)
+
+// WritePerfetto writes events in current view in perfetto protobuf trace format.
+func (v *View) WritePerfetto(w io.Writer) (err error) {
+	bw := bufio.NewWriter(w)
+	const (
+		pid        = 1
+		sequenceId = 1
+		// Track uuid for process; thread tracks use uuid pid<<32 | tid.
+		processUuid = pid << 32
+	)
+	var p, q, r protoBuf
+	writePacket := func() error {
+		var t protoBuf
+		t.bytes(perfettoTracePacket, p)
+		_, err := bw.Write(t)
+		p = p[:0]
+		return err
+	}
+
+	q = q[:0]
+	q.uint(perfettoProcessPid, pid)
+	q.string(perfettoProcessName, v.traceProcessName())
+	r = r[:0]
+	r.uint(perfettoTrackUuid, processUuid)
+	r.bytes(perfettoTrackProcess, q)
+	p.bytes(perfettoPacketTrackDescriptor, r)
+	if err = writePacket(); err != nil {
+		return
+	}
+	for t := uint(0); t < v.NumTracks(); t++ {
+		tid := uint64(t) + 1
+		q = q[:0]
+		q.uint(perfettoThreadPid, pid)
+		q.uint(perfettoThreadTid, tid)
+		q.string(perfettoThreadName, v.traceThreadName(t))
+		r = r[:0]
+		r.uint(perfettoTrackUuid, processUuid|tid)
+		r.bytes(perfettoTrackThread, q)
+		p.bytes(perfettoPacketTrackDescriptor, r)
+		if err = writePacket(); err != nil {
+			return
+		}
+	}
+
+	annotation := func(e *protoBuf, name, value string) {
+		r = r[:0]
+		r.string(perfettoAnnotationName, name)
+		r.string(perfettoAnnotationString, value)
+		e.bytes(perfettoEventAnnotation, r)
+	}
+	for i := uint(0); i < v.NumEvents(); i++ {
+		h := v.Event(i)
+		name, detail := v.traceEventName(i)
+		a := v.traceEventArgs(i, detail)
+		q = q[:0]
+		q.uint(perfettoEventType, perfettoEventInstant)
+		q.uint(perfettoEventTrackUuid, processUuid|v.traceTid(h))
+		q.string(perfettoEventName, name)
+		annotation(&q, "caller", a.Caller)
+		annotation(&q, "file", fmt.Sprintf("%s:%d", a.File, a.Line))
+		if detail != "" {
+			annotation(&q, "detail", detail)
+		}
+		p.uint(perfettoPacketTimestamp, v.traceTimeNsec(h))
+		p.uint(perfettoPacketSequenceId, sequenceId)
+		p.bytes(perfettoPacketTrackEvent, q)
+		if err = writePacket(); err != nil {
+			return
+		}
+	}
+	return bw.Flush()
+}
+
+func (v *View) writeFile(file string, f func(w io.Writer) error) (err error) {
+	var o *os.File
+	if o, err = os.Create(file); err != nil {
+		return
+	}
+	if err = f(o); err != nil {
+		o.Close()
+		return
+	}
+	return o.Close()
+}
+
+func (v *View) SaveChromeTraceFile(file string) error { return v.writeFile(file, v.WriteChromeTrace) }
+func (v *View) SavePerfettoFile(file string) error    { return v.writeFile(file, v.WritePerfetto) }
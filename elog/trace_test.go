@@ -0,0 +1,193 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+type testEvent struct{ i uint32 }
+
+// Decoded protobuf field: varint value x or length delimited bytes b.
+type testProtoField struct {
+	field uint
+	x     uint64
+	b     []byte
+}
+
+func decodeProto(t *testing.T, b []byte) (fs []testProtoField) {
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("bad protobuf tag")
+		}
+		b = b[n:]
+		f := testProtoField{field: uint(tag >> 3)}
+		x, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("bad protobuf field %d", f.field)
+		}
+		b = b[n:]
+		switch tag & 7 {
+		case protoVarint:
+			f.x = x
+		case protoBytes:
+			if x > uint64(len(b)) {
+				t.Fatalf("short protobuf field %d", f.field)
+			}
+			f.b, b = b[:x], b[x:]
+		default:
+			t.Fatalf("unexpected wire type %d", tag&7)
+		}
+		fs = append(fs, f)
+	}
+	return
+}
+
+// Returns single field with given number.
+func protoField(t *testing.T, fs []testProtoField, field uint) testProtoField {
+	var r []testProtoField
+	for _, f := range fs {
+		if f.field == field {
+			r = append(r, f)
+		}
+	}
+	if len(r) != 1 {
+		t.Fatalf("%d fields %d in %v", len(r), field, fs)
+	}
+	return r[0]
+}
+
+func (e *testEvent) Elog(l *Log) { l.Logf("test %d\ndetail %d", e.i, e.i) }
+
+func TestChromeTrace(t *testing.T) {
+	if !Enabled() {
+		t.Skip("event log disabled; build with -tags elog")
+	}
+	Enable(true)
+	Clear()
+	track := NewTrack("node-a")
+	for i := 0; i < 10; i++ {
+		e := testEvent{i: uint32(i)}
+		if i%2 == 0 {
+			Add(&e)
+		} else {
+			AddTrack(&e, track)
+		}
+	}
+	v := NewView()
+
+	// Tracks must survive save and restore.
+	var b bytes.Buffer
+	if err := v.Save(&b); err != nil {
+		t.Fatal(err)
+	}
+	var r View
+	if err := r.Restore(&b); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.TrackName(track); got != "node-a" {
+		t.Fatalf("track name %q", got)
+	}
+
+	b.Reset()
+	if err := r.WriteChromeTrace(&b); err != nil {
+		t.Fatal(err)
+	}
+	var trace struct {
+		TraceEvents []chromeTraceEvent
+	}
+	if err := json.Unmarshal(b.Bytes(), &trace); err != nil {
+		t.Fatalf("%v\n%s", err, b.String())
+	}
+	n, threads := 0, map[uint64]string{}
+	for _, e := range trace.TraceEvents {
+		switch e.Phase {
+		case "M":
+			if e.Name == "thread_name" {
+				threads[e.Tid] = e.Args.(map[string]interface{})["name"].(string)
+			}
+		case "i":
+			n++
+		}
+	}
+	if n != 10 {
+		t.Fatalf("%d events in trace", n)
+	}
+	if threads[uint64(track)+1] != "node-a" {
+		t.Fatalf("threads %v", threads)
+	}
+
+	b.Reset()
+	if err := r.WritePerfetto(&b); err != nil || b.Len() == 0 {
+		t.Fatalf("perfetto: %v %d bytes", err, b.Len())
+	}
+	packets := decodeProto(t, b.Bytes())
+	if len(packets) < 2+int(r.NumTracks()) {
+		t.Fatalf("%d perfetto packets", len(packets))
+	}
+	// First packet describes process track.
+	d := decodeProto(t, protoField(t, decodeProto(t, packets[0].b), perfettoPacketTrackDescriptor).b)
+	if uuid := protoField(t, d, perfettoTrackUuid).x; uuid != 1<<32 {
+		t.Fatalf("process track uuid %x", uuid)
+	}
+	pr := decodeProto(t, protoField(t, d, perfettoTrackProcess).b)
+	if pid := protoField(t, pr, perfettoProcessPid).x; pid != 1 {
+		t.Fatalf("process pid %d", pid)
+	}
+	if name := string(protoField(t, pr, perfettoProcessName).b); name != r.traceProcessName() {
+		t.Fatalf("process name %q", name)
+	}
+	// Thread tracks follow.
+	d = decodeProto(t, protoField(t, decodeProto(t, packets[1+track].b), perfettoPacketTrackDescriptor).b)
+	th := decodeProto(t, protoField(t, d, perfettoTrackThread).b)
+	if name := string(protoField(t, th, perfettoThreadName).b); name != "node-a" {
+		t.Fatalf("thread name %q", name)
+	}
+}
+
+func TestHTML(t *testing.T) {
+	if !Enabled() {
+		t.Skip("event log disabled; build with -tags elog")
+	}
+	Enable(true)
+	Clear()
+	track := NewTrack("node-b")
+	for i := 0; i < 10; i++ {
+		F1u("html </script> %d", uint64(i))
+		e := testEvent{i: uint32(i)}
+		AddTrack(&e, track)
+	}
+	var b bytes.Buffer
+	if err := NewView().WriteHTML(&b, &HTMLOptions{SourceURL: "vscode://file/%f:%l"}); err != nil {
+		t.Fatal(err)
+	}
+	s := b.String()
+	// Event text must not end script elements early.
+	if n := strings.Count(s, "</script>"); n != 2 {
+		t.Fatalf("%d script ends", n)
+	}
+	const prefix = "<script>const elogData = "
+	i := strings.Index(s, prefix)
+	if i < 0 {
+		t.Fatal("no data")
+	}
+	s = s[i+len(prefix):]
+	j := strings.Index(s, ";</script>")
+	var d htmlData
+	if err := json.Unmarshal([]byte(s[:j]), &d); err != nil {
+		t.Fatalf("%v: %s", err, s[:j])
+	}
+	if len(d.Events) != 20 || len(d.Callers) != 2 || d.Tracks[track] != "node-b" || d.SourceURL != "vscode://file/%f:%l" {
+		t.Fatalf("%d events %d callers tracks %v", len(d.Events), len(d.Callers), d.Tracks)
+	}
+	if txt := d.Events[0][3].(string); txt != "html </script> 0" {
+		t.Fatalf("event text %q", txt)
+	}
+}
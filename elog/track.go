@@ -6,25 +6,121 @@ package elog
 
 import (
 	"fmt"
+	"sync"
 )
 
 type EventTrack struct {
-	Name  string
+	Name string
+	// Host events came from for views merged from several hosts; empty otherwise.
+	Host  string
 	index uint32
 }
 
+// Track 0 is default track for events added without a track.
 type eventTrackShared struct {
+	trackMu     sync.Mutex
 	trackByName map[string]*EventTrack
 	tracks      []*EventTrack
 }
 
-func (s *eventTrackShared) AddTrack(format string, args ...interface{}) uint32 {
-	t := &EventTrack{Name: fmt.Sprintf(format, args...)}
+// NewTrack returns index of track with given name for use with AddTrack.
+// Tracks with same name share index.
+func (s *eventTrackShared) NewTrack(format string, args ...interface{}) uint {
+	name := fmt.Sprintf(format, args...)
+	s.trackMu.Lock()
+	defer s.trackMu.Unlock()
+	if t, ok := s.trackByName[name]; ok {
+		return uint(t.index)
+	}
+	s.addTrack("")
+	return uint(s.addTrack(name).index)
+}
+
+func (s *eventTrackShared) addTrack(name string) (t *EventTrack) { return s.addHostTrack("", name) }
+
+// Tracks with same name from different hosts are distinct.
+func trackKey(host, name string) string {
+	if host == "" {
+		return name
+	}
+	return host + "\x00" + name
+}
+
+func (s *eventTrackShared) addHostTrack(host, name string) (t *EventTrack) {
 	if s.trackByName == nil {
 		s.trackByName = make(map[string]*EventTrack)
 	}
-	s.trackByName[t.Name] = t
-	t.index = uint32(len(s.tracks))
+	k := trackKey(host, name)
+	if t = s.trackByName[k]; t != nil {
+		return
+	}
+	t = &EventTrack{Name: name, Host: host, index: uint32(len(s.tracks))}
+	s.trackByName[k] = t
 	s.tracks = append(s.tracks, t)
-	return t.index
+	return
+}
+
+// TrackName returns name of track with given index or empty string for default track.
+func (s *eventTrackShared) TrackName(i uint) string {
+	if i < uint(len(s.tracks)) {
+		return s.tracks[i].Name
+	}
+	return ""
+}
+
+// TrackHost returns host of track with given index or empty string if view is not merged from several hosts.
+func (s *eventTrackShared) TrackHost(i uint) string {
+	if i < uint(len(s.tracks)) {
+		return s.tracks[i].Host
+	}
+	return ""
+}
+
+// TrackLabel returns track name prefixed with its host if any.
+func (s *eventTrackShared) TrackLabel(i uint) string {
+	name, host := s.TrackName(i), s.TrackHost(i)
+	switch {
+	case host == "":
+		return name
+	case name == "":
+		return host
+	}
+	return host + ": " + name
+}
+
+// Hosts returns hosts of tracks in order of first appearance.
+func (s *eventTrackShared) Hosts() (hosts []string) {
+	seen := make(map[string]bool)
+	for _, t := range s.tracks {
+		if t.Host != "" && !seen[t.Host] {
+			seen[t.Host] = true
+			hosts = append(hosts, t.Host)
+		}
+	}
+	return
+}
+
+// NumTracks returns number of tracks including default track.
+func (s *eventTrackShared) NumTracks() uint {
+	if n := uint(len(s.tracks)); n > 0 {
+		return n
+	}
+	return 1
+}
+
+func (dst *eventTrackShared) copyFrom(src *eventTrackShared) {
+	src.trackMu.Lock()
+	defer src.trackMu.Unlock()
+	dst.trackByName = nil
+	dst.tracks = nil
+	for _, t := range src.tracks {
+		dst.addHostTrack(t.Host, t.Name)
+	}
+}
+
+func NewTrack(format string, args ...interface{}) uint {
+	return DefaultBuffer.NewTrack(format, args...)
+}
+func AddTrack(d Logger, t uint) {
+	DefaultBuffer.AddTrack(d, DefaultBuffer.GetCaller(PointerToFirstArg(&d)), t)
 }
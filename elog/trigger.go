@@ -0,0 +1,341 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elog
+
+import (
+	"github.com/platinasystems/elib"
+
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Triggers implement a flight recorder: when a trigger fires logging is stopped (or a snapshot view
+// is taken) once a given number of post-trigger events have been logged, so that buffer holds a
+// window of events around the trigger.  Triggers fire on events from callers matching a regexp
+// (as with event filters) or on named conditions such as "panic" or "cli" fired with FireTrigger.
+
+type TriggerAction uint8
+
+const (
+	// Stop logging after post-trigger window.
+	TriggerStop TriggerAction = iota
+	// Take snapshot view of window around trigger and continue logging.
+	TriggerSnapshot
+)
+
+func (a TriggerAction) String() string {
+	if a == TriggerSnapshot {
+		return "snapshot"
+	}
+	return "stop"
+}
+
+type Trigger struct {
+	Name string
+	// Regexp matching caller function names; events from matching callers fire trigger.
+	Matching string
+	// Condition name (e.g. "panic") fired with FireTrigger.
+	On string
+	// Number of events to keep before and after trigger.
+	Pre, Post uint
+	Action    TriggerAction
+	// For snapshots: file to save view to (with %d replaced by count) and/or function to call.
+	File string
+	F    func(t *Trigger, v *View)
+	// Re-arm after each snapshot; otherwise trigger fires once until re-armed.
+	Repeat bool
+
+	re    *regexp.Regexp
+	armed atomic.Bool
+	// Number of times trigger has fired.
+	count atomic.Uint32
+	// Most recent snapshot.
+	last atomic.Pointer[View]
+}
+
+func (t *Trigger) Count() uint     { return uint(t.count.Load()) }
+func (t *Trigger) Armed() bool     { return t.armed.Load() }
+func (t *Trigger) Arm()            { t.armed.Store(true) }
+func (t *Trigger) LastView() *View { return t.last.Load() }
+
+func (t *Trigger) String() string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "%s:", t.Name)
+	if t.Matching != "" {
+		fmt.Fprintf(&s, " matching %s", t.Matching)
+	}
+	if t.On != "" {
+		fmt.Fprintf(&s, " on %s", t.On)
+	}
+	fmt.Fprintf(&s, " pre %d post %d %v", t.Pre, t.Post, t.Action)
+	if t.File != "" {
+		fmt.Fprintf(&s, " %s", t.File)
+	}
+	return s.String()
+}
+
+type triggerMain struct {
+	triggers      []*Trigger
+	triggerByName map[string]*Trigger
+
+	// Snapshots waiting for post-trigger events.
+	snapshots sync.WaitGroup
+	// Set by FlushTriggers to take snapshots without waiting for rest of post-trigger window.
+	flushSnapshots atomic.Bool
+}
+
+var (
+	ErrTriggerNotFound = errors.New("event log trigger not found")
+	errTriggerNoSource = errors.New("event log trigger needs caller regexp or condition name")
+)
+
+// AddTrigger adds (or replaces trigger with same name) and arms it.
+// Post is reduced so that pre and post windows fit in buffer and, for stop triggers,
+// to the most events DisableAfter will wait for.
+func (b *Buffer) AddTrigger(t *Trigger) (err error) {
+	if t.Matching == "" && t.On == "" {
+		return errTriggerNoSource
+	}
+	if t.Matching != "" {
+		if t.re, err = regexp.Compile(t.Matching); err != nil {
+			return
+		}
+	}
+	if c := uint(b.Cap()); t.Pre > c {
+		t.Pre = c
+	}
+	if max := uint(b.Cap()) - t.Pre; t.Post > max {
+		t.Post = max
+	}
+	if max := uint(b.maxDisableAfter()); t.Action == TriggerStop && t.Post > max {
+		t.Post = max
+	}
+	t.Arm()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.delTrigger(t.Name)
+	b.triggers = append(b.triggers, t)
+	if b.triggerByName == nil {
+		b.triggerByName = make(map[string]*Trigger)
+	}
+	b.triggerByName[t.Name] = t
+	b.updateCallerTriggers()
+	return
+}
+func AddTrigger(t *Trigger) error { return DefaultBuffer.AddTrigger(t) }
+
+func (b *Buffer) delTrigger(name string) (ok bool) {
+	var t *Trigger
+	if t, ok = b.triggerByName[name]; !ok {
+		return
+	}
+	delete(b.triggerByName, name)
+	for i := range b.triggers {
+		if b.triggers[i] == t {
+			b.triggers = append(b.triggers[:i], b.triggers[i+1:]...)
+			break
+		}
+	}
+	return
+}
+
+func (b *Buffer) DelTrigger(name string) (err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.delTrigger(name) {
+		return ErrTriggerNotFound
+	}
+	b.updateCallerTriggers()
+	return
+}
+func DelTrigger(name string) error { return DefaultBuffer.DelTrigger(name) }
+
+// GetTrigger returns trigger with given name or nil.
+func (b *Buffer) GetTrigger(name string) *Trigger {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.triggerByName[name]
+}
+func GetTrigger(name string) *Trigger { return DefaultBuffer.GetTrigger(name) }
+
+// Triggers matching caller; called with lock held.
+func (b *Buffer) callerTriggers(ci *CallerInfo) (ts []*Trigger) {
+	for _, t := range b.triggers {
+		if t.re != nil && ci.Match(t.re) {
+			ts = append(ts, t)
+		}
+	}
+	return
+}
+
+func (c *callerCache) setTriggers(ts []*Trigger) {
+	if len(ts) == 0 {
+		c.triggers.Store(nil)
+	} else {
+		c.triggers.Store(&ts)
+	}
+}
+
+func (b *Buffer) updateCallerTriggers() {
+	for _, c := range b.callers {
+		c.setTriggers(b.callerTriggers(&c.callerInfo))
+	}
+}
+
+// FireTrigger fires armed triggers with given condition name.
+func (b *Buffer) FireTrigger(on string) (n uint) {
+	b.mu.RLock()
+	var ts []*Trigger
+	for _, t := range b.triggers {
+		if t.On == on {
+			ts = append(ts, t)
+		}
+	}
+	b.mu.RUnlock()
+	for _, t := range ts {
+		if b.fire(t, 0) {
+			n++
+		}
+	}
+	return
+}
+func FireTrigger(on string) uint { return DefaultBuffer.FireTrigger(on) }
+
+func (b *Buffer) fireCallerTriggers(ts []*Trigger, time uint64) {
+	for _, t := range ts {
+		b.fire(t, time)
+	}
+}
+
+// Fire trigger at given cpu time (or now if zero).
+func (b *Buffer) fire(t *Trigger, tm uint64) bool {
+	if !t.armed.CompareAndSwap(true, false) {
+		return false
+	}
+	n := t.count.Add(1)
+	if tm == 0 {
+		var c Caller
+		c.SetTimeNow()
+		tm = c.time
+	}
+	switch t.Action {
+	case TriggerStop:
+		b.DisableAfter(uint64(t.Post))
+	case TriggerSnapshot:
+		b.snapshots.Add(1)
+		go b.snapshot(t, n, tm, b.GetSequence())
+	}
+	return true
+}
+
+// Longest time to wait for post-trigger events before taking snapshot anyway.
+const triggerSnapshotTimeout = 10 * time.Second
+
+// Wait for post-trigger window then take snapshot.
+func (b *Buffer) snapshot(t *Trigger, n uint32, tm, seq uint64) {
+	defer b.snapshots.Done()
+	d := 100 * time.Microsecond
+	for start := time.Now(); b.GetSequence() < seq+uint64(t.Post) && time.Since(start) < triggerSnapshotTimeout && !b.flushSnapshots.Load(); {
+		time.Sleep(d)
+		if d < 10*time.Millisecond {
+			d *= 2
+		}
+	}
+	v := b.NewView()
+	v.window(tm, t.Pre, t.Post)
+	t.last.Store(v)
+	if t.File != "" {
+		file := t.File
+		if strings.Contains(file, "%d") {
+			file = fmt.Sprintf(file, n)
+		}
+		v.SaveFile(file)
+	}
+	if t.F != nil {
+		t.F(t, v)
+	}
+	if t.Repeat {
+		t.Arm()
+	}
+}
+
+// FlushTriggers takes pending trigger snapshots now, without waiting for the rest of their
+// post-trigger windows, and waits until they are saved.  Called before exiting so that
+// snapshots (e.g. of "panic" trigger) are not lost.
+func (b *Buffer) FlushTriggers() {
+	b.flushSnapshots.Store(true)
+	b.snapshots.Wait()
+	b.flushSnapshots.Store(false)
+}
+func FlushTriggers() { DefaultBuffer.FlushTriggers() }
+
+// Restrict view to pre events before and post events at or after cpu time tm.
+func (v *View) window(tm uint64, pre, post uint) {
+	es := v.allBufferEvents
+	i := 0
+	for i < len(es) && es[i].timestamp < tm {
+		i++
+	}
+	lo, hi := 0, len(es)
+	if i > int(pre) {
+		lo = i - int(pre)
+	}
+	if i+int(post) < hi {
+		hi = i + int(post)
+	}
+	v.allBufferEvents = es[lo:hi]
+	v.currentBufferEvents = v.allBufferEvents
+	v.Times = viewTimes{}
+	v.getViewTimes()
+}
+
+// Re-arm all triggers; called when logging is enabled.
+func (b *Buffer) rearmTriggers() {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, t := range b.triggers {
+		t.Arm()
+	}
+}
+
+func (b *Buffer) PrintTriggers(w io.Writer) {
+	type row struct {
+		Name   string `format:"%-16s"`
+		Source string `format:"%-30s"`
+		Window string `format:" %12s"`
+		Action string `format:" %10s"`
+		Armed  bool   `format:" %6v"`
+		Count  uint   `format:" %8d"`
+	}
+	b.mu.RLock()
+	var rs []row
+	for _, t := range b.triggers {
+		src := "on " + t.On
+		if t.Matching != "" {
+			src = t.Matching
+		}
+		rs = append(rs, row{
+			Name:   t.Name,
+			Source: src,
+			Window: fmt.Sprintf("%d/%d", t.Pre, t.Post),
+			Action: t.Action.String(),
+			Armed:  t.Armed(),
+			Count:  t.Count(),
+		})
+	}
+	b.mu.RUnlock()
+	if len(rs) > 0 {
+		elib.TabulateWrite(w, rs)
+	} else {
+		fmt.Fprintln(w, "no triggers")
+	}
+}
+func PrintTriggers(w io.Writer) { DefaultBuffer.PrintTriggers(w) }
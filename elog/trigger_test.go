@@ -0,0 +1,201 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elog
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// Not inlined so that events have distinct callers.
+//
+//go:noinline
+func triggerTestEvent(b *Buffer, i uint64) { b.F1u("trigger event %d", i) }
+
+//go:noinline
+func triggerTestFault(b *Buffer) { b.F("trigger fault") }
+
+func TestTrigger(t *testing.T) {
+	if !Enabled() {
+		t.Skip("event log disabled; build with -tags elog")
+	}
+	b := New(10)
+	b.Enable(true)
+	if err := b.AddTrigger(&Trigger{Name: "fault", Matching: "triggerTestFault$", Pre: 10, Post: 20}); err != nil {
+		t.Fatal(err)
+	}
+	i := uint64(0)
+	log := func(n int) {
+		for ; n > 0; n-- {
+			triggerTestEvent(b, i)
+			i++
+		}
+	}
+	log(100)
+	triggerTestFault(b)
+	log(100)
+	if tr := b.GetTrigger("fault"); tr.Count() != 1 || tr.Armed() {
+		t.Fatalf("trigger %v count %d armed %v", tr, tr.Count(), tr.Armed())
+	}
+	// Pre-trigger events, fault event and post-trigger events.
+	if n := b.GetSequence(); n != 100+1+20 {
+		t.Fatalf("logging stopped after %d events", n)
+	}
+	v := b.NewView()
+	v.window(v.allBufferEvents[100].timestamp, 10, 20)
+	if n := v.NumEvents(); n != 30 {
+		t.Fatalf("window has %d events", n)
+	}
+	if l := v.EventLines(0)[0]; l != "trigger event 90" {
+		t.Fatalf("first event %q", l)
+	}
+	if l := v.EventLines(10)[0]; l != "trigger fault" {
+		t.Fatalf("trigger event %q", l)
+	}
+
+	// Enabling logging resets buffer and re-arms.
+	b.Enable(true)
+	if !b.GetTrigger("fault").Armed() {
+		t.Fatal("not re-armed")
+	}
+	if err := b.DelTrigger("fault"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.DelTrigger("fault"); err != ErrTriggerNotFound {
+		t.Fatalf("delete: %v", err)
+	}
+	// Stop trigger window is limited to what DisableAfter honors.
+	tr := &Trigger{Name: "big", Matching: "triggerTestFault$", Post: uint(b.Cap())}
+	if err := b.AddTrigger(tr); err != nil {
+		t.Fatal(err)
+	}
+	if tr.Post != uint(b.Cap())/2 {
+		t.Fatalf("post %d", tr.Post)
+	}
+	if err := b.DelTrigger("big"); err != nil {
+		t.Fatal(err)
+	}
+	triggerTestFault(b)
+	log(100)
+	if n := b.GetSequence(); n != 101 {
+		t.Fatalf("sequence %d after trigger deleted", n)
+	}
+}
+
+func TestFlushTriggers(t *testing.T) {
+	if !Enabled() {
+		t.Skip("event log disabled; build with -tags elog")
+	}
+	b := New(10)
+	b.Enable(true)
+	if err := b.AddTrigger(&Trigger{Name: "exit", On: "exit", Pre: 10, Post: 100, Action: TriggerSnapshot}); err != nil {
+		t.Fatal(err)
+	}
+	for i := uint64(0); i < 20; i++ {
+		triggerTestEvent(b, i)
+	}
+	b.FireTrigger("exit")
+	// Post-trigger window never fills: flush must not wait for it.
+	start := time.Now()
+	b.FlushTriggers()
+	if dt := time.Since(start); dt >= triggerSnapshotTimeout {
+		t.Fatalf("flush took %v", dt)
+	}
+	v := b.GetTrigger("exit").LastView()
+	if v == nil {
+		t.Fatal("no snapshot after flush")
+	}
+	if n := v.NumEvents(); n != 10 {
+		t.Fatalf("snapshot has %d events", n)
+	}
+}
+
+func TestTriggerSnapshot(t *testing.T) {
+	if !Enabled() {
+		t.Skip("event log disabled; build with -tags elog")
+	}
+	b := New(10)
+	b.Enable(true)
+	views := make(chan *View, 2)
+	tr := &Trigger{
+		Name:   "snap",
+		On:     "test",
+		Pre:    5,
+		Post:   8,
+		Action: TriggerSnapshot,
+		Repeat: true,
+		F:      func(t *Trigger, v *View) { views <- v },
+	}
+	if err := b.AddTrigger(tr); err != nil {
+		t.Fatal(err)
+	}
+	if n := b.FireTrigger("other"); n != 0 {
+		t.Fatalf("fired %d triggers", n)
+	}
+	i := uint64(0)
+	for round := 0; round < 2; round++ {
+		for j := 0; j < 20; j++ {
+			triggerTestEvent(b, i)
+			i++
+		}
+		if n := b.FireTrigger("test"); n != 1 {
+			t.Fatalf("fired %d triggers", n)
+		}
+		for j := 0; j < 20; j++ {
+			triggerTestEvent(b, i)
+			i++
+		}
+		var v *View
+		select {
+		case v = <-views:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no snapshot")
+		}
+		if n := v.NumEvents(); n != 13 {
+			t.Fatalf("snapshot has %d events", n)
+		}
+		if l, e := v.EventLines(0)[0], fmt.Sprintf("trigger event %d", 40*round+15); l != e {
+			t.Fatalf("first event %q, expected %q", l, e)
+		}
+		// Wait for re-arm after function returns.
+		for !tr.Armed() {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if tr.Count() != 2 || tr.LastView() == nil {
+		t.Fatalf("count %d", tr.Count())
+	}
+	// Logging continues after snapshots.
+	if n := b.GetSequence(); n != 80 {
+		t.Fatalf("sequence %d", n)
+	}
+}
+
+// Triggers added and deleted while another goroutine logs from matching caller.
+func TestTriggerUpdateWhileLogging(t *testing.T) {
+	if !Enabled() {
+		t.Skip("event log disabled; build with -tags elog")
+	}
+	b := New(12)
+	b.Enable(true)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := uint64(0); i < 10000; i++ {
+			triggerTestEvent(b, i)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		tr := &Trigger{Name: "update", Matching: "triggerTestEvent$", Action: TriggerSnapshot, Post: 1, Repeat: true}
+		if err := b.AddTrigger(tr); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.DelTrigger("update"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+}
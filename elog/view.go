@@ -24,12 +24,21 @@ type View struct {
 	currentBufferEvents []bufferEvent
 	allBufferEvents     bufferEventVec
 	name                string
-	Times               viewTimes
+	// Host view was made on.
+	host string
+	// Compress sections when saved.
+	compress bool
+	Times    viewTimes
 	shared
 }
 
 func (v *View) SetName(name string) { v.name = name }
 func (v *View) Name() string        { return v.name }
+func (v *View) SetHost(host string) { v.host = host }
+func (v *View) Host() string        { return v.host }
+
+// SetCompress sets whether view is saved with compressed sections.
+func (v *View) SetCompress(c bool) { v.compress = c }
 
 func (v *View) numEvents(all bool) (l uint) {
 	if v.allBufferEvents != nil {
@@ -80,27 +89,23 @@ func (v *View) EventCaller(i uint) (c *CallerInfo) {
 	return
 }
 
-func (b *Buffer) NewView() (v *View) {
+// View with buffer's header, callers, strings and tracks but no events.
+func (b *Buffer) newView() (v *View) {
 	v = &View{}
-
+	v.host, _ = os.Hostname()
 	v.shared.sharedHeader = b.shared.sharedHeader
 	v.shared.stringTable.copyFrom(&b.shared.stringTable)
 	v.shared.eventFilterShared.copyFrom(&b.shared.eventFilterShared)
+	v.shared.eventTrackShared.copyFrom(&b.shared.eventTrackShared)
+	return
+}
 
-	l := len(v.currentBufferEvents)
-	cap := b.Cap()
-	mask := b.capMask()
-	v.allBufferEvents.Resize(uint(cap))
-	i := int(b.lockIndex(true))
-	if i >= cap {
-		l += copy(v.allBufferEvents[l:], b.events[i&mask:])
-	}
-	l += copy(v.allBufferEvents[l:], b.events[0:i&mask])
-	b.lockIndex(false)
-	v.allBufferEvents = v.allBufferEvents[:l]
+// Set view's events and sort them by time.
+func (v *View) setBufferEvents(es bufferEventVec) {
+	v.allBufferEvents = es
 	v.currentBufferEvents = v.allBufferEvents
 
-	// Event ordering is not guaranteed due to GetCaller().
+	// Event ordering is not guaranteed due to GetCaller() and sharding.
 	// So we sort events by time.
 	sort.Slice(v.allBufferEvents, func(i, j int) bool {
 		ei, ej := &v.allBufferEvents[i], &v.allBufferEvents[j]
@@ -108,6 +113,23 @@ func (b *Buffer) NewView() (v *View) {
 	})
 
 	v.getViewTimes()
+}
+
+func (b *Buffer) NewView() (v *View) {
+	v = b.newView()
+	var es bufferEventVec
+	if ss := b.shards.Load(); ss != nil {
+		es = make(bufferEventVec, 0, ss.len())
+		ss.foreach(func(s *bufferShard, i uint64) {
+			es = appendRing(es, s.events, int(i))
+		})
+	} else {
+		es = make(bufferEventVec, 0, b.Cap())
+		i := int(b.lockIndex(true))
+		es = appendRing(es, b.events, i)
+		b.lockIndex(false)
+	}
+	v.setBufferEvents(es)
 	return
 }
 
@@ -380,6 +402,8 @@ type viewEvents struct {
 	allViewEvents     []viewEvent
 	b                 elib.ByteVec
 	args              []interface{}
+	// Cache of parsed structured event field records.
+	fieldsByFormat map[string][]Field
 }
 
 func (v *viewEvents) viewEventLines(l *Log, ei uint) []string {
@@ -396,6 +420,7 @@ func (v *viewEvents) viewEventLines(l *Log, ei uint) []string {
 		x, n := binary.Uvarint(b[i:])
 		i += n
 		format := l.s.GetString(StringRef(x))
+		isFields := isFieldsFormat(format)
 
 		for {
 			var (
@@ -403,7 +428,9 @@ func (v *viewEvents) viewEventLines(l *Log, ei uint) []string {
 				kind byte
 			)
 			if a, kind, i = l.s.decodeArg(b, i); kind == fmtEnd {
-				l.sprintf(format, v.args...)
+				if !isFields {
+					l.sprintf(format, v.args...)
+				}
 				break
 			} else {
 				v.args = append(v.args, a)
@@ -428,6 +455,7 @@ func (v *viewEvents) convertBufferEvent(l *Log, e *bufferEvent) {
 	}
 	r := l.s.callers[e.callerIndex]
 	e.format(r, l)
+	i = v.encodeFields(l.s, e, i)
 	var ve viewEvent
 	ve.eventHeader = e.eventHeader
 	ve.lo = uint32(lo)
@@ -445,3 +473,6 @@ func (v *View) convertBufferEvents() {
 	v.currentViewEvents = v.allViewEvents
 	return
 }
+
+// EventHost returns host of event with given index for views merged from several hosts.
+func (v *View) EventHost(i uint) string { return v.TrackHost(uint(v.Event(i).trackIndex)) }
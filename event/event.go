@@ -23,62 +23,157 @@ type TimedActor interface {
 
 //go:generate gentemplate -d Package=event -id actor  -d VecType=ActorVec -d Type=Actor github.com/platinasystems/elib/vec.tmpl
 
-func (p *timedEventPool) Compare(i, j int) int {
-	ei, ej := p.events[i], p.events[j]
-	return int(ei.EventTime() - ej.EventTime())
-}
-
 //go:generate gentemplate -d Package=event -id timedEvent -d PoolType=timedEventPool -d Type=TimedActor -d Data=events github.com/platinasystems/elib/pool.tmpl
 
+// Time each event is scheduled for indexed by pool index.
+type eventTimes []cpu.Time
+
+func (ts eventTimes) Compare(i, j int) int {
+	ti, tj := ts[i], ts[j]
+	switch {
+	case ti < tj:
+		return -1
+	case ti > tj:
+		return 1
+	default:
+		return 0
+	}
+}
+
 type Pool struct {
-	mu      sync.Mutex
-	pool    timedEventPool
+	mu    sync.Mutex
+	pool  timedEventPool
+	times eventTimes
+	// Events are kept either in fibonacci heap (default) or timing wheel.
 	fibheap elib.FibHeap
+	wheel   *wheel
+	expired []uint32
+}
+
+// UseTimingWheel selects a hierarchical timing wheel with ticks of 2^log2Tick cpu cycles
+// instead of the default heap.  Insert and cancel become O(1) which is better for large numbers
+// of timers.  Events expiring within the same tick are still run in time order.
+// Must be called before any events are added.
+func (p *Pool) UseTimingWheel(log2Tick uint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pool.Elts() != 0 {
+		panic("event pool not empty")
+	}
+	p.wheel = &wheel{log2Tick: log2Tick}
 }
 
 func (p *Pool) Elts() uint { return p.pool.Elts() }
 
+func (p *Pool) insert(ei uint) {
+	if p.wheel != nil {
+		p.wheel.insert(ei, p.times[ei])
+	} else {
+		p.fibheap.Add(ei)
+	}
+}
+
 func (p *Pool) Add(e TimedActor) (ei uint) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	ei = p.pool.GetIndex()
 	p.pool.events[ei] = e
-	p.fibheap.Add(ei)
+	for uint(len(p.times)) <= ei {
+		p.times = append(p.times, 0)
+	}
+	p.times[ei] = e.EventTime()
+	p.insert(ei)
 	return ei
 }
 
 func (p *Pool) del(ei uint) {
-	p.fibheap.Del(ei)
+	if p.wheel != nil {
+		p.wheel.remove(ei)
+	} else {
+		p.fibheap.Del(ei)
+	}
+	p.pool.events[ei] = nil
 	p.pool.PutIndex(ei)
 }
 
+// Cancel removes event with given index returned by Add.  Returns false if event has already
+// been run or canceled.
+func (p *Pool) Cancel(ei uint) (ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ok = !p.pool.IsFree(ei); ok {
+		p.del(ei)
+	}
+	return
+}
+
+// Reschedule changes time of event with given index to t.
+// Event's EventTime is no longer consulted; event will run at time t.
+func (p *Pool) Reschedule(ei uint, t cpu.Time) (ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pool.IsFree(ei) {
+		return
+	}
+	ok = true
+	old := p.times[ei]
+	p.times[ei] = t
+	switch {
+	case p.wheel != nil:
+		p.wheel.remove(ei)
+		p.wheel.insert(ei, t)
+	case t < old:
+		p.fibheap.DecreaseKey(ei, p.times)
+	case t > old:
+		p.fibheap.Update(ei)
+	}
+	return
+}
+
+func (p *Pool) run(e TimedActor, iv *ActorVec) {
+	if iv != nil {
+		*iv = append(*iv, e)
+	} else {
+		e.EventAction()
+	}
+}
+
 func (p *Pool) advance(t cpu.Time, iv *ActorVec) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	if p.wheel != nil {
+		p.expired = p.wheel.advance(t, p.expired[:0])
+		for _, ei := range p.expired {
+			e := p.pool.events[ei]
+			p.pool.events[ei] = nil
+			p.pool.PutIndex(uint(ei))
+			p.run(e, iv)
+		}
+		return
+	}
 	for {
-		ei, valid := p.fibheap.Min(&p.pool)
+		ei, valid := p.fibheap.Min(p.times)
 		if !valid {
 			return
 		}
-		e := p.pool.events[ei]
-		if e.EventTime() > t {
+		if p.times[ei] > t {
 			break
 		}
+		e := p.pool.events[ei]
 		p.del(ei)
-		if iv != nil {
-			*iv = append(*iv, e)
-		} else {
-			e.EventAction()
-		}
+		p.run(e, iv)
 	}
 }
 
 func (p *Pool) NextTime() (t cpu.Time, valid bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	ei, valid := p.fibheap.Min(&p.pool)
+	if p.wheel != nil {
+		return p.wheel.nextTime()
+	}
+	ei, valid := p.fibheap.Min(p.times)
 	if valid {
-		t = p.pool.events[ei].EventTime()
+		t = p.times[ei]
 	}
 	return
 }
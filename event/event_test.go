@@ -0,0 +1,161 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"github.com/platinasystems/elib/cpu"
+
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+type testEvent struct {
+	id   int
+	time cpu.Time
+}
+
+func (e *testEvent) EventAction()        {}
+func (e *testEvent) String() string      { return fmt.Sprintf("event %d", e.id) }
+func (e *testEvent) EventTime() cpu.Time { return e.time }
+
+func newTestPool(useWheel bool) (p *Pool) {
+	p = &Pool{}
+	if useWheel {
+		p.UseTimingWheel(4)
+	}
+	return
+}
+
+func testPool(t *testing.T, useWheel bool, seed int64) {
+	rng := rand.New(rand.NewSource(seed))
+	p := newTestPool(useWheel)
+	// Model: pool index -> scheduled time.
+	model := make(map[uint]*testEvent)
+	var (
+		now cpu.Time = cpu.Time(rng.Int63n(1 << 40))
+		iv  ActorVec
+	)
+	p.Advance(now)
+	for iter := 0; iter < 20000; iter++ {
+		switch r := rng.Intn(10); {
+		case r < 5:
+			// Mix of near and far timers (and some in the past).
+			d := cpu.Time(rng.Int63n(1 << uint(4+rng.Intn(36))))
+			e := &testEvent{id: iter, time: now + d - 16}
+			model[p.Add(e)] = e
+		case r < 6:
+			for ei := range model {
+				if !p.Cancel(ei) {
+					t.Fatalf("cancel %d failed", ei)
+				}
+				delete(model, ei)
+				if p.Cancel(ei) {
+					t.Fatalf("second cancel %d succeeded", ei)
+				}
+				break
+			}
+		case r < 7:
+			for ei, e := range model {
+				e.time = now + cpu.Time(rng.Int63n(1<<20))
+				p.Reschedule(ei, e.time)
+				break
+			}
+		default:
+			var want []*testEvent
+			if nt, ok := p.NextTime(); ok != (len(model) > 0) {
+				t.Fatalf("next time valid %v with %d events", ok, len(model))
+			} else if ok {
+				min := nt
+				for _, e := range model {
+					if e.time < min {
+						min = e.time
+					}
+				}
+				if min != nt {
+					t.Fatalf("next time %d != min %d", nt, min)
+				}
+			}
+			now += cpu.Time(rng.Int63n(1 << uint(rng.Intn(32))))
+			for ei, e := range model {
+				if e.time <= now {
+					want = append(want, e)
+					delete(model, ei)
+				}
+			}
+			iv = iv[:0]
+			p.AdvanceAdd(now, &iv)
+			if len(iv) != len(want) {
+				t.Fatalf("advance %d: got %d events want %d", now, len(iv), len(want))
+			}
+			sort.Slice(want, func(i, j int) bool { return want[i].time < want[j].time })
+			for i := range iv {
+				if got := iv[i].(*testEvent); got.time != want[i].time {
+					t.Fatalf("advance %d: event %d time %d want %d", now, i, got.time, want[i].time)
+				}
+			}
+		}
+		if p.Elts() != uint(len(model)) {
+			t.Fatalf("elts %d != %d", p.Elts(), len(model))
+		}
+	}
+}
+
+func TestPool(t *testing.T) {
+	for seed := int64(0); seed < 4; seed++ {
+		testPool(t, false, seed)
+		testPool(t, true, seed)
+	}
+}
+
+// Steady state: n timers pending; each iteration expires one and schedules another.
+func benchmarkPool(b *testing.B, useWheel bool, n int) {
+	p := newTestPool(useWheel)
+	rng := rand.New(rand.NewSource(0))
+	const spread = 1 << 24
+	var now cpu.Time
+	events := make([]testEvent, n)
+	for i := range events {
+		events[i].time = cpu.Time(rng.Int63n(spread))
+		p.Add(&events[i])
+	}
+	var iv ActorVec
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		now += spread / cpu.Time(n)
+		iv = iv[:0]
+		p.AdvanceAdd(now, &iv)
+		for _, a := range iv {
+			e := a.(*testEvent)
+			e.time = now + cpu.Time(rng.Int63n(spread))
+			p.Add(e)
+		}
+	}
+}
+
+func benchmarkPoolCancel(b *testing.B, useWheel bool, n int) {
+	p := newTestPool(useWheel)
+	rng := rand.New(rand.NewSource(0))
+	events := make([]testEvent, n)
+	eis := make([]uint, n)
+	for i := range events {
+		events[i].time = cpu.Time(rng.Int63n(1 << 24))
+		eis[i] = p.Add(&events[i])
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		j := i % n
+		p.Cancel(eis[j])
+		eis[j] = p.Add(&events[j])
+	}
+}
+
+func BenchmarkPoolHeap1k(b *testing.B)          { benchmarkPool(b, false, 1<<10) }
+func BenchmarkPoolWheel1k(b *testing.B)         { benchmarkPool(b, true, 1<<10) }
+func BenchmarkPoolHeap256k(b *testing.B)        { benchmarkPool(b, false, 1<<18) }
+func BenchmarkPoolWheel256k(b *testing.B)       { benchmarkPool(b, true, 1<<18) }
+func BenchmarkPoolCancelHeap256k(b *testing.B)  { benchmarkPoolCancel(b, false, 1<<18) }
+func BenchmarkPoolCancelWheel256k(b *testing.B) { benchmarkPoolCancel(b, true, 1<<18) }
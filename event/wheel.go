@@ -0,0 +1,211 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package event
+
+import (
+	"github.com/platinasystems/elib/cpu"
+
+	"math/bits"
+)
+
+// Hierarchical timing wheel: O(1) insert and cancel.
+// Times are quantized into ticks of 2^log2Tick cpu cycles.
+// Level l has 256 slots each covering 2^(8l) ticks; 8 levels cover all 64 bit tick values.
+// Timers are placed at the lowest level whose slot differs from the current tick's slot;
+// when current tick enters a higher level slot its timers are cascaded to lower levels.
+const (
+	wheelLog2Slots = 8
+	wheelSlots     = 1 << wheelLog2Slots
+	wheelLevels    = 64 / wheelLog2Slots
+)
+
+type wheelLevel struct {
+	slots [wheelSlots][]uint32
+	// Bitmap of non-empty slots.
+	occupied [wheelSlots / 64]uint64
+}
+
+// Position of timer in wheel.
+type wheelElt struct {
+	time  cpu.Time
+	level uint8
+	slot  uint8
+	// Index in slot vector.
+	index uint32
+}
+
+type wheel struct {
+	log2Tick uint
+	// All timers with tick < now have expired.
+	now    uint64
+	levels [wheelLevels]wheelLevel
+	elts   []wheelElt
+}
+
+func (w *wheel) tick(t cpu.Time) uint64 { return uint64(t) >> w.log2Tick }
+
+func (l *wheelLevel) setOccupied(s uint, v bool) {
+	i, m := s/64, uint64(1)<<(s%64)
+	if v {
+		l.occupied[i] |= m
+	} else {
+		l.occupied[i] &^= m
+	}
+}
+
+// Find first non-empty slot >= s; returns wheelSlots if none.
+func (l *wheelLevel) findOccupied(s uint) uint {
+	for i := s / 64; i < uint(len(l.occupied)); i++ {
+		m := l.occupied[i]
+		if i == s/64 {
+			m &^= uint64(1)<<(s%64) - 1
+		}
+		if m != 0 {
+			return 64*i + uint(bits.TrailingZeros64(m))
+		}
+	}
+	return wheelSlots
+}
+
+func (w *wheel) insert(ei uint, t cpu.Time) {
+	tk := w.tick(t)
+	if tk < w.now {
+		tk = w.now
+	}
+	level := uint(0)
+	if d := tk ^ w.now; d >= wheelSlots {
+		level = uint(bits.Len64(d)-1) / wheelLog2Slots
+	}
+	s := uint(tk>>(wheelLog2Slots*level)) % wheelSlots
+	l := &w.levels[level]
+	for uint(len(w.elts)) <= ei {
+		w.elts = append(w.elts, wheelElt{})
+	}
+	w.elts[ei] = wheelElt{time: t, level: uint8(level), slot: uint8(s), index: uint32(len(l.slots[s]))}
+	l.slots[s] = append(l.slots[s], uint32(ei))
+	l.setOccupied(s, true)
+}
+
+func (w *wheel) remove(ei uint) {
+	e := &w.elts[ei]
+	l := &w.levels[e.level]
+	v := l.slots[e.slot]
+	last := len(v) - 1
+	if int(e.index) < last {
+		mi := v[last]
+		v[e.index] = mi
+		w.elts[mi].index = e.index
+	}
+	l.slots[e.slot] = v[:last]
+	if last == 0 {
+		l.setOccupied(uint(e.slot), false)
+	}
+}
+
+// Move timers in given slot to lower levels.
+func (w *wheel) cascade(level, s uint) {
+	l := &w.levels[level]
+	v := l.slots[s]
+	if len(v) == 0 {
+		return
+	}
+	l.slots[s] = nil
+	l.setOccupied(s, false)
+	for _, ei := range v {
+		w.insert(uint(ei), w.elts[ei].time)
+	}
+}
+
+// Next tick > now with a non-empty slot or ^uint64(0) if wheel is empty.
+func (w *wheel) nextTick() uint64 {
+	for level := uint(0); level < wheelLevels; level++ {
+		shift := wheelLog2Slots * level
+		s := uint(w.now>>shift) % wheelSlots
+		if j := w.levels[level].findOccupied(s + 1); j < wheelSlots {
+			base := w.now >> (shift + wheelLog2Slots) << (shift + wheelLog2Slots)
+			return base | uint64(j)<<shift
+		}
+	}
+	return ^uint64(0)
+}
+
+// Set current tick to tk cascading timers from higher level slots which start at tk.
+func (w *wheel) setNow(tk uint64) {
+	old := w.now
+	w.now = tk
+	for level := uint(wheelLevels - 1); level > 0; level-- {
+		shift := wheelLog2Slots * level
+		if old>>shift != tk>>shift {
+			w.cascade(level, uint(tk>>shift)%wheelSlots)
+		}
+	}
+}
+
+// Remove timers with time <= t from current tick's slot; append them to expired.
+func (w *wheel) expire(t cpu.Time, expired []uint32) []uint32 {
+	s := uint(w.now % wheelSlots)
+	l := &w.levels[0]
+	v := l.slots[s]
+	for i := 0; i < len(v); {
+		ei := v[i]
+		if w.elts[ei].time <= t {
+			expired = append(expired, ei)
+			w.remove(uint(ei))
+			v = l.slots[s]
+		} else {
+			i++
+		}
+	}
+	return expired
+}
+
+// Advance wheel to time t; expired timers are appended to given vector in time order.
+func (w *wheel) advance(t cpu.Time, expired []uint32) []uint32 {
+	target := w.tick(t)
+	for {
+		n0 := len(expired)
+		expired = w.expire(t, expired)
+		// Sort timers expiring in same tick by time.
+		for i := n0 + 1; i < len(expired); i++ {
+			for j := i; j > n0 && w.elts[expired[j]].time < w.elts[expired[j-1]].time; j-- {
+				expired[j], expired[j-1] = expired[j-1], expired[j]
+			}
+		}
+		if w.now >= target {
+			break
+		}
+		next := w.nextTick()
+		if next > target {
+			next = target
+		}
+		w.setNow(next)
+	}
+	return expired
+}
+
+// Earliest timer time.
+func (w *wheel) nextTime() (t cpu.Time, valid bool) {
+	min := func(v []uint32) {
+		for _, ei := range v {
+			if et := w.elts[ei].time; !valid || et < t {
+				t, valid = et, true
+			}
+		}
+	}
+	l := &w.levels[0]
+	if v := l.slots[w.now%wheelSlots]; len(v) > 0 {
+		min(v)
+		return
+	}
+	if next := w.nextTick(); next != ^uint64(0) {
+		// Find level and slot of next tick: lowest level whose slot differs.
+		level := uint(0)
+		if d := next ^ w.now; d >= wheelSlots {
+			level = uint(bits.Len64(d)-1) / wheelLog2Slots
+		}
+		min(w.levels[level].slots[uint(next>>(wheelLog2Slots*level))%wheelSlots])
+	}
+	return
+}
@@ -46,6 +46,9 @@ type FibHeap struct {
 	// Cached min index in heap.
 	minIndex Index
 	minValid bool
+
+	// Number of elements in heap.
+	len uint
 }
 
 func (f *FibHeap) node(ni Index) *fibNode {
@@ -80,6 +83,11 @@ func (f *FibHeap) unlink(xi Index) {
 
 // Add a new index to heap.
 func (f *FibHeap) Add(xi uint) {
+	f.add(xi)
+	f.len++
+}
+
+func (f *FibHeap) add(xi uint) {
 	if len(f.nodes) == 0 {
 		f.root.next, f.root.prev = fibRootIndex, fibRootIndex
 		f.root.sup = MaxIndex
@@ -123,6 +131,7 @@ func (f *FibHeap) Del(i uint) {
 	x := &f.nodes[xi]
 	supi := x.sup
 	f.minValid = f.minValid && xi != f.minIndex
+	f.len--
 	if supi == MaxIndex {
 		return
 	}
@@ -150,12 +159,66 @@ func (f *FibHeap) Del(i uint) {
 	}
 }
 
-// Update node when data ordering changes (lower key)
+// Update node when data ordering changes (lower or higher key)
 func (f *FibHeap) Update(xi uint) {
 	f.Del(xi)
 	f.Add(xi)
 }
 
+// Move child node to root list.
+func (f *FibHeap) cut(xi Index) {
+	x := &f.nodes[xi]
+	sup := &f.nodes[x.sup]
+	sup.nSub--
+	if sup.nSub == 0 {
+		sup.sub = MaxIndex
+	} else if sup.sub == xi {
+		sup.sub = x.next
+	}
+	f.unlink(xi)
+	x.sup = MaxIndex
+	x.isMarked = false
+	f.addRoot(xi)
+}
+
+// DecreaseKey must be called after key for given index has been lowered.
+// Amortized O(1) unlike Update.
+func (f *FibHeap) DecreaseKey(i uint, data Ordered) {
+	xi := Index(i)
+	x := &f.nodes[xi]
+	if supi := x.sup; supi != MaxIndex && data.Compare(int(xi), int(supi)) < 0 {
+		f.cut(xi)
+		// Cascading cut: cut marked parents; mark first unmarked parent.
+		for supi != MaxIndex {
+			sup := &f.nodes[supi]
+			sup2i := sup.sup
+			if sup2i == MaxIndex {
+				break
+			}
+			if !sup.isMarked {
+				sup.isMarked = true
+				break
+			}
+			f.cut(supi)
+			supi = sup2i
+		}
+	}
+	if f.minValid && xi != f.minIndex && data.Compare(int(xi), int(f.minIndex)) < 0 {
+		f.minIndex = xi
+	}
+}
+
+// ExtractMin removes minimum element from heap and returns its index.
+func (f *FibHeap) ExtractMin(data Ordered) (i uint, valid bool) {
+	if i, valid = f.Min(data); valid {
+		f.Del(i)
+	}
+	return
+}
+
+// Len returns number of elements in heap.
+func (f *FibHeap) Len() uint { return f.len }
+
 func (f *FibHeap) Min(data Ordered) (minu uint, valid bool) {
 	minu = uint(f.minIndex)
 	valid = f.minValid
@@ -253,11 +316,89 @@ func (f *FibHeap) Merge(g *FibHeap) {
 	r.reloc(l)
 	for ri := r.next; ri != fibRootIndex; {
 		r := &f.nodes[ri]
-		f.Add(uint(ri))
+		f.add(uint(ri))
 		ri = r.next
 	}
+	f.len += g.len
 }
 
 func (f *FibHeap) String() string {
-	return fmt.Sprintf("%d elts", len(f.nodes))
+	return fmt.Sprintf("%d elts", f.len)
+}
+
+// FibHeapIterator visits heap elements in priority order without modifying heap.
+// Heap must not be modified during iteration.
+type FibHeapIterator struct {
+	f    *FibHeap
+	data Ordered
+	// Binary heap of candidates: roots and children of visited nodes.
+	candidates []Index
+}
+
+// Iterator returns iterator positioned before minimum element.
+func (f *FibHeap) Iterator(data Ordered) (it *FibHeapIterator) {
+	it = &FibHeapIterator{f: f, data: data}
+	if f.len > 0 {
+		for ri := f.root.next; ri != fibRootIndex; ri = f.nodes[ri].next {
+			it.push(ri)
+		}
+	}
+	return
+}
+
+func (it *FibHeapIterator) less(i, j int) bool {
+	return it.data.Compare(int(it.candidates[i]), int(it.candidates[j])) < 0
+}
+
+func (it *FibHeapIterator) push(xi Index) {
+	it.candidates = append(it.candidates, xi)
+	for i := len(it.candidates) - 1; i > 0; {
+		p := (i - 1) / 2
+		if !it.less(i, p) {
+			break
+		}
+		it.candidates[i], it.candidates[p] = it.candidates[p], it.candidates[i]
+		i = p
+	}
+}
+
+func (it *FibHeapIterator) pop() (xi Index) {
+	c := it.candidates
+	xi = c[0]
+	l := len(c) - 1
+	c[0] = c[l]
+	it.candidates = c[:l]
+	for i := 0; ; {
+		m, j := i, 2*i+1
+		if j < l && it.less(j, m) {
+			m = j
+		}
+		if j+1 < l && it.less(j+1, m) {
+			m = j + 1
+		}
+		if m == i {
+			break
+		}
+		c[i], c[m] = c[m], c[i]
+		i = m
+	}
+	return
+}
+
+// Next returns index of next element in priority order; ok is false when done.
+func (it *FibHeapIterator) Next() (i uint, ok bool) {
+	if len(it.candidates) == 0 {
+		return
+	}
+	xi := it.pop()
+	x := &it.f.nodes[xi]
+	if bi := x.sub; bi != MaxIndex {
+		for ci := bi; ; {
+			it.push(ci)
+			if ci = it.f.nodes[ci].next; ci == bi {
+				break
+			}
+		}
+	}
+	return uint(xi), true
 }
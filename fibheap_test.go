@@ -0,0 +1,80 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elib
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestFibHeap(t *testing.T) {
+	c := testFibHeap{
+		iterations:    1000,
+		nObjects:      50,
+		validateEvery: 1,
+		seed:          1,
+	}
+	if err := runFibHeapTest(&c); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFibHeapDecreaseKey(t *testing.T) {
+	const n = 200
+	var f FibHeap
+	r := rand.New(rand.NewSource(1))
+	objs := fibHeapTestObj(make([]int64, n))
+	in := make(map[uint]bool)
+	for i := range objs {
+		objs[i] = 1000 + r.Int63n(1<<20)
+		f.Add(uint(i))
+		in[uint(i)] = true
+	}
+
+	// Consolidate so nodes have parents, then extract and lower keys.
+	for iter := 0; iter < 3*n/4; iter++ {
+		i, ok := f.ExtractMin(objs)
+		if !ok {
+			t.Fatalf("ExtractMin: heap empty")
+		}
+		for j := range in {
+			if objs[j] < objs[i] {
+				t.Fatalf("ExtractMin: got %d (%d) but %d (%d) smaller", i, objs[i], j, objs[j])
+			}
+		}
+		delete(in, i)
+		for k := 0; k < 2; k++ {
+			for j := range in {
+				objs[j] -= r.Int63n(objs[j] / 2)
+				f.DecreaseKey(j, objs)
+				break
+			}
+		}
+		if err := f.validate(); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := f.Len(), uint(len(in)); got != want {
+			t.Fatalf("Len: got %d want %d", got, want)
+		}
+	}
+
+	var want []uint
+	for i := range in {
+		want = append(want, i)
+	}
+	sort.Slice(want, func(i, j int) bool { return objs[want[i]] < objs[want[j]] })
+	it := f.Iterator(objs)
+	k := 0
+	for i, ok := it.Next(); ok; i, ok = it.Next() {
+		if k >= len(want) || objs[i] != objs[want[k]] {
+			t.Fatalf("Iterator %d: got %d (%d)", k, i, objs[i])
+		}
+		k++
+	}
+	if k != len(want) || f.Len() != uint(len(want)) {
+		t.Errorf("Iterator visited %d want %d", k, len(want))
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elib
+
+// Generic versions of vec.tmpl, pool.tmpl and heap.tmpl.
+// Semantics match the generated code so callers can switch without
+// behavior changes: growth follows NextResizeCap and pool free indices are
+// tracked in the embedded Pool's free bitmap.
+
+// Vec is a resizeable vector; equivalent to vec.tmpl.
+type Vec[T any] []T
+
+func (p *Vec[T]) Resize(n uint) {
+	old_cap := uint(cap(*p))
+	new_len := uint(len(*p)) + n
+	if new_len > old_cap {
+		new_cap := NextResizeCap(new_len)
+		q := make([]T, new_len, new_cap)
+		copy(q, *p)
+		*p = q
+	}
+	*p = (*p)[:new_len]
+}
+
+func (p *Vec[T]) validate(new_len uint, zero T) *T {
+	old_cap := uint(cap(*p))
+	old_len := uint(len(*p))
+	if new_len <= old_cap {
+		// Need to reslice to larger length?
+		if new_len > old_len {
+			*p = (*p)[:new_len]
+			for i := old_len; i < new_len; i++ {
+				(*p)[i] = zero
+			}
+		}
+		return &(*p)[new_len-1]
+	}
+	return p.validateSlowPath(zero, old_cap, new_len, old_len)
+}
+
+func (p *Vec[T]) validateSlowPath(zero T, old_cap, new_len, old_len uint) *T {
+	if new_len > old_cap {
+		new_cap := NextResizeCap(new_len)
+		q := make([]T, new_cap, new_cap)
+		copy(q, *p)
+		for i := old_len; i < new_cap; i++ {
+			q[i] = zero
+		}
+		*p = q[:new_len]
+	}
+	if new_len > old_len {
+		*p = (*p)[:new_len]
+	}
+	return &(*p)[new_len-1]
+}
+
+func (p *Vec[T]) Validate(i uint) *T {
+	var zero T
+	return p.validate(i+1, zero)
+}
+
+func (p *Vec[T]) ValidateInit(i uint, zero T) *T {
+	return p.validate(i+1, zero)
+}
+
+func (p *Vec[T]) ValidateLen(l uint) (v *T) {
+	if l > 0 {
+		var zero T
+		v = p.validate(l, zero)
+	}
+	return
+}
+
+func (p *Vec[T]) ValidateLenInit(l uint, zero T) (v *T) {
+	if l > 0 {
+		v = p.validate(l, zero)
+	}
+	return
+}
+
+func (p *Vec[T]) ResetLen() {
+	if *p != nil {
+		*p = (*p)[:0]
+	}
+}
+
+func (p Vec[T]) Len() uint { return uint(len(p)) }
+
+// PoolOf is a pool of elements of type T; equivalent to pool.tmpl with Data=Data.
+type PoolOf[T any] struct {
+	Pool
+	Data []T
+}
+
+func (p *PoolOf[T]) GetIndex() (i uint) {
+	l := uint(len(p.Data))
+	i = p.Pool.GetIndex(l)
+	if i >= l {
+		p.Validate(i)
+	}
+	return i
+}
+
+func (p *PoolOf[T]) PutIndex(i uint) (ok bool) {
+	return p.Pool.PutIndex(i)
+}
+
+func (p *PoolOf[T]) IsFree(i uint) (v bool) {
+	v = i >= uint(len(p.Data))
+	if !v {
+		v = p.Pool.IsFree(i)
+	}
+	return
+}
+
+func (p *PoolOf[T]) Resize(n uint) {
+	c := uint(cap(p.Data))
+	l := uint(len(p.Data) + int(n))
+	if l > c {
+		c = NextResizeCap(l)
+		q := make([]T, l, c)
+		copy(q, p.Data)
+		p.Data = q
+	}
+	p.Data = p.Data[:l]
+}
+
+func (p *PoolOf[T]) Validate(i uint) {
+	c := uint(cap(p.Data))
+	l := uint(i) + 1
+	if l > c {
+		c = NextResizeCap(l)
+		q := make([]T, l, c)
+		copy(q, p.Data)
+		p.Data = q
+	}
+	if l > uint(len(p.Data)) {
+		p.Data = p.Data[:l]
+	}
+}
+
+func (p *PoolOf[T]) Elts() uint {
+	return uint(len(p.Data)) - p.FreeLen()
+}
+
+func (p *PoolOf[T]) Len() uint {
+	return uint(len(p.Data))
+}
+
+func (p *PoolOf[T]) Foreach(f func(x T)) {
+	for i := range p.Data {
+		if !p.Pool.IsFree(uint(i)) {
+			f(p.Data[i])
+		}
+	}
+}
+
+func (p *PoolOf[T]) ForeachIndex(f func(i uint)) {
+	for i := range p.Data {
+		if !p.Pool.IsFree(uint(i)) {
+			f(uint(i))
+		}
+	}
+}
+
+func (p *PoolOf[T]) Reset() {
+	p.Pool.Reset()
+	if len(p.Data) > 0 {
+		p.Data = p.Data[:0]
+	}
+}
+
+// HeapOf allocates variable sized blocks of elements of type T; equivalent to heap.tmpl with Data=Data.
+type HeapOf[T any] struct {
+	Heap
+	Data []T
+	ids  []Index
+}
+
+func (p *HeapOf[T]) GetAligned(size, log2Alignment uint) (offset uint) {
+	l := uint(len(p.Data))
+	id, offset := p.Heap.GetAligned(size, log2Alignment)
+	if offset+size >= l {
+		p.Validate(offset + size - 1)
+	}
+	for i := uint(0); i < size; i++ {
+		p.ids[offset+i] = id
+	}
+	return
+}
+
+func (p *HeapOf[T]) Get(size uint) uint { return p.GetAligned(size, 0) }
+
+func (p *HeapOf[T]) Put(offset uint) {
+	p.Heap.Put(p.Id(offset))
+}
+
+func (p *HeapOf[T]) IsFree(offset uint) bool {
+	return p.Heap.IsFree(p.Id(offset))
+}
+
+func (p *HeapOf[T]) Validate(i uint) {
+	c := uint(cap(p.Data))
+	l := uint(i) + 1
+	if l > c {
+		c = NextResizeCap(l)
+		q := make([]T, l, c)
+		r := make([]Index, l, c)
+		copy(q, p.Data)
+		copy(r, p.ids)
+		p.Data = q
+		p.ids = r
+	}
+	if l > uint(len(p.Data)) {
+		p.Data = p.Data[:l]
+		p.ids = p.ids[:l]
+	}
+}
+
+func (p *HeapOf[T]) Id(offset uint) Index {
+	return p.ids[offset]
+}
+
+func (p *HeapOf[T]) Slice(offset uint) []T {
+	l := p.Len(p.Id(offset))
+	if (offset + l) > uint(len(p.Data)) {
+		p.Validate(offset + l - 1)
+	}
+	return p.Data[offset : offset+l]
+}
@@ -0,0 +1,72 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elib
+
+import (
+	"testing"
+)
+
+func TestGeneric(t *testing.T) {
+	{
+		var v Vec[uint16]
+		*v.ValidateInit(9, 7) = 3
+		if got, want := v.Len(), uint(10); got != want {
+			t.Errorf("Vec len: got %d want %d", got, want)
+		}
+		if got, want := uint(cap(v)), NextResizeCap(10); got != want {
+			t.Errorf("Vec cap: got %d want %d", got, want)
+		}
+		if v[0] != 7 || v[9] != 3 {
+			t.Errorf("Vec ValidateInit: got %v", v)
+		}
+		v.ResetLen()
+		if v.ValidateLen(0) != nil || v.Len() != 0 {
+			t.Errorf("Vec ResetLen: got %v", v)
+		}
+	}
+
+	{
+		var p PoolOf[string]
+		for i := 0; i < 4; i++ {
+			p.Data[p.GetIndex()] = "x"
+		}
+		p.PutIndex(1)
+		if !p.IsFree(1) || p.IsFree(2) || !p.IsFree(100) {
+			t.Errorf("Pool IsFree")
+		}
+		if got, want := p.Elts(), uint(3); got != want {
+			t.Errorf("Pool Elts: got %d want %d", got, want)
+		}
+		var is []uint
+		p.ForeachIndex(func(i uint) { is = append(is, i) })
+		if len(is) != 3 || is[0] != 0 || is[1] != 2 || is[2] != 3 {
+			t.Errorf("Pool ForeachIndex: got %v", is)
+		}
+		if got, want := p.GetIndex(), uint(1); got != want {
+			t.Errorf("Pool GetIndex reuse: got %d want %d", got, want)
+		}
+		p.Reset()
+		if p.Len() != 0 || !p.IsFree(1) {
+			t.Errorf("Pool Reset")
+		}
+	}
+
+	{
+		var h HeapOf[float64]
+		o0 := h.Get(3)
+		o1 := h.GetAligned(5, 2)
+		if o1%4 != 0 {
+			t.Errorf("Heap GetAligned: offset %d not aligned", o1)
+		}
+		s := h.Slice(o1)
+		if len(s) != 5 {
+			t.Errorf("Heap Slice: got len %d want 5", len(s))
+		}
+		h.Put(o0)
+		if !h.IsFree(o0) || h.IsFree(o1) {
+			t.Errorf("Heap IsFree")
+		}
+	}
+}
@@ -1 +1,3 @@
 module github.com/platinasystems/elib
+
+go 1.21
@@ -11,7 +11,29 @@ import (
 )
 
 type hash64 uint64
-type HashState [2]hash64
+
+// HashState holds hash seed and, after hashing, the resulting 128 bit hash value.
+type HashState struct {
+	h [2]hash64
+	// Mixer to use in place of default mixing function; nil for default.
+	mixer HashMixer
+}
+
+// HashMixer is a hash function which may be plugged into a HashState.
+// Functions start with seed given by s.Uint64s and must set 128 bit result via s.SetUint64s.
+type HashMixer interface {
+	// Hash up to 256 bits of data x0..x3.
+	HashUint64(s *HashState, x0, x1, x2, x3 uint64)
+	// Hash data given by pointer and size.
+	HashPointer(s *HashState, p unsafe.Pointer, size uintptr)
+}
+
+// Uint64s returns 128 bit hash state: seed before hashing and hash value afterwards.
+func (s *HashState) Uint64s() (h0, h1 uint64) { return uint64(s.h[0]), uint64(s.h[1]) }
+func (s *HashState) SetUint64s(h0, h1 uint64) { s.h[0], s.h[1] = hash64(h0), hash64(h1) }
+
+func (s *HashState) Mixer() HashMixer     { return s.mixer }
+func (s *HashState) SetMixer(m HashMixer) { s.mixer = m }
 
 func (h hash64) rotate(n uint) hash64 { return (h << n) | (h >> (64 - n)) }
 
@@ -63,8 +85,8 @@ func (s *HashState) Finalize(h0, h1, h2, h3 hash64) {
 	h0, h3 = s.finStep(h0, h3, 25)
 	h1, h0 = s.finStep(h1, h0, 63)
 
-	s[0] = h0
-	s[1] = h1
+	s.h[0] = h0
+	s.h[1] = h1
 }
 
 func (s *HashState) get64(p unsafe.Pointer, i int) uint64 { return UnalignedUint64(p, uintptr(i)) }
@@ -127,16 +149,24 @@ func (s *HashState) Init() (hash64, hash64, hash64, hash64) {
 	//  * is a not-very-regular mix of 1's and 0's
 	//  * does not need any other special mathematical properties.
 	const seedConst hash64 = 0xdeadbeefdeadbeef
-	return s[0], s[1], seedConst, seedConst
+	return s.h[0], s.h[1], seedConst, seedConst
 }
 
 func (s *HashState) HashUint64(x0, x1, x2, x3 uint64) {
+	if s.mixer != nil {
+		s.mixer.HashUint64(s, x0, x1, x2, x3)
+		return
+	}
 	h0, h1, h2, h3 := s.Init()
 	h0, h1, h2, h3 = s.MixUint64(h0, h1, h2, h3, x0, x1, x2, x3)
 	s.Finalize(h0, h1, h2, h3)
 }
 
 func (s *HashState) HashPointer(p unsafe.Pointer, size uintptr) {
+	if s.mixer != nil {
+		s.mixer.HashPointer(s, p, size)
+		return
+	}
 	h0, h1, h2, h3 := s.Init()
 	// Mix in data length.
 	h0 += hash64(size)
@@ -148,10 +178,16 @@ type stats struct {
 	calls    uint64
 	searches uint64
 	compares uint64
+	// Histogram of probe lengths.
+	probes hashHistogram
 }
 
 func (s *stats) compare(x uint) { s.compares += uint64(x) }
-func (s *stats) search(x uint)  { s.searches += uint64(x); s.calls += 1 }
+func (s *stats) search(x uint) {
+	s.searches += uint64(x)
+	s.calls += 1
+	s.probes.add(x)
+}
 
 type Hash struct {
 	Hasher            Hasher
@@ -165,7 +201,14 @@ type Hash struct {
 	maxBucketBitDiffs []bitDiff
 	nElts             uint
 	resizeCopies      []HashResizeCopy
-	stats             struct {
+	// Seed is given by caller and not randomized on resize.
+	fixedSeed bool
+	// Incremented each time elements are copied to a resized table.
+	epoch uint64
+	// Number of open iterators and log of resizes they have yet to see.
+	nIterators uint
+	resizeLog  []hashResizeLog
+	stats      struct {
 		grows           uint64
 		copies          uint64
 		get, set, unset stats
@@ -207,8 +250,8 @@ type HasherKey interface {
 }
 
 func (h *Hash) capMask(i uint) uint { return uint(1)<<h.log2Cap[i] - 1 }
-func (h *HashState) limit() uint32  { return uint32(h[0] >> 32) }
-func (h *HashState) offset() hash64 { return h[1] }
+func (h *HashState) limit() uint32  { return uint32(h.h[0] >> 32) }
+func (h *HashState) offset() hash64 { return h.h[1] }
 
 func (h *Hash) baseIndex(s *HashState) uint {
 	is_table_1 := uint(0)
@@ -410,6 +453,16 @@ func (h *Hash) grow() {
 	h.alloc()
 }
 
+// SetSeed gives explicit seed used for all hashing (for hash flooding resistance or
+// to reproduce table layouts across runs).  Must be called before Init.
+func (h *Hash) SetSeed(s0, s1 uint64) {
+	h.seed.SetUint64s(s0, s1)
+	h.fixedSeed = true
+}
+
+// SetMixer selects hash function; nil gives default mixing function.  Must be called before Init.
+func (h *Hash) SetMixer(m HashMixer) { h.seed.mixer = m }
+
 func (h *Hash) Init(r Hasher, cap uint) {
 	h.cap = Cap(cap).Round(hashLog2CapMinUnit)
 	h.alloc()
@@ -450,8 +503,10 @@ func (h *Hash) alloc() {
 		h.limit0 = uint32((uint64(1) << (32 + log2c0)) / uint64(h.cap))
 	}
 
-	for i := range h.seed {
-		h.seed[i] = hash64(rand.Int63())
+	if !h.fixedSeed {
+		for i := range h.seed.h {
+			h.seed.h[i] = hash64(rand.Int63())
+		}
 	}
 
 	h.bitDiffs = make([]bitDiff, h.cap)
@@ -485,6 +540,8 @@ func (h *Hash) copy(s *HashState, bds []bitDiff) (ok bool) {
 		}
 		h.Hasher.HashResize(h.Cap(), h.resizeCopies)
 		h.nElts = n
+		h.epoch++
+		h.logResize()
 	}
 	return
 }
@@ -0,0 +1,186 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elib
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// HashKeyer is a key type for ConcurrentHash.
+type HashKeyer interface {
+	comparable
+	// Compute hash for key.
+	HashKey(s *HashState)
+}
+
+// ConcurrentHash is a read-mostly hash table safe for concurrent use.
+// Lookups are lock-free and never wait for writers; writers are serialised.
+//
+// Two copies of the table are kept (left-right double buffering).  Writers update the copy
+// readers are not using, switch readers over to it, wait for readers of the old copy
+// to drain and then apply the same update to the old copy.  A resize caused by an update
+// happens in the same way so readers never see a table being resized.
+type ConcurrentHash[K HashKeyer, V any] struct {
+	// Serialises writers.
+	mu sync.Mutex
+
+	tables [2]concurrentHashTable[K, V]
+
+	// Index of table readers use.
+	active atomic.Uint32
+
+	// Count of readers that arrived under each read indicator version.
+	readers [2]atomic.Int64
+
+	// Read indicator new readers use.
+	version atomic.Uint32
+}
+
+type concurrentHashTable[K HashKeyer, V any] struct {
+	Hash
+	keys   []K
+	values []V
+}
+
+func (t *concurrentHashTable[K, V]) HashIndex(s *HashState, i uint) { t.keys[i].HashKey(s) }
+
+func (t *concurrentHashTable[K, V]) HashResize(newCap uint, rs []HashResizeCopy) {
+	keys, values := make([]K, newCap), make([]V, newCap)
+	for i := range rs {
+		keys[rs[i].Dst] = t.keys[rs[i].Src]
+		values[rs[i].Dst] = t.values[rs[i].Src]
+	}
+	t.keys, t.values = keys, values
+}
+
+// Adapts key to HasherKey interface.
+type concurrentHashKey[K HashKeyer, V any] struct{ k K }
+
+func (k *concurrentHashKey[K, V]) HashKey(s *HashState) { k.k.HashKey(s) }
+func (k *concurrentHashKey[K, V]) HashKeyEqual(h Hasher, i uint) bool {
+	return h.(*concurrentHashTable[K, V]).keys[i] == k.k
+}
+
+// get is the read path: it must not modify table (not even statistics).
+func (t *concurrentHashTable[K, V]) get(k K) (v V, ok bool) {
+	if t.empty() {
+		return
+	}
+	var (
+		s      HashState
+		st     stats
+		bi, mi uint
+	)
+	if bi, mi, ok = t.searchKey(&s, &st, &concurrentHashKey[K, V]{k: k}); ok {
+		v = t.values[bi^mi]
+	}
+	return
+}
+
+func (t *concurrentHashTable[K, V]) set(k K, v V) (exists bool) {
+	var i uint
+	i, exists = t.Set(&concurrentHashKey[K, V]{k: k})
+	t.keys[i] = k
+	t.values[i] = v
+	return
+}
+
+func (t *concurrentHashTable[K, V]) unset(k K) (ok bool) {
+	var (
+		i    uint
+		zk   K
+		zero V
+	)
+	if i, ok = t.Unset(&concurrentHashKey[K, V]{k: k}); ok {
+		t.keys[i] = zk
+		t.values[i] = zero
+	}
+	return
+}
+
+// Init initializes both table copies; must be called before concurrent use.
+func (h *ConcurrentHash[K, V]) Init(cap uint) {
+	for i := range h.tables {
+		t := &h.tables[i]
+		t.Init(t, cap)
+	}
+}
+
+func (h *ConcurrentHash[K, V]) readerArrive() (v uint32) {
+	v = h.version.Load()
+	h.readers[v].Add(1)
+	return
+}
+
+func (h *ConcurrentHash[K, V]) readerDepart(v uint32) { h.readers[v].Add(-1) }
+
+func (h *ConcurrentHash[K, V]) waitReaders(v uint32) {
+	for h.readers[v].Load() != 0 {
+		runtime.Gosched()
+	}
+}
+
+// Wait until no reader can still be using table which was active before last switch.
+func (h *ConcurrentHash[K, V]) toggleVersionAndWait() {
+	prev := h.version.Load()
+	next := prev ^ 1
+	h.waitReaders(next)
+	h.version.Store(next)
+	h.waitReaders(prev)
+}
+
+// Apply update to both tables; caller holds writer lock.
+func (h *ConcurrentHash[K, V]) update(f func(t *concurrentHashTable[K, V])) {
+	a := h.active.Load()
+	f(&h.tables[a^1])
+	h.active.Store(a ^ 1)
+	h.toggleVersionAndWait()
+	f(&h.tables[a])
+}
+
+// Get looks up key without locking.
+func (h *ConcurrentHash[K, V]) Get(k K) (v V, ok bool) {
+	r := h.readerArrive()
+	v, ok = h.tables[h.active.Load()].get(k)
+	h.readerDepart(r)
+	return
+}
+
+// Foreach calls f for each key and value.  F must not modify hash.
+func (h *ConcurrentHash[K, V]) Foreach(f func(k K, v V)) {
+	r := h.readerArrive()
+	defer h.readerDepart(r)
+	t := &h.tables[h.active.Load()]
+	for i := range t.bitDiffs {
+		if t.bitDiffs[i].isValid() {
+			f(t.keys[i], t.values[i])
+		}
+	}
+}
+
+// Set sets value for key; exists is true if key was already present.
+func (h *ConcurrentHash[K, V]) Set(k K, v V) (exists bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.update(func(t *concurrentHashTable[K, V]) { exists = t.set(k, v) })
+	return
+}
+
+// Unset removes key; ok is true if key was present.
+func (h *ConcurrentHash[K, V]) Unset(k K) (ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.update(func(t *concurrentHashTable[K, V]) { ok = t.unset(k) })
+	return
+}
+
+func (h *ConcurrentHash[K, V]) Elts() (n uint) {
+	r := h.readerArrive()
+	n = h.tables[h.active.Load()].Elts()
+	h.readerDepart(r)
+	return
+}
@@ -0,0 +1,123 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elib
+
+// Element copies made by one table resize while iterators were open.
+type hashResizeLog struct {
+	epoch  uint64
+	copies []HashResizeCopy
+}
+
+// Epoch is incremented each time table is resized.
+// Indices obtained in an earlier epoch are no longer valid.
+func (h *Hash) Epoch() uint64 { return h.epoch }
+
+func (h *Hash) logResize() {
+	if h.nIterators == 0 {
+		return
+	}
+	l := hashResizeLog{epoch: h.epoch}
+	l.copies = append(l.copies, h.resizeCopies...)
+	h.resizeLog = append(h.resizeLog, l)
+}
+
+// HashIterator visits each element of a hash exactly once even if elements are
+// set or unset and the table is resized during iteration.
+// Elements set during iteration may or may not be visited.
+type HashIterator struct {
+	h *Hash
+	// Epoch of hash when iterator last ran.
+	epoch uint64
+	// Next index to examine.
+	i uint
+	// Indices >= i which have already been visited (after a resize).
+	visited WordVec
+	closed  bool
+}
+
+// Iterator returns a new iterator positioned before first element.
+// Iterator must be run to completion or closed.
+func (h *Hash) Iterator() (it *HashIterator) {
+	it = &HashIterator{h: h, epoch: h.epoch}
+	h.nIterators++
+	return
+}
+
+// Close releases iterator; resize log is freed when last iterator is closed.
+func (it *HashIterator) Close() {
+	if it.closed {
+		return
+	}
+	it.closed = true
+	h := it.h
+	h.nIterators--
+	if h.nIterators == 0 {
+		h.resizeLog = h.resizeLog[:0]
+	}
+}
+
+// Apply resizes since iterator last ran: mark new indices of visited elements.
+func (it *HashIterator) remap() {
+	for li := range it.h.resizeLog {
+		l := &it.h.resizeLog[li]
+		if l.epoch <= it.epoch {
+			continue
+		}
+		var v WordVec
+		for _, c := range l.copies {
+			if c.Src < it.i || it.visited.GetBit(c.Src) {
+				v.Alloc(c.Dst + 1)
+				v.SetBit(c.Dst, true)
+			}
+		}
+		it.visited = v
+		it.i = 0
+		it.epoch = l.epoch
+	}
+}
+
+// Next returns index of next element; ok is false when iteration is done.
+func (it *HashIterator) Next() (i uint, ok bool) {
+	if it.closed {
+		return
+	}
+	h := it.h
+	if it.epoch != h.epoch {
+		it.remap()
+	}
+	for ; it.i < uint(len(h.bitDiffs)); it.i++ {
+		if h.bitDiffs[it.i].isValid() && !it.visited.GetBit(it.i) {
+			i, ok = it.i, true
+			it.i++
+			return
+		}
+	}
+	it.Close()
+	return
+}
+
+// Snapshot returns indices of all elements; indices are valid until Epoch changes.
+func (h *Hash) Snapshot() (is []uint) {
+	is = make([]uint, 0, h.nElts)
+	h.ForeachIndex(func(i uint) { is = append(is, i) })
+	return
+}
+
+// DeleteIf removes all elements for which f returns true and returns number removed.
+func (h *Hash) DeleteIf(f func(i uint) bool) (n uint) {
+	for i := range h.bitDiffs {
+		if h.bitDiffs[i].isValid() && f(uint(i)) {
+			h.bitDiffs[i].invalidate()
+			n++
+		}
+	}
+	h.nElts -= n
+	return
+}
+
+// Filter keeps only elements for which f returns true and returns number removed.
+func (h *Hash) Filter(f func(i uint) bool) uint {
+	return h.DeleteIf(func(i uint) bool { return !f(i) })
+}
@@ -0,0 +1,137 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elib
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"math/bits"
+	"unsafe"
+)
+
+// Alternative hash functions for HashState.SetMixer and Hash.SetMixer.
+
+func hashBytes(p unsafe.Pointer, size uintptr) []byte {
+	if size == 0 {
+		return nil
+	}
+	return unsafe.Slice((*byte)(p), size)
+}
+
+func hashUint64Bytes(b *[32]byte, x0, x1, x2, x3 uint64) []byte {
+	binary.LittleEndian.PutUint64(b[0:], x0)
+	binary.LittleEndian.PutUint64(b[8:], x1)
+	binary.LittleEndian.PutUint64(b[16:], x2)
+	binary.LittleEndian.PutUint64(b[24:], x3)
+	return b[:]
+}
+
+// CRC32CMixer hashes with CRC32-C (Castagnoli), which is hardware accelerated on most
+// CPUs and matches hashes computed by NICs and switches for flow tuples.
+// Low 32 bits of seed are initial CRC; hash value has CRC in low and high 32 bits of
+// both 64 bit halves.
+type CRC32CMixer struct{}
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+func (CRC32CMixer) hash(s *HashState, b []byte) {
+	h0, _ := s.Uint64s()
+	c := uint64(crc32.Update(uint32(h0), crc32cTable, b))
+	s.SetUint64s(c<<32|c, c<<32|c)
+}
+
+func (m CRC32CMixer) HashUint64(s *HashState, x0, x1, x2, x3 uint64) {
+	var b [32]byte
+	m.hash(s, hashUint64Bytes(&b, x0, x1, x2, x3))
+}
+
+func (m CRC32CMixer) HashPointer(s *HashState, p unsafe.Pointer, size uintptr) {
+	m.hash(s, hashBytes(p, size))
+}
+
+// XXHashMixer hashes with the xxHash64 algorithm; high 64 bits of seed are mixed into
+// second half of hash value.
+type XXHashMixer struct{}
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+func xxRound(acc, x uint64) uint64 {
+	acc += x * xxPrime2
+	acc = bits.RotateLeft64(acc, 31)
+	return acc * xxPrime1
+}
+
+func xxMergeRound(acc, x uint64) uint64 {
+	acc ^= xxRound(0, x)
+	return acc*xxPrime1 + xxPrime4
+}
+
+func xxAvalanche(h uint64) uint64 {
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
+
+func xxHash64(seed uint64, b []byte) (h uint64) {
+	n := uint64(len(b))
+	if len(b) >= 32 {
+		v1 := seed + xxPrime1 + xxPrime2
+		v2 := seed + xxPrime2
+		v3 := seed
+		v4 := seed - xxPrime1
+		for ; len(b) >= 32; b = b[32:] {
+			v1 = xxRound(v1, binary.LittleEndian.Uint64(b[0:]))
+			v2 = xxRound(v2, binary.LittleEndian.Uint64(b[8:]))
+			v3 = xxRound(v3, binary.LittleEndian.Uint64(b[16:]))
+			v4 = xxRound(v4, binary.LittleEndian.Uint64(b[24:]))
+		}
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		h = xxMergeRound(h, v1)
+		h = xxMergeRound(h, v2)
+		h = xxMergeRound(h, v3)
+		h = xxMergeRound(h, v4)
+	} else {
+		h = seed + xxPrime5
+	}
+	h += n
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= xxRound(0, binary.LittleEndian.Uint64(b))
+		h = bits.RotateLeft64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b)) * xxPrime1
+		h = bits.RotateLeft64(h, 23)*xxPrime2 + xxPrime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * xxPrime5
+		h = bits.RotateLeft64(h, 11) * xxPrime1
+	}
+	return xxAvalanche(h)
+}
+
+func (XXHashMixer) hash(s *HashState, b []byte) {
+	h0, h1 := s.Uint64s()
+	x := xxHash64(h0, b)
+	s.SetUint64s(x, xxAvalanche(x^(h1*xxPrime5)))
+}
+
+func (m XXHashMixer) HashUint64(s *HashState, x0, x1, x2, x3 uint64) {
+	var b [32]byte
+	m.hash(s, hashUint64Bytes(&b, x0, x1, x2, x3))
+}
+
+func (m XXHashMixer) HashPointer(s *HashState, p unsafe.Pointer, size uintptr) {
+	m.hash(s, hashBytes(p, size))
+}
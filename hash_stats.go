@@ -0,0 +1,177 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elib
+
+import (
+	"fmt"
+	"io"
+)
+
+// Power of 2 histogram: bin 0 counts zeros, bin i > 0 counts [2^(i-1), 2^i).
+// Largest bin counts everything >= 2^(hashHistogramBins-2).
+const hashHistogramBins = 9
+
+type hashHistogram [hashHistogramBins]uint64
+
+func hashHistogramBin(x uint) (i uint) {
+	if x != 0 {
+		i = 1 + MinLog2(Word(x))
+	}
+	if i >= hashHistogramBins {
+		i = hashHistogramBins - 1
+	}
+	return
+}
+
+func (h *hashHistogram) add(x uint) { h[hashHistogramBin(x)]++ }
+
+func hashHistogramRange(i int) string {
+	switch {
+	case i == 0:
+		return "0"
+	case i == 1:
+		return "1"
+	case i == hashHistogramBins-1:
+		return fmt.Sprintf("%d+", 1<<uint(i-1))
+	default:
+		return fmt.Sprintf("%d-%d", 1<<uint(i-1), 1<<uint(i)-1)
+	}
+}
+
+// HashSearchStats summarizes searches done by Get, Set or Unset.
+type HashSearchStats struct {
+	Calls    uint64
+	Searches uint64
+	Compares uint64
+	// Histogram of number of slots probed beyond base slot per call.
+	Probes [hashHistogramBins]uint64
+}
+
+func (s *stats) public() HashSearchStats {
+	return HashSearchStats{Calls: s.calls, Searches: s.searches, Compares: s.compares, Probes: s.probes}
+}
+
+// HashSubTableStats gives occupancy of one of the (at most 2) power of 2 sized sub-tables.
+type HashSubTableStats struct {
+	Table   int    `format:"%5d"`
+	Log2Cap uint   `format:"%8d"`
+	Cap     uint   `format:"%10d"`
+	Elts    uint   `format:"%10d"`
+	Load    string `align:"right"`
+}
+
+// HashHistogramRow is one row of a tabulated histogram.
+type HashHistogramRow struct {
+	Range    string `align:"right"`
+	Distance uint64 `format:"%12d"`
+	Get      uint64 `format:"%12d"`
+	Set      uint64 `format:"%12d"`
+	Unset    uint64 `format:"%12d"`
+}
+
+// HashStats gives statistics for a hash table.
+type HashStats struct {
+	Elts, Cap         uint
+	Log2EltsPerBucket uint
+	// Number of times table capacity was increased; copies is number of attempts to
+	// copy elements into resized table; resizes is number of successful copies.
+	Grows, Copies, Resizes uint64
+
+	SubTables []HashSubTableStats
+
+	// Histogram of distance of elements from their base slot (bit difference).
+	Distances [hashHistogramBins]uint64
+	// Largest distance of any element from its base slot.
+	MaxDistance uint
+
+	Get, Set, Unset HashSearchStats
+}
+
+// Stats computes hash table statistics.
+func (h *Hash) Stats() (s HashStats) {
+	s.Elts, s.Cap = h.Elts(), h.Cap()
+	s.Log2EltsPerBucket = uint(h.log2EltsPerBucket)
+	s.Grows, s.Copies, s.Resizes = h.stats.grows, h.stats.copies, h.epoch
+	s.Get, s.Set, s.Unset = h.stats.get.public(), h.stats.set.public(), h.stats.unset.public()
+
+	// Table 0 is first 2^log2Cap[0] slots; table 1 (if any) is the rest.
+	n0 := uint(1) << h.log2Cap[0]
+	if l := uint(len(h.bitDiffs)); n0 > l {
+		n0 = l
+	}
+	var elts [2]uint
+	for i := range h.bitDiffs {
+		d := h.bitDiffs[i]
+		if !d.isValid() {
+			continue
+		}
+		dist := uint(d) - 1
+		s.Distances[hashHistogramBin(dist)]++
+		if dist > s.MaxDistance {
+			s.MaxDistance = dist
+		}
+		if uint(i) < n0 {
+			elts[0]++
+		} else {
+			elts[1]++
+		}
+	}
+
+	for t := range elts {
+		c := n0
+		if t == 1 {
+			c = uint(len(h.bitDiffs)) - n0
+		}
+		if c == 0 {
+			continue
+		}
+		s.SubTables = append(s.SubTables, HashSubTableStats{
+			Table:   t,
+			Log2Cap: uint(h.log2Cap[t]),
+			Cap:     c,
+			Elts:    elts[t],
+			Load:    fmt.Sprintf("%.2f%%", 100*float64(elts[t])/float64(c)),
+		})
+	}
+	return
+}
+
+// Histogram returns distance and probe histograms as rows suitable for Tabulate.
+func (s *HashStats) Histogram() (rows []HashHistogramRow) {
+	for i := 0; i < hashHistogramBins; i++ {
+		r := HashHistogramRow{
+			Range:    hashHistogramRange(i),
+			Distance: s.Distances[i],
+			Get:      s.Get.Probes[i],
+			Set:      s.Set.Probes[i],
+			Unset:    s.Unset.Probes[i],
+		}
+		if r.Distance+r.Get+r.Set+r.Unset != 0 {
+			rows = append(rows, r)
+		}
+	}
+	return
+}
+
+func (s *HashStats) String() string {
+	return fmt.Sprintf("elts %d, cap %d, bucket: 2^%d, grows %d, copies %d, resizes %d, max distance %d",
+		s.Elts, s.Cap, s.Log2EltsPerBucket, s.Grows, s.Copies, s.Resizes, s.MaxDistance)
+}
+
+// Write writes summary, per sub-table occupancy and histograms as tables.
+func (s *HashStats) Write(w io.Writer) {
+	fmt.Fprintln(w, s)
+	Tabulate(s.SubTables).Write(w)
+	if rows := s.Histogram(); len(rows) > 0 {
+		Tabulate(rows).Write(w)
+	}
+}
+
+// ClearStats resets get, set and unset search statistics.
+func (h *Hash) ClearStats() {
+	h.stats.get = stats{}
+	h.stats.set = stats{}
+	h.stats.unset = stats{}
+}
@@ -0,0 +1,234 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elib
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"unsafe"
+)
+
+func (h *uiHash) set(k uiKey) uint {
+	i, _ := h.Set(&k)
+	h.pairs[i] = uiPair{key: k, value: uiValue(k)}
+	return i
+}
+
+func TestHashIterator(t *testing.T) {
+	var h uiHash
+	h.Init(&h, 16)
+	const n = 64
+	for k := uiKey(0); k < n; k++ {
+		h.set(k)
+	}
+
+	seen := make(map[uiKey]int)
+	it := h.Iterator()
+	epoch := h.Epoch()
+	for i, ok := it.Next(); ok; i, ok = it.Next() {
+		k := h.pairs[i].key
+		if k >= n {
+			continue
+		}
+		seen[k]++
+		// Unset one key not yet visited (maybe) and add new keys forcing resizes.
+		if k%2 == 0 {
+			u := (k + n/2) % n
+			if seen[u] == 0 {
+				if _, ok := h.Unset(&u); ok {
+					seen[u] = -1
+				}
+			}
+		}
+		for j := uiKey(0); j < 8; j++ {
+			h.set(1000 + 8*k + j)
+		}
+	}
+	if h.Epoch() == epoch {
+		t.Fatalf("no resize during iteration")
+	}
+	for k := uiKey(0); k < n; k++ {
+		if c := seen[k]; c != 1 && c != -1 {
+			t.Errorf("key %d visited %d times", k, c)
+		}
+	}
+	if h.nIterators != 0 || len(h.resizeLog) != 0 {
+		t.Errorf("iterator not closed")
+	}
+
+	elts := h.Elts()
+	removed := h.DeleteIf(func(i uint) bool { return h.pairs[i].key >= 1000 })
+	if h.Elts() != elts-removed || h.Elts() > n {
+		t.Errorf("DeleteIf: elts %d removed %d left %d", elts, removed, h.Elts())
+	}
+	h.Filter(func(i uint) bool { return h.pairs[i].key < 10 })
+	for _, i := range h.Snapshot() {
+		if k := h.pairs[i].key; k >= 10 {
+			t.Errorf("Filter: key %d remains", k)
+		}
+	}
+}
+
+type concurrentTestKey uint64
+
+func (k concurrentTestKey) HashKey(s *HashState) { s.HashUint64(uint64(k), 0, 0, 0) }
+
+// Run with -race.
+func TestConcurrentHash(t *testing.T) {
+	var (
+		h    ConcurrentHash[concurrentTestKey, uint64]
+		wg   sync.WaitGroup
+		stop atomic.Bool
+	)
+	const nKeys = 1 << 10
+	h.Init(16)
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(r)))
+			for !stop.Load() {
+				k := concurrentTestKey(rng.Intn(nKeys))
+				if v, ok := h.Get(k); ok && v != 2*uint64(k) {
+					t.Errorf("Get %d: got %d want %d", k, v, 2*k)
+					return
+				}
+			}
+		}(r)
+	}
+	rng := rand.New(rand.NewSource(0))
+	inserted := make(map[concurrentTestKey]bool)
+	for i := 0; i < 4000; i++ {
+		k := concurrentTestKey(rng.Intn(nKeys))
+		if inserted[k] {
+			if !h.Unset(k) {
+				t.Fatalf("Unset %d: not found", k)
+			}
+			delete(inserted, k)
+		} else {
+			if h.Set(k, 2*uint64(k)) {
+				t.Fatalf("Set %d: already exists", k)
+			}
+			inserted[k] = true
+		}
+	}
+	stop.Store(true)
+	wg.Wait()
+
+	if got, want := h.Elts(), uint(len(inserted)); got != want {
+		t.Errorf("Elts: got %d want %d", got, want)
+	}
+	n := 0
+	h.Foreach(func(k concurrentTestKey, v uint64) {
+		if !inserted[k] || v != 2*uint64(k) {
+			t.Errorf("Foreach: unexpected %d %d", k, v)
+		}
+		n++
+	})
+	if n != len(inserted) {
+		t.Errorf("Foreach: visited %d want %d", n, len(inserted))
+	}
+}
+
+func TestHashMixer(t *testing.T) {
+	b := []byte("123456789")
+	var s HashState
+	s.SetMixer(CRC32CMixer{})
+	s.HashPointer(unsafe.Pointer(&b[0]), uintptr(len(b)))
+	if _, h1 := s.Uint64s(); uint32(h1) != 0xe3069283 {
+		t.Errorf("crc32c: got %x want e3069283", uint32(h1))
+	}
+
+	for _, c := range []struct {
+		s string
+		h uint64
+	}{
+		{"", 0xef46db3751d8e999},
+		{"abc", 0x44bc2cf5ad770999},
+	} {
+		if got := xxHash64(0, []byte(c.s)); got != c.h {
+			t.Errorf("xxhash %q: got %x want %x", c.s, got, c.h)
+		}
+	}
+
+	// Same seed and same operations must give same table layout.
+	for _, m := range []HashMixer{nil, CRC32CMixer{}, XXHashMixer{}} {
+		var h [2]uiHash
+		for i := range h {
+			h[i].SetMixer(m)
+			h[i].SetSeed(1, 2)
+			h[i].Init(&h[i], 16)
+			for k := uiKey(0); k < 500; k++ {
+				h[i].set(3 * k)
+			}
+		}
+		for k := uiKey(0); k < 500; k++ {
+			key := 3 * k
+			i0, ok0 := h[0].Get(&key)
+			i1, ok1 := h[1].Get(&key)
+			if !ok0 || !ok1 || i0 != i1 {
+				t.Fatalf("mixer %T: key %d at %d %v and %d %v", m, key, i0, ok0, i1, ok1)
+			}
+		}
+	}
+}
+
+func BenchmarkHashMixPointer(b *testing.B) {
+	for _, m := range []HashMixer{nil, CRC32CMixer{}, XXHashMixer{}} {
+		for _, size := range []int{16, 64, 1024} {
+			name := "default"
+			if m != nil {
+				name = fmt.Sprintf("%T", m)[len("elib."):]
+			}
+			data := make([]byte, size)
+			b.Run(fmt.Sprintf("%s/%d", name, size), func(b *testing.B) {
+				var s HashState
+				s.SetMixer(m)
+				b.SetBytes(int64(size))
+				for i := 0; i < b.N; i++ {
+					s.HashPointer(unsafe.Pointer(&data[0]), uintptr(size))
+				}
+			})
+		}
+	}
+}
+
+func TestHashStats(t *testing.T) {
+	var h uiHash
+	h.Init(&h, 16)
+	for k := uiKey(0); k < 1000; k++ {
+		h.set(k)
+	}
+	for k := uiKey(0); k < 1000; k++ {
+		h.Get(&k)
+	}
+	s := h.Stats()
+	var elts, dists, gets uint64
+	for _, st := range s.SubTables {
+		elts += uint64(st.Elts)
+	}
+	for i := range s.Distances {
+		dists += s.Distances[i]
+		gets += s.Get.Probes[i]
+	}
+	if elts != 1000 || dists != 1000 || uint64(s.Elts) != 1000 {
+		t.Errorf("elts: sub-tables %d distances %d want 1000", elts, dists)
+	}
+	if gets != 1000 || s.Get.Calls != 1000 {
+		t.Errorf("get probes %d calls %d want 1000", gets, s.Get.Calls)
+	}
+	if s.Resizes == 0 || s.Resizes > s.Copies {
+		t.Errorf("resizes %d copies %d", s.Resizes, s.Copies)
+	}
+	var b strings.Builder
+	s.Write(&b)
+	if !strings.Contains(b.String(), "Distance") {
+		t.Errorf("Write: missing histogram\n%s", b.String())
+	}
+}
@@ -50,6 +50,9 @@ type HeapUsage struct {
 func (heap *Heap) GetUsage() (u HeapUsage) {
 	for i := range heap.elts {
 		e := &heap.elts[i]
+		if e.isRemoved() {
+			continue
+		}
 		size := uint64(heap.eltSize(e))
 		if e.isFree() {
 			u.Free += size
@@ -80,6 +83,11 @@ func (e *heapElt) isFree() bool {
 	return e.free != MaxIndex
 }
 
+// Removed elts are poisoned and kept for reuse by newElt.
+func (e *heapElt) isRemoved() bool {
+	return e.offset == MaxIndex
+}
+
 func (heap *Heap) freeAfter(ei, eSize, freeSize Index) {
 	// Fetch elt and new free elt.
 	fi := heap.newElt()
@@ -247,7 +255,7 @@ func (heap *Heap) get(sizeArg uint, size Index) (id Index, offset uint) {
 	}
 
 	if heap.len == 0 {
-		heap.head = 0
+		heap.head = MaxIndex
 		heap.tail = MaxIndex
 	}
 
@@ -266,6 +274,8 @@ func (heap *Heap) get(sizeArg uint, size Index) (id Index, offset uint) {
 
 	if e.prev != MaxIndex {
 		heap.elts[e.prev].next = ei
+	} else {
+		heap.head = ei
 	}
 
 	id = ei
@@ -398,7 +408,7 @@ func (heap *Heap) String() (s string) {
 func (heap *Heap) Foreach(f func(offset, len uint)) {
 	for ei := range heap.elts {
 		e := &heap.elts[ei]
-		if !e.isFree() {
+		if !e.isFree() && !e.isRemoved() {
 			f(uint(e.offset), uint(heap.eltSize(e)))
 		}
 	}
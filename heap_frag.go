@@ -0,0 +1,146 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elib
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// HeapFragStats describes fragmentation of heap free space.
+type HeapFragStats struct {
+	HeapUsage
+	// Number of free blocks and size of largest free block.
+	FreeBlocks, LargestFree uint64
+	// Histogram of free block sizes: bin i counts blocks with size in [2^i, 2^(i+1)).
+	FreeSizes [64]uint64
+}
+
+// Fragmentation is the fraction of free space not in largest free block: 0 means all free space is contiguous.
+func (s *HeapFragStats) Fragmentation() float64 {
+	if s.Free == 0 {
+		return 0
+	}
+	return 1 - float64(s.LargestFree)/float64(s.Free)
+}
+
+// HeapFreeSizeRow is one row of tabulated free block size histogram.
+type HeapFreeSizeRow struct {
+	Size   string `align:"right"`
+	Blocks uint64 `format:"%12d"`
+}
+
+// Histogram returns non-empty bins of free block size histogram as rows suitable for Tabulate.
+// Sizes are multiplied by unit (e.g. bytes per heap element).
+func (s *HeapFragStats) Histogram(unit uint64) (rows []HeapFreeSizeRow) {
+	for i := range s.FreeSizes {
+		if s.FreeSizes[i] == 0 {
+			continue
+		}
+		lo, hi := unit<<uint(i), unit<<uint(i+1)-1
+		rows = append(rows, HeapFreeSizeRow{
+			Size:   fmt.Sprintf("%s-%s", MemorySize(lo), MemorySize(hi)),
+			Blocks: s.FreeSizes[i],
+		})
+	}
+	return
+}
+
+func (s *HeapFragStats) String() string {
+	return fmt.Sprintf("used %d, free %d in %d blocks, largest free %d, fragmentation %.2f%%",
+		s.Used, s.Free, s.FreeBlocks, s.LargestFree, 100*s.Fragmentation())
+}
+
+// GetFragStats returns usage and free block statistics; sizes are in heap elements.
+func (heap *Heap) GetFragStats() (s HeapFragStats) {
+	for i := range heap.elts {
+		e := &heap.elts[i]
+		if e.isRemoved() {
+			continue
+		}
+		size := uint64(heap.eltSize(e))
+		if !e.isFree() {
+			s.Used += size
+			continue
+		}
+		s.Free += size
+		s.FreeBlocks++
+		if size > s.LargestFree {
+			s.LargestFree = size
+		}
+		s.FreeSizes[bits.Len64(size)-1]++
+	}
+	return
+}
+
+// Compact moves allocated elements towards offset 0 so that all free space is
+// released at end of heap.  Element ids are unchanged; f (if non-nil) is called in
+// increasing offset order for each element which moves with its old and new offset
+// before next element is moved.  New offsets are never larger than old offsets so
+// caller may copy data in callback.
+// Alignment is preserved: new offset is a multiple of the largest power of 2 dividing
+// old offset up to a maximum of 2^log2MaxAlign.
+// Returns number of elements freed at end of heap.
+func (heap *Heap) Compact(log2MaxAlign uint, f func(id Index, oldOffset, newOffset, size uint)) (freed uint) {
+	type live struct {
+		id           Index
+		offset, size Index
+	}
+	var lives []live
+	for ei := heap.head; heap.len > 0 && ei != MaxIndex; {
+		e := &heap.elts[ei]
+		next := e.next
+		if e.isFree() {
+			*e = poison
+			heap.removed = append(heap.removed, ei)
+		} else {
+			lives = append(lives, live{id: ei, offset: e.offset, size: heap.size(ei)})
+		}
+		ei = next
+	}
+	for i := range heap.free {
+		heap.free[i] = heap.free[i][:0]
+	}
+
+	// Link element at end of list.
+	var prev Index = MaxIndex
+	heap.head = MaxIndex
+	link := func(ei, offset Index) {
+		e := &heap.elts[ei]
+		e.offset = offset
+		e.prev = prev
+		e.next = MaxIndex
+		if prev == MaxIndex {
+			heap.head = ei
+		} else {
+			heap.elts[prev].next = ei
+		}
+		prev = ei
+	}
+
+	o := Index(0)
+	for i := range lives {
+		l := &lives[i]
+		a := Index(1) << log2MaxAlign
+		if l.offset != 0 && l.offset&-l.offset < a {
+			a = l.offset & -l.offset
+		}
+		no := (o + a - 1) &^ (a - 1)
+		if no > o {
+			gi := heap.newElt()
+			link(gi, o)
+			heap.freeElt(gi, no-o)
+		}
+		link(l.id, no)
+		if no != l.offset && f != nil {
+			f(l.id, uint(l.offset), uint(no), uint(l.size))
+		}
+		o = no + l.size
+	}
+	freed = uint(heap.len - o)
+	heap.len = o
+	heap.tail = prev
+	return
+}
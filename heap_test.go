@@ -5,6 +5,7 @@
 package elib
 
 import (
+	"math/rand"
 	"testing"
 )
 
@@ -19,3 +20,86 @@ func TestHeap(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestHeapCompact(t *testing.T) {
+	var (
+		h    Heap
+		data []uint
+	)
+	type obj struct {
+		offset, len, align uint
+	}
+	objs := make(map[Index]*obj)
+	rng := rand.New(rand.NewSource(1))
+	for iter := 0; iter < 2000; iter++ {
+		n := 1 + uint(rng.Intn(64))
+		a := uint(rng.Intn(4))
+		id, o := h.GetAligned(n, a)
+		for uint(len(data)) < o+n {
+			data = append(data, 0)
+		}
+		for i := uint(0); i < n; i++ {
+			data[o+i] = uint(id)
+		}
+		objs[id] = &obj{offset: o, len: n, align: a}
+		// Free about half of objects.
+		if rng.Intn(2) == 0 {
+			h.Put(id)
+			delete(objs, id)
+		}
+	}
+	u := h.GetUsage()
+	s := h.GetFragStats()
+	if s.HeapUsage != u {
+		t.Fatalf("frag stats usage %+v != %+v", s.HeapUsage, u)
+	}
+	nFree := uint64(0)
+	for _, n := range s.FreeSizes {
+		nFree += n
+	}
+	if nFree != s.FreeBlocks || s.LargestFree > s.Free {
+		t.Fatalf("bad frag stats %s", &s)
+	}
+
+	lastOffset := uint(0)
+	h.Compact(3, func(id Index, o, n, size uint) {
+		if n > o || o < lastOffset {
+			t.Fatalf("bad move %d %d -> %d", id, o, n)
+		}
+		lastOffset = o
+		copy(data[n:n+size], data[o:o+size])
+		objs[id].offset = n
+	})
+	if err := h.validate(); err != nil {
+		t.Fatal(err)
+	}
+	for id, o := range objs {
+		if o.offset&(1<<o.align-1) != 0 {
+			t.Fatalf("id %d offset %d not aligned 2^%d", id, o.offset, o.align)
+		}
+		if got, l := h.GetID(id); uint(got) != o.offset || uint(l) < o.len {
+			t.Fatalf("id %d offset %d len %d != %d %d", id, got, l, o.offset, o.len)
+		}
+		for i := uint(0); i < o.len; i++ {
+			if data[o.offset+i] != uint(id) {
+				t.Fatalf("id %d data mismatch at %d", id, o.offset+i)
+			}
+		}
+	}
+	s = h.GetFragStats()
+	if s.Used != u.Used {
+		t.Fatalf("used %d != %d after compaction", s.Used, u.Used)
+	}
+	// Only alignment padding remains free; each pad is < 2^3.
+	if s.LargestFree >= 8 {
+		t.Fatalf("free block %d after compaction", s.LargestFree)
+	}
+	// Heap still works after compaction.
+	for id := range objs {
+		h.Put(id)
+	}
+	h.Get(10)
+	if err := h.validate(); err != nil {
+		t.Fatal(err)
+	}
+}
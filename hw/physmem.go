@@ -19,3 +19,10 @@ func DmaGetData(id elib.Index) (b []byte)                         { return heap.
 func DmaGetPointer(o uint) unsafe.Pointer                         { return heap.Data(o) }
 func DmaIsValidOffset(o uint) bool                                { return heap.OffsetValid(o) }
 func DmaHeapUsage() string                                        { return heap.String() }
+
+func DmaHeapFragStats() elib.HeapFragStats { return heap.GetFragStats() }
+
+// DmaCompact compacts DMA heap; see elib.MemHeap.Compact.
+func DmaCompact(log2MaxAlign uint, f func(id elib.Index, oldOffset, newOffset, size uint)) {
+	heap.Compact(log2MaxAlign, f)
+}
@@ -16,32 +16,64 @@ import (
 
 type stats struct {
 	calls, vectors, suspends, clocks uint64
+	// Clocks spent suspended; not included in clocks.
+	suspendClocks uint64
 }
 
 type nodeStats struct {
 	current, lastClear stats
 }
 
-func (s *nodeStats) clear() { s.lastClear = s.current }
+// Stats are written by the node's own goroutine (poller or event handler) and read
+// concurrently by metrics and cli so all accesses are atomic.
+func (s *stats) load() (x stats) {
+	x.calls = atomic.LoadUint64(&s.calls)
+	x.vectors = atomic.LoadUint64(&s.vectors)
+	x.suspends = atomic.LoadUint64(&s.suspends)
+	x.clocks = atomic.LoadUint64(&s.clocks)
+	x.suspendClocks = atomic.LoadUint64(&s.suspendClocks)
+	return
+}
+
+func (s *stats) store(x stats) {
+	atomic.StoreUint64(&s.calls, x.calls)
+	atomic.StoreUint64(&s.vectors, x.vectors)
+	atomic.StoreUint64(&s.suspends, x.suspends)
+	atomic.StoreUint64(&s.clocks, x.clocks)
+	atomic.StoreUint64(&s.suspendClocks, x.suspendClocks)
+}
+
+// Account for time spent suspended: charge it to suspendClocks of s and remove it from clocks of o.
+func (s *stats) suspended(o *stats, dt cpu.Time) {
+	atomic.AddUint64(&o.clocks, -uint64(dt))
+	atomic.AddUint64(&s.suspendClocks, uint64(dt))
+}
+
+func (s *nodeStats) clear() { s.lastClear.store(s.current.load()) }
 func (s *nodeStats) zero() {
 	var z stats
-	s.current = z
-	s.lastClear = z
+	s.current.store(z)
+	s.lastClear.store(z)
+}
+func (s *nodeStats) clocksSinceLastClear() uint64 {
+	return atomic.LoadUint64(&s.current.clocks) - atomic.LoadUint64(&s.lastClear.clocks)
 }
-func (s *nodeStats) clocksSinceLastClear() uint64 { return s.current.clocks - s.lastClear.clocks }
 
 func (s *stats) add_helper(n *nodeStats, raw bool) {
-	c, v, d, l := n.current.calls, n.current.vectors, n.current.suspends, n.current.clocks
+	x := n.current.load()
 	if !raw {
-		c -= n.lastClear.calls
-		v -= n.lastClear.vectors
-		l -= n.lastClear.clocks
-		d -= n.lastClear.suspends
+		lc := n.lastClear.load()
+		x.calls -= lc.calls
+		x.vectors -= lc.vectors
+		x.clocks -= lc.clocks
+		x.suspends -= lc.suspends
+		x.suspendClocks -= lc.suspendClocks
 	}
-	s.calls += c
-	s.vectors += v
-	s.suspends += d
-	s.clocks += l
+	atomic.AddUint64(&s.calls, x.calls)
+	atomic.AddUint64(&s.vectors, x.vectors)
+	atomic.AddUint64(&s.suspends, x.suspends)
+	atomic.AddUint64(&s.clocks, x.clocks)
+	atomic.AddUint64(&s.suspendClocks, x.suspendClocks)
 }
 
 func (s *stats) add(n *nodeStats)     { s.add_helper(n, false) }
@@ -58,6 +90,7 @@ type activeNode struct {
 	// Index in activePoller.activeNodes and also loop.dataNodes.
 	index                   uint32
 	elogNodeName            elog.StringRef
+	elogTrack               uint
 	loopInMaker             loopInMaker
 	inOutLooper             inOutLooper
 	outLooper               outLooper
@@ -296,9 +329,72 @@ func (l *Loop) AddNamedNext(thisNoder Noder, nextName string) (uint, error) {
 	return l.AddNamedNextWithIndex(thisNoder, nextName, ^uint(0))
 }
 
+// ReplaceNamedNext points existing next index of node to a different next node.
+// Vectors sent to given next index will then go to the new next node.
+// As UnregisterNode it waits for running data pollers to finish.
+func (l *Loop) ReplaceNamedNext(nr Noder, nextIndex uint, nextName string) (err error) {
+	l.pollerLock.Lock()
+	defer l.pollerLock.Unlock()
+	n := nr.GetNode()
+
+	if nextIndex >= n.nextNodes.Len() || len(n.nextNodes[nextIndex].name) == 0 {
+		err = fmt.Errorf("replace-next %s: no next with index %d", n.name, nextIndex)
+		return
+	}
+	if len(nextName) == 0 {
+		err = fmt.Errorf("replace-next %s: nil next", n.name)
+		return
+	}
+	nextNode := &n.nextNodes[nextIndex]
+	if x, ok := n.nextIndexByNodeName[nextName]; ok {
+		if x != nextIndex {
+			err = fmt.Errorf("replace-next %s: %s is already next with index %d", n.name, nextName, x)
+		}
+		return
+	}
+
+	var (
+		nextNoder Noder
+		xi        inNoder
+		ok        bool
+	)
+	if l.initialNodesRegistered {
+		if nextNoder, ok = l.noderByName[nextName]; !ok {
+			err = fmt.Errorf("replace-next %s: unknown next %s", n.name, nextName)
+			return
+		}
+		if xi, ok = nextNoder.(inNoder); !ok {
+			err = fmt.Errorf("replace-next %s: %s is not input node", n.name, nextName)
+			return
+		}
+	}
+
+	delete(n.nextIndexByNodeName, nextNode.name)
+	n.nextIndexByNodeName[nextName] = nextIndex
+	nextNode.name = nextName
+
+	if nextNoder != nil {
+		nextNode.nodeIndex = nextNoder.GetNode().index
+		nextNode.in = xi.MakeLoopIn()
+		for _, p := range l.activePollerPool.entries {
+			if p != nil {
+				p.activeNodes[n.index].addNext(p, nextNode, nextIndex)
+			}
+		}
+	}
+	return
+}
+
+func (l *Loop) ReplaceNext(n Noder, nextIndex uint, x inNoder) error {
+	return l.ReplaceNamedNext(n, nextIndex, nodeName(x))
+}
+
 func (l *Loop) graphInit() {
 	l.initialNodesRegistered = true
 	for _, n := range l.noders {
+		if n == nil {
+			continue
+		}
 		x := n.GetNode()
 		for i := range x.nextNodes {
 			if xn := &x.nextNodes[i]; len(xn.name) > 0 {
@@ -310,29 +406,60 @@ func (l *Loop) graphInit() {
 	}
 }
 
+func (ap *activePoller) initActiveNode(l *Loop, ni uint) {
+	a := &ap.activeNodes[ni]
+	*a = activeNode{index: uint32(ni)}
+	r, n := l.noders[ni], l.nodes[ni]
+	// Unregistered node?
+	if r == nil {
+		return
+	}
+	a.elogNodeName = n.elogNodeName
+	a.elogTrack = n.elogTrack
+	if d, ok := r.(outNoder); ok {
+		a.looperOut = d.MakeLoopOut()
+		a.out = a.looperOut.GetOut()
+	}
+	if d, ok := r.(loopInMaker); ok {
+		a.loopInMaker = d
+	}
+	if d, ok := r.(inOutLooper); ok {
+		a.inOutLooper = d
+	}
+	if d, ok := r.(outLooper); ok {
+		a.outLooper = d
+	}
+	if err := a.analyze(l, ap); err != nil {
+		l.Fatalf("%s: %s", nodeName(n), err)
+	}
+}
+
 func (ap *activePoller) initActiveNodes(l *Loop) {
 	nNodes := uint(len(l.noders))
 	ap.activeNodes = make([]activeNode, nNodes)
 	for ni := range ap.activeNodes {
-		a := &ap.activeNodes[ni]
-		r, n := l.noders[ni], l.nodes[ni]
-		a.index = uint32(ni)
-		a.elogNodeName = n.elogNodeName
-		if d, ok := r.(outNoder); ok {
-			a.looperOut = d.MakeLoopOut()
-			a.out = a.looperOut.GetOut()
-		}
-		if d, ok := r.(loopInMaker); ok {
-			a.loopInMaker = d
-		}
-		if d, ok := r.(inOutLooper); ok {
-			a.inOutLooper = d
+		ap.initActiveNode(l, uint(ni))
+	}
+}
+
+// Makes room for node with given index in all active pollers (even non-nil free ones)
+// for nodes registered while loop is running.
+func (l *Loop) validateActiveNodes(ni uint) {
+	for _, p := range l.activePollerPool.entries {
+		if p == nil {
+			continue
 		}
-		if d, ok := r.(outLooper); ok {
-			a.outLooper = d
+		for uint(len(p.activeNodes)) <= ni {
+			p.activeNodes = append(p.activeNodes, activeNode{index: uint32(len(p.activeNodes))})
 		}
-		if err := a.analyze(l, ap); err != nil {
-			l.Fatalf("%s: %s", nodeName(n), err)
+	}
+}
+
+// Initializes active node in all active pollers once node's next nodes have been added.
+func (l *Loop) initActiveNode(n *Node) {
+	for _, p := range l.activePollerPool.entries {
+		if p != nil {
+			p.initActiveNode(l, n.index)
 		}
 	}
 }
@@ -418,9 +545,9 @@ func (f *Out) totalVectors(a *activePoller) (nVec uint) {
 func (n *nodeStats) update(nVec uint, tStart cpu.Time) (tNow cpu.Time) {
 	tNow = cpu.TimeNow()
 	s := &n.current
-	s.calls++
-	s.vectors += uint64(nVec)
-	s.clocks += uint64(tNow - tStart)
+	atomic.AddUint64(&s.calls, 1)
+	atomic.AddUint64(&s.vectors, uint64(nVec))
+	atomic.AddUint64(&s.clocks, uint64(tNow-tStart))
 	return
 }
 
@@ -440,7 +567,7 @@ func (f *Out) call(l *Loop, a *activePoller) (nVec uint) {
 			n_vectors: uint32(nVec),
 			is_input:  true,
 		}
-		elog.Add(&e)
+		elog.AddTrack(&e, prevNode.elogTrack)
 	}
 	if nVec == 0 {
 		return
@@ -481,7 +608,7 @@ func (f *Out) call(l *Loop, a *activePoller) (nVec uint) {
 				name:      next.elogNodeName,
 				n_vectors: uint32(nextN),
 			}
-			elog.Add(&e)
+			elog.AddTrack(&e, next.elogTrack)
 		}
 
 		nextIn := prevNode.outIns[xi]
@@ -570,11 +697,13 @@ type inOutLooper interface {
 }
 
 type call_elog struct {
-	name      elog.StringRef
-	n_vectors uint32
-	is_input  bool
+	name      elog.StringRef `elog:"node"`
+	n_vectors uint32         `elog:"vectors"`
+	is_input  bool           `elog:"input"`
 }
 
+func init() { elog.RegisterType(&call_elog{}) }
+
 func (e *call_elog) Elog(l *elog.Log) {
 	nv := e.n_vectors
 	if e.is_input {
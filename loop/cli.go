@@ -90,6 +90,9 @@ func (m *loggerMain) Fatalf(format string, args ...interface{}) { panic(fmt.Erro
 func (l *Loop) showRuntimeNext(w cli.Writer) (err error) {
 	fmt.Fprintf(w, "%-30s %-20s %-5s %s\n", "Name", "State", "Index", "Next")
 	for _, n := range l.nodes {
+		if n == nil {
+			continue
+		}
 		ns := fmt.Sprintf("%v", n.Next)
 		ni := fmt.Sprintf("%v", n.nextIndexByNodeName)
 		fmt.Fprintf(w, "%-30s %-20s %-5d Next:  %s\n", n.name, n.s.String(), n.index, ns)
@@ -143,6 +146,9 @@ func (l *Loop) showRuntimeStats(c cli.Commander, w cli.Writer, in *cli.Input) (e
 	ns := []node{}
 	var inputSummary stats
 	for _, n := range l.nodes {
+		if n == nil {
+			continue
+		}
 		var s [2]stats
 		s[0].add(&n.inputStats)
 		inputSummary.add(&n.inputStats)
@@ -204,6 +210,9 @@ func (l *Loop) clearRuntimeStats(c cli.Commander, w cli.Writer, in *cli.Input) (
 	l.flushAllActivePollerStats()
 	l.timeLastRuntimeClear = time.Now()
 	for _, n := range l.nodes {
+		if n == nil {
+			continue
+		}
 		n.inputStats.clear()
 		n.outputStats.clear()
 		n.e.eventStats.clear()
@@ -217,17 +226,32 @@ func (l *Loop) showEventLog(c cli.Commander, w cli.Writer, in *cli.Input) (err e
 	matching := ""
 	showFilters := false
 	summary := false
+	stats := false
+	where := ""
+	format := ""
 	for !in.End() {
 		switch {
 		case in.Parse("de%*tail"):
 			detail = true
 		case in.Parse("f%*ilter"):
 			showFilters = true
+		case in.Parse("tr%*iggers"):
+			elog.PrintTriggers(w)
+			return
 		case in.Parse("gr%*aphic"):
 			graphic = true
 		case in.Parse("m%*atching %v", &matching):
+		case in.Parse("sta%*tistics"):
+			stats = true
 		case in.Parse("s%*ummary"):
 			summary = true
+		case in.Parse("w%*here %v", &where):
+		case in.Parse("csv"):
+			format = "csv"
+		case in.Parse("json"):
+			format = "json"
+		case in.Parse("t%*able"):
+			format = "table"
 		default:
 			in.ParseError()
 		}
@@ -246,6 +270,34 @@ func (l *Loop) showEventLog(c cli.Commander, w cli.Writer, in *cli.Input) (err e
 		return
 	}
 
+	if stats {
+		v.Stats().Write(w)
+		return
+	}
+
+	if where != "" || format != "" {
+		var eis []uint
+		if where != "" {
+			if eis, err = v.EventsWhere(where, eis); err != nil {
+				return
+			}
+		}
+		switch format {
+		case "csv":
+			err = v.WriteCSV(w, eis)
+		case "json":
+			err = v.WriteJSON(w, eis)
+		case "table":
+			v.WriteTable(w, eis)
+		default:
+			fmt.Fprintf(w, "%d matching of total %d\n", len(eis), v.NumEvents())
+			if detail {
+				v.PrintEvents(w, eis, detail)
+			}
+		}
+		return
+	}
+
 	if matching != "" {
 		var eis []uint
 		if eis, err = v.EventsMatching(matching, eis); err == nil {
@@ -288,10 +340,75 @@ func (l *Loop) configEventLog(c cli.Commander, w cli.Writer, in *cli.Input) (err
 			elog.AddDelEventFilter(s, false)
 		case in.Parse("re%*size %d", &n_events):
 			elog.Resize(n_events)
+		case in.Parse("sh%*ards %d", &n_events):
+			elog.SetShards(n_events)
 		case in.Parse("disable-after %d", &n_events):
 			elog.DisableAfter(uint64(n_events))
+		case in.Parse("s%*ave %s c%*ompress", &s):
+			v := elog.NewView()
+			v.SetCompress(true)
+			err = v.SaveFile(s)
 		case in.Parse("s%*ave %s", &s):
 			err = elog.SaveFile(s)
+		case in.Parse("chrome-trace %s", &s):
+			err = elog.NewView().SaveChromeTraceFile(s)
+		case in.Parse("perfetto %s", &s):
+			err = elog.NewView().SavePerfettoFile(s)
+		case in.Parse("html %s", &s):
+			err = elog.NewView().SaveHTMLFile(s, nil)
+		case in.Parse("st%*ream f%*ile %s", &s):
+			var (
+				maxBytes uint64  = elog.DefaultStreamMaxBytes
+				maxFiles uint    = elog.DefaultStreamMaxFiles
+				interval float64 = elog.DefaultStreamInterval.Seconds()
+			)
+			for !in.End() {
+				switch {
+				case in.Parse("si%*ze %d", &maxBytes):
+				case in.Parse("fi%*les %d", &maxFiles):
+				case in.Parse("i%*nterval %f", &interval):
+				default:
+					in.ParseError()
+				}
+			}
+			err = elog.StreamToFile(s, int64(maxBytes), int(maxFiles), time.Duration(interval*float64(time.Second)))
+		case in.Parse("st%*ream so%*cket %s", &s):
+			err = elog.StreamToSocket(s, time.Second)
+		case in.Parse("st%*ream st%*op"):
+			err = elog.StopStream()
+		case in.Parse("st%*ream"):
+			if s := elog.GetStream(); s != nil {
+				fmt.Fprintln(w, s)
+			} else {
+				fmt.Fprintln(w, "not streaming")
+			}
+		case in.Parse("tr%*igger a%*dd %s", &s):
+			err = l.addEventLogTrigger(s, in)
+		case in.Parse("tr%*igger d%*elete %s", &s):
+			err = elog.DelTrigger(s)
+		case in.Parse("tr%*igger arm %s", &s):
+			if t := elog.GetTrigger(s); t != nil {
+				t.Arm()
+			} else {
+				err = elog.ErrTriggerNotFound
+			}
+		case in.Parse("tr%*igger f%*ire %s", &s):
+			fmt.Fprintf(w, "%d triggers fired\n", elog.FireTrigger(s))
+		case in.Parse("tr%*igger f%*ire"):
+			fmt.Fprintf(w, "%d triggers fired\n", elog.FireTrigger("cli"))
+		case in.Parse("tr%*igger sh%*ow %s", &s):
+			if t := elog.GetTrigger(s); t == nil {
+				err = elog.ErrTriggerNotFound
+			} else if v := t.LastView(); v != nil {
+				v.Print(w, false)
+			} else {
+				fmt.Fprintln(w, "no snapshot")
+			}
+		case in.Parse("dump-stream %s", &s):
+			var v elog.View
+			if err = v.LoadStreamFiles(s); err == nil {
+				v.Print(w, false)
+			}
 		case in.Parse("d%*ump %s", &s):
 			var v elog.View
 			if err = v.LoadFile(s); err == nil {
@@ -304,6 +421,30 @@ func (l *Loop) configEventLog(c cli.Commander, w cli.Writer, in *cli.Input) (err
 	return
 }
 
+// Parse trigger options: matching REGEXP | on CONDITION, pre N, post N, stop | snapshot [FILE], repeat.
+func (l *Loop) addEventLogTrigger(name string, in *cli.Input) (err error) {
+	t := &elog.Trigger{Name: name}
+	for !in.End() {
+		switch {
+		case in.Parse("m%*atching %v", &t.Matching):
+		case in.Parse("on %s", &t.On):
+		case in.Parse("pre %d", &t.Pre):
+		case in.Parse("post %d", &t.Post):
+		case in.Parse("st%*op"):
+			t.Action = elog.TriggerStop
+		case in.Parse("sn%*apshot %s", &t.File):
+			t.Action = elog.TriggerSnapshot
+		case in.Parse("sn%*apshot"):
+			t.Action = elog.TriggerSnapshot
+		case in.Parse("r%*epeat"):
+			t.Repeat = true
+		default:
+			in.ParseError()
+		}
+	}
+	return elog.AddTrigger(t)
+}
+
 func (l *Loop) exec(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
 	var files []*os.File
 	for !in.End() {
@@ -364,9 +505,29 @@ func (l *Loop) cliInit() {
 		ShortHelp: "clear main loop runtime statistics",
 		Action:    l.clearRuntimeStats,
 	})
+	c.AddCommand(&cli.Command{
+		Name:      "show graph",
+		ShortHelp: "show node graph [dot|json] [NODE-REGEXP]",
+		Action:    l.showGraph,
+	})
+	c.AddCommand(&cli.Command{
+		Name:      "show metrics",
+		ShortHelp: "show runtime statistics in OpenMetrics format [NAME-REGEXP]",
+		Action:    l.showMetrics,
+	})
+	c.AddCommand(&cli.Command{
+		Name:      "show hash",
+		ShortHelp: "show hash table statistics [detail] [NAME-REGEXP]",
+		Action:    l.showHash,
+	})
+	c.AddCommand(&cli.Command{
+		Name:      "clear hash",
+		ShortHelp: "clear hash table search statistics [NAME-REGEXP]",
+		Action:    l.clearHash,
+	})
 	c.AddCommand(&cli.Command{
 		Name:      "show event-log",
-		ShortHelp: "show events in event log",
+		ShortHelp: "show events in event log [statistics] [where {FIELD-EXPR}] [csv|json|table]",
 		Action:    l.showEventLog,
 	})
 	c.AddCommand(&cli.Command{
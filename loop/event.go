@@ -24,8 +24,11 @@ type EventPoller interface {
 }
 
 type eventMain struct {
-	l                 *Loop
-	eventPollers      []EventPoller
+	l            *Loop
+	eventPollers []EventPoller
+
+	// Nodes with event handlers; handlers may be started by node init goroutines.
+	eventHandlerLock  sync.Mutex
 	eventHandlers     []Noder
 	eventHandlerNodes []*Node
 
@@ -51,19 +54,35 @@ type eventNode struct {
 	activeCount uint32
 
 	// Handler sequence to identify events in event log.
+	// Incremented by event handler and read by loop so accessed atomically.
 	sequence       uint32
 	queue_sequence uint32
 
 	rxEvents chan *nodeEvent
 
-	ft fromToNode
+	// Channels of current event handler goroutine; replaced when watchdog abandons a stuck handler.
+	ft *fromToNode
 
 	currentEvent Event
 	s            eventNodeState
 	eventStats   nodeStats
 	activateEvent
 
-	hasHandler bool //true if already has an eventHandler
+	hasHandler atomic.Bool //true if already has an eventHandler
+
+	// Watchdog state: start time of current event (UnixNano) or 0 when not in event,
+	// id of event handler goroutine and number of stalls detected.
+	eventStart int64
+	goid       uint64
+	stalls     uint64
+	// Guards hand off of current event between event handler and watchdog restart.
+	handlerLock sync.Mutex
+	// Handler generation incremented when stuck handler is abandoned; guarded by handlerLock.
+	generation uint32
+	// Event handler is running an event action; guarded by handlerLock.
+	inAction bool
+	// Incremented for each SuspendWTimeout so that stale suspend timeouts can be ignored.
+	suspendSequence uint32
 }
 
 func (l *eventMain) getLoopEvent(a event.Actor, dst Noder, p elog.PointerToFirstArg) (e *nodeEvent) {
@@ -87,6 +106,9 @@ type nodeEvent struct {
 	actor  event.Actor
 	time   cpu.Time
 	caller elog.Caller
+	// Channels and generation of event handler running this event.
+	ft         *fromToNode
+	generation uint32
 }
 
 func (e *nodeEvent) EventTime() cpu.Time { return e.time }
@@ -113,7 +135,7 @@ func (n *Node) SignalEvent(e event.Actor, dst Noder) {
 func (l *Loop) signalEventAfter(le *nodeEvent, secs float64) {
 	// For first signal use current time; for re-signals use time after last signal.
 	if le.time == 0 {
-		le.time = cpu.TimeNow()
+		le.time = l.TimeNow()
 	}
 	le.time += cpu.Time(secs * l.cyclesPerSec)
 	l.timedEventPoolLock.Lock()
@@ -139,7 +161,8 @@ func (e *nodeEvent) logActor() {
 	}
 }
 
-func (e *nodeEvent) do() {
+// Returns true when event was abandoned by watchdog; node then belongs to new event handler.
+func (e *nodeEvent) do() (abandoned bool) {
 	d, n := e.d, &e.d.e
 	if elog.Enabled() {
 		n.log(d, event_elog_action)
@@ -156,26 +179,36 @@ func (e *nodeEvent) do() {
 		panic(fmt.Errorf("event.go do: trying to do EventAction at a nil actor"))
 	}
 	e.actor.EventAction()
+	if !n.endAction(e.generation) {
+		return true
+	}
 	e.d.e.eventStats.update(1, t0)
 	n.log(d, event_elog_action_done)
-	n.sequence++ // done => use next sequence
+	atomic.AddUint32(&n.sequence, 1) // done => use next sequence
 	e.l.putLoopEvent(e)
+	return
 }
 
 func (e *nodeEvent) String() string { return e.actor.String() }
 
-func (d *Node) eventDone() {
+func (d *Node) eventDone(ft *fromToNode) {
 	n := &d.e
 	n.s.setDone(d)
 	n.currentEvent.e = nil
 	n.activeCount--
 	n.log(d, event_elog_node_signal_done)
-	n.ft.signalLoop(true)
+	ft.signalLoop(true)
 	//fmt.Printf("signalLoop(true)================\n") //debug print
 }
 
 func (l *Loop) eventHandler(r Noder) {
 	d := r.GetNode()
+	n := &d.e
+	// Channels and generation are this goroutine's own: a restarted handler gets new ones.
+	n.handlerLock.Lock()
+	ft, gen := n.ft, n.generation
+	n.handlerLock.Unlock()
+	atomic.StoreUint64(&n.goid, goroutineId())
 	// Save elog if thread panics.
 	defer func() {
 		if err := recover(); err != nil {
@@ -186,56 +219,35 @@ func (l *Loop) eventHandler(r Noder) {
 			err = fmt.Errorf("%v: %v", d.name, err)
 			fmt.Printf("eventHandler: panic %v\n", err) //debug print
 			elog.Panic(err)
+			// Abandoned by watchdog restart?
+			if !n.endAction(gen) {
+				return
+			}
 			l.Panic(err, debug.Stack())
-			d.eventDone()
+			n.setInEvent(false)
+			d.eventDone(ft)
 		}
 	}()
-	n := &d.e
 	for {
 		n.log(d, event_elog_node_wait)
-		//Using the original f.ft.waitLoop can in theory wait forever if no activity (which is valid),
-		//but the timer mechanism that regulates poller and event should periodically get it out of
-		//wait on average every 7 seconds even if no activity.
-		//Use waitLoop_with_timeout for better debuggability and set t to 30 seconds in case something hung and wouldn't exit
-		//goes will exit (i.e. crash) with error message if timed out
-		//n.ft.waitLoop()
-		if true {
-			actor_name := "nil"
-			t := 30 * time.Second
-			if n.currentEvent.e != nil {
-				if n.currentEvent.e.actor != nil {
-					actor_name = n.currentEvent.e.actor.String()
-				}
-			}
-			n.ft.waitLoop_with_timeout(t, d.name+"(eventHandler)", actor_name, len(n.rxEvents))
+		// Waiting with no events to handle is not a stall: wait as long as it takes.
+		if !ft.waitLoopRunning() {
+			// Node unregistered.
+			ft.signalLoop(true)
+			return
 		}
 		n.log(d, event_elog_node_wake)
 		e := <-n.rxEvents
 		if poller_panics && e.d != d {
 			panic(fmt.Errorf("expected node %s got %s: %p %s", d.name, e.d.name, e, e.actor.String()))
 		}
-		n.currentEvent.e = e
-		if false { //debug print
-			fmt.Printf("eventHandler do Action\n")
-			actor_name := "nil"
-			if n.currentEvent.e != nil {
-				if n.currentEvent.e.actor != nil {
-					actor_name = n.currentEvent.e.actor.String()
-				}
-			}
-			fmt.Printf("eventHandler: node: %v, actor %v, ch length = %d\n", d.name, actor_name, len(n.rxEvents))
-		}
-		e.do()
-		d.eventDone()
-		if false { //debug print
-			actor_name := "nil"
-			if n.currentEvent.e != nil {
-				if n.currentEvent.e.actor != nil {
-					actor_name = n.currentEvent.e.actor.String()
-				}
-			}
-			fmt.Printf("   done: node: %v, actor %v, ch length = %d\n", d.name, actor_name, len(n.rxEvents))
+		e.ft, e.generation = ft, gen
+		n.startAction(e)
+		if e.do() {
+			return
 		}
+		n.setInEvent(false)
+		d.eventDone(ft)
 	}
 }
 
@@ -280,21 +292,19 @@ func (n *Node) CurrentEvent() (e *Event) {
 func (x *Event) Suspend() {
 	d := x.e.d //d is the *Node for event x
 	n := &d.e  //e is the eventNode for d
-	if !n.isActive() {
-		panic("suspending inactive node")
-	}
-	if was := n.s.setSuspend(d, true); was {
-		n.logsi(d, event_elog_suspend, n.sequence, "ignore duplicate suspend")
+	if !x.setSuspend() {
 		return
 	}
 	n.log(d, event_elog_suspend)
-	n.eventStats.current.suspends++
+	atomic.AddUint64(&n.eventStats.current.suspends, 1)
 	t0 := cpu.TimeNow()
-	n.ft.signalLoop(false)
-	n.ft.waitLoop()
+	n.setInEvent(false)
+	x.e.ft.signalLoop(false)
+	x.e.ft.waitLoop()
+	n.setInEvent(true)
 	// Don't charge node for time suspended.
 	dt := cpu.TimeNow() - t0
-	n.eventStats.current.clocks -= uint64(dt)
+	n.eventStats.current.suspended(&n.eventStats.current, dt)
 	n.log(d, event_elog_resumed)
 }
 
@@ -314,6 +324,8 @@ func (x *Event) Name() (actor_name string) {
 // doEvents() sends signalNode() to all active nodes
 // func (l *Loop) Run() is the infinite loop that does doEvents() continuously
 // func (l *Loop) doPollers() has has a call to signalNode()
+// SuspendWTimeout suspends like Suspend but reports a watchdog stall for each t the event stays
+// suspended; watchdog policy then decides whether to keep waiting, resume the event or crash.
 func (x *Event) SuspendWTimeout(t time.Duration) {
 	d := x.e.d //d is the *Node for event x, e here is the nodeEvent
 	n := &d.e  //e here is the eventNode for d
@@ -324,35 +336,22 @@ func (x *Event) SuspendWTimeout(t time.Duration) {
 		}
 		fmt.Printf("SuspendWTimeout() point 1 node %s; actor %s; rxEvent ch length=%d \n", d.name, actor_name, len(n.rxEvents))
 	}
-	if !n.isActive() {
-		panic("event.go SuspendWTimeout() suspending inactive node")
-	}
-	if was := n.s.setSuspend(d, true); was {
-		n.logsi(d, event_elog_suspend, n.sequence, "ignore duplicate suspend")
+	if !x.setSuspend() {
 		return
 	}
 	n.log(d, event_elog_suspend)
-	n.eventStats.current.suspends++
+	atomic.AddUint64(&n.eventStats.current.suspends, 1)
 	t0 := cpu.TimeNow()
-	n.ft.signalLoop(false)
-	{
-		actor_name := "nil"
-		actor_name_x := "nil"
-		if n.currentEvent.e != nil {
-			if n.currentEvent.e.actor != nil {
-				actor_name = n.currentEvent.e.actor.String()
-			}
-		}
-		if x.e.actor != nil {
-			actor_name_x = x.e.actor.String() //should be the same as the currentEvent actor?
-		}
-		//goes will exit (i.e. crash) with error message if timed out
-		n.ft.waitLoop_with_timeout(t, d.name+"(suspend)", actor_name+" or "+actor_name_x, len(n.rxEvents))
-	}
+	n.setInEvent(false)
+	// Timeout is a timed event so that it follows loop's (possibly virtual) clock.
+	x.startSuspendTimeout(t)
+	x.e.ft.signalLoop(false)
+	x.e.ft.waitLoop()
+	n.setInEvent(true)
 
 	// Don't charge node for time suspended.
 	dt := cpu.TimeNow() - t0
-	n.eventStats.current.clocks -= uint64(dt)
+	n.eventStats.current.suspended(&n.eventStats.current, dt)
 	n.log(d, event_elog_resumed)
 }
 
@@ -366,7 +365,7 @@ func (x *Event) Resume() (ok bool) {
 
 	// Don't do it twice.
 	if ok, _, _ = n.s.setResume(d); !ok {
-		n.logsi(d, event_elog_queue_resume, n.sequence, "ignore duplicate resume")
+		n.logsi(d, event_elog_queue_resume, n.getSequence(), "ignore duplicate resume")
 		return
 	}
 	n.log(d, event_elog_queue_resume)
@@ -385,26 +384,27 @@ func (x *nodeEvent) resume() {
 const eventHandlerChanDepth = 1 << 15 //was 1 << 10 not enough; causes hang during bgp test with 8000 routes coming/going near during link flap; obversed ch depth of 5000+
 
 //func (n *Node) hasEventHandler() bool { return n.e.rxEvents != nil }
-func (n *Node) hasEventHandler() bool { return n.e.hasHandler }
+func (n *Node) hasEventHandler() bool { return n.e.hasHandler.Load() }
 func (d *Node) maybeStartEventHandler() {
 	n := &d.e
 	//This is faster check if an evenHandler had already been started
-	if n.hasHandler {
+	if n.hasHandler.Load() {
 		return
-	} else {
-		n.hasHandler = true
 	}
 	//Further ensures only 1 eventHandler can ever start per Node
-	//even if 2 events triggers maybeStartEventHandler() simultaneously and neither had a chance
-	//to assert n.hasHandler before the other reads it.
+	//even if 2 events triggers maybeStartEventHandler() simultaneously.
+	//Handlers may be started concurrently by node LoopInit goroutines so handler lists are locked.
 	d.startEventHandlerOnce.Do(func() {
 		l := d.l
+		l.eventHandlerLock.Lock()
 		l.eventHandlers = append(l.eventHandlers, d.noder)
 		l.eventHandlerNodes = append(l.eventHandlerNodes, d)
+		l.eventHandlerLock.Unlock()
 		n.rxEvents = make(chan *nodeEvent, eventHandlerChanDepth)
 		n.activeIndex = ^uint(0)
-		n.ft.init()
+		n.ft = newFromToNode()
 		elog.F("loop starting event handler %v", d.elogNodeName)
+		n.hasHandler.Store(true)
 		go l.eventHandler(d.noder)
 	})
 }
@@ -436,6 +436,12 @@ func (e *nodeEvent) EventAction() {
 	}
 	n := &d.e
 
+	// Drop events for unregistered nodes.
+	if !d.isRegistered() {
+		e.l.putLoopEvent(e)
+		return
+	}
+
 	// Set signal time for timed events.
 	if e.time != 0 {
 		e.time = d.l.now
@@ -499,8 +505,27 @@ func (l *Loop) doEventWait() (quit *quitEvent, timeout bool) {
 	return
 }
 
+// With virtual time instead of waiting for timer time jumps to next timed event
+// unless other events are pending.
+func (l *Loop) doEventVirtual(nextTime cpu.Time, nextTimeValid bool) (quit *quitEvent, timeout bool) {
+	select {
+	case e := <-l.events:
+		quit = l.doNodeEvent(e)
+	default:
+		if !nextTimeValid {
+			// Nothing scheduled: wait for event from another goroutine.
+			quit = l.doNodeEvent(<-l.events)
+			return
+		}
+		l.advanceVirtualTime(nextTime)
+		l.now = nextTime
+		timeout = true
+	}
+	return
+}
+
 func (l *Loop) duration(t cpu.Time) time.Duration {
-	l.now = cpu.TimeNow()
+	l.now = l.TimeNow()
 	return time.Duration(float64(int64(t-l.now)) * l.timeDurationPerCycle)
 }
 
@@ -523,7 +548,11 @@ func (l *Loop) doEvents() (quitLoop bool) {
 		if _, didWait = l.activePollerState.setEventWait(); didWait {
 			// Find next event's time (!ok means there is no available event).
 			nextTime, nextTimeValid = l.timedEventPool.NextTime()
-
+		}
+		if didWait && l.VirtualTime {
+			quit, waitTimeout = l.doEventVirtual(nextTime, nextTimeValid)
+			l.activePollerState.clearEventWait()
+		} else if didWait {
 			// Compute duration until next event.
 			var dt time.Duration
 			if nextTimeValid {
@@ -587,22 +616,10 @@ func (l *Loop) doEvents() (quitLoop bool) {
 	// Wait for all event active nodes to finish.
 	for _, d := range m.activeNodes {
 		n := &d.e
-		q := n.sequence
+		q := n.getSequence()
 		n.log(d, event_elog_wait)
-		//Use a timed wait instead of indefinite wait.  Assuming no events takes more than t seconds to do
-		//goes will exit (i.e. crash) with error message if timed out
-		//nodeEventDone := n.ft.waitNode()
-		var nodeEventDone bool
-		if true {
-			actor_name := "nil"
-			t := 30 * time.Second
-			if n.currentEvent.e != nil {
-				if n.currentEvent.e.actor != nil {
-					actor_name = n.currentEvent.e.actor.String()
-				}
-			}
-			nodeEventDone = n.ft.waitNode_with_timeout(t, d.name+"(doEvents)", actor_name, len(n.rxEvents))
-		}
+		// Watchdog handles nodes which take too long.
+		nodeEventDone := l.waitEventNode(d)
 		// Inactivate nodes which have no more queued events or are suspended.
 		if !nodeEventDone || n.activeCount == 0 {
 			m.inactiveNodes = append(m.inactiveNodes, d)
@@ -624,7 +641,7 @@ func (l *Loop) doEvents() (quitLoop bool) {
 func (m *eventMain) addActive(d *Node) {
 	n := &d.e
 	if n.isActive() {
-		n.logsi(d, event_elog_add_active, n.sequence, "ignore duplicate")
+		n.logsi(d, event_elog_add_active, n.getSequence(), "ignore duplicate")
 		return
 	}
 	n.activeIndex = uint(len(m.activeNodes))
@@ -679,11 +696,14 @@ func (k event_node_state_elog_kind) String() string {
 }
 
 type event_node_state_elog struct {
-	kind     event_node_state_elog_kind
-	name     elog.StringRef
-	old, new eventNodeState
+	kind event_node_state_elog_kind `elog:"kind"`
+	name elog.StringRef             `elog:"node"`
+	old  eventNodeState             `elog:"old"`
+	new  eventNodeState             `elog:"new"`
 }
 
+func init() { elog.RegisterType(&event_node_state_elog{}) }
+
 func (e *event_node_state_elog) Elog(l *elog.Log) {
 	l.Logf("event node state %v %v %v -> %v", e.kind, e.name, e.old, e.new)
 }
@@ -717,12 +737,12 @@ func (s *eventNodeState) setSuspend(d *Node, is bool) (was bool) {
 		new := makeEventNodeState(is, false)
 		if s.compare_and_swap(old, new) {
 			if elog.Enabled() {
-				elog.Add(&event_node_state_elog{
+				elog.AddTrack(&event_node_state_elog{
 					kind: event_node_state_elog_suspend,
 					name: d.elogNodeName,
 					old:  old,
 					new:  new,
-				})
+				}, d.elogTrack)
 			}
 			return
 		}
@@ -736,12 +756,12 @@ func (s *eventNodeState) setResume(d *Node) (ok, wasSuspended, wasResumed bool)
 		new := makeEventNodeState(false, true)
 		ok = s.compare_and_swap(old, new)
 		if ok {
-			elog.Add(&event_node_state_elog{
+			elog.AddTrack(&event_node_state_elog{
 				kind: event_node_state_elog_set_resume,
 				name: d.elogNodeName,
 				old:  old,
 				new:  new,
-			})
+			}, d.elogTrack)
 		}
 	}
 	return
@@ -754,12 +774,12 @@ func (s *eventNodeState) clearResume(d *Node) bool {
 		}
 		new := makeEventNodeState(wasSuspended, false)
 		if s.compare_and_swap(old, new) {
-			elog.Add(&event_node_state_elog{
+			elog.AddTrack(&event_node_state_elog{
 				kind: event_node_state_elog_clear_resume,
 				name: d.elogNodeName,
 				old:  old,
 				new:  new,
-			})
+			}, d.elogTrack)
 			return wasResumed
 		}
 	}
@@ -778,6 +798,13 @@ func (m *eventMain) eventInit(l *Loop) {
 	m.timerDuration = maxDuration
 	m.timer = time.NewTimer(maxDuration)
 	m.nodeEventPool.New = func() interface{} { return &nodeEvent{} }
+	if dt := l.TimingWheelTick; dt > 0 {
+		log2Tick := uint(0)
+		for float64(uint64(1)<<log2Tick) < dt*l.cyclesPerSec && log2Tick < 63 {
+			log2Tick++
+		}
+		m.timedEventPool.UseTimingWheel(log2Tick)
+	}
 	m.event_timer_elog(event_timer_elog_reset, maxDuration)
 	for _, n := range l.eventPollers {
 		l.startEventPoller(n)
@@ -827,7 +854,7 @@ func (l *Loop) showRuntimeEvents(w cli.Writer) (err error) {
 	es := []event{}
 	var inputSummary stats
 	for _, n := range l.nodes {
-		if !n.hasEventHandler() {
+		if n == nil || !n.hasEventHandler() {
 			continue
 		}
 		var s stats
@@ -908,19 +935,22 @@ func (n *eventNode) logsi(d *Node, kind event_elog_kind, i uint32, s string) {
 			i:    i,
 		}
 		copy(e.s[:], []byte(s))
-		elog.Add(&e)
+		elog.AddTrack(&e, d.elogTrack)
 	}
 }
 func (n *eventNode) logi(d *Node, kind event_elog_kind, i uint32) { n.logsi(d, kind, i, "") }
-func (n *eventNode) log(d *Node, kind event_elog_kind)            { n.logi(d, kind, n.sequence) }
+func (n *eventNode) log(d *Node, kind event_elog_kind)            { n.logi(d, kind, n.getSequence()) }
+func (n *eventNode) getSequence() uint32                          { return atomic.LoadUint32(&n.sequence) }
 
 type event_elog struct {
-	kind event_elog_kind
-	name elog.StringRef
-	i    uint32
-	s    [elog.EventDataBytes - 3*4]byte
+	kind event_elog_kind                 `elog:"kind"`
+	name elog.StringRef                  `elog:"node"`
+	i    uint32                          `elog:"index"`
+	s    [elog.EventDataBytes - 3*4]byte `elog:"detail"`
 }
 
+func init() { elog.RegisterType(&event_elog{}) }
+
 func (e *event_elog) Elog(l *elog.Log) {
 	s := elog.String(e.s[:])
 	if s != "" {
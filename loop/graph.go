@@ -0,0 +1,227 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loop
+
+import (
+	"github.com/platinasystems/elib/cli"
+
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Node graph: nodes with their kinds and next arcs as built from Node.Next and AddNamedNext.
+
+type NodeKind uint8
+
+const (
+	// Data poller: calls LoopInput to produce vectors.
+	NodeInputPoller NodeKind = 1 << iota
+	// Receives vectors from previous nodes.
+	NodeIn
+	// Sends vectors to next nodes.
+	NodeOut
+	// Has event handler for signaled events.
+	NodeEventHandler
+)
+
+var nodeKindNames = [...]string{"input-poller", "in", "out", "event-handler"}
+
+func (k NodeKind) String() string {
+	var s []string
+	for i := range nodeKindNames {
+		if k&(1<<i) != 0 {
+			s = append(s, nodeKindNames[i])
+		}
+	}
+	return strings.Join(s, ",")
+}
+
+func (k NodeKind) MarshalText() ([]byte, error) { return []byte(k.String()), nil }
+
+type GraphArc struct {
+	// Name of next node.
+	Name string `json:"name"`
+	// Next index used by node to send vectors to this next node.
+	Index uint `json:"index"`
+	// Next node is not registered or is not an input node.
+	Dangling bool `json:"dangling,omitempty"`
+}
+
+type GraphNode struct {
+	Name  string     `json:"name"`
+	Index uint       `json:"index"`
+	Kind  NodeKind   `json:"kind"`
+	Next  []GraphArc `json:"next,omitempty"`
+}
+
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+}
+
+func nodeKind(r Noder) (k NodeKind) {
+	if _, ok := isDataPoller(r); ok {
+		k |= NodeInputPoller
+	}
+	if _, ok := r.(inNoder); ok {
+		k |= NodeIn
+	}
+	if _, ok := r.(outNoder); ok {
+		k |= NodeOut
+	}
+	if r.GetNode().hasEventHandler() {
+		k |= NodeEventHandler
+	}
+	return
+}
+
+// Graph returns loop's nodes in index order with their kinds and next arcs.
+func (l *Loop) Graph() (g *Graph) {
+	g = &Graph{}
+	for i, r := range l.noders {
+		if r == nil {
+			continue
+		}
+		n := l.nodes[i]
+		gn := GraphNode{Name: n.name, Index: n.index, Kind: nodeKind(r)}
+		for x := range n.nextNodes {
+			name := n.nextNodes[x].name
+			if name == "" {
+				continue
+			}
+			next, ok := l.noderByName[name]
+			if ok {
+				_, ok = next.(inNoder)
+			}
+			gn.Next = append(gn.Next, GraphArc{Name: name, Index: uint(x), Dangling: !ok})
+		}
+		g.Nodes = append(g.Nodes, gn)
+	}
+	return
+}
+
+// Matching returns graph with only nodes whose names match given regexp.
+// Arcs from matching nodes to other nodes are kept.
+func (g *Graph) Matching(re *regexp.Regexp) (m *Graph) {
+	m = &Graph{}
+	for i := range g.Nodes {
+		if re.MatchString(g.Nodes[i].Name) {
+			m.Nodes = append(m.Nodes, g.Nodes[i])
+		}
+	}
+	return
+}
+
+// Dangling returns arcs to unknown or non-input next nodes as NODE -> NEXT.
+func (g *Graph) Dangling() (arcs []string) {
+	for i := range g.Nodes {
+		n := &g.Nodes[i]
+		for _, a := range n.Next {
+			if a.Dangling {
+				arcs = append(arcs, n.Name+" -> "+a.Name)
+			}
+		}
+	}
+	return
+}
+
+func (g *Graph) Write(w io.Writer) {
+	for i := range g.Nodes {
+		n := &g.Nodes[i]
+		fmt.Fprintf(w, "%s (%v)\n", n.Name, n.Kind)
+		for _, a := range n.Next {
+			s := ""
+			if a.Dangling {
+				s = " (dangling)"
+			}
+			fmt.Fprintf(w, "  %d: %s%s\n", a.Index, a.Name, s)
+		}
+	}
+}
+
+func (g *Graph) WriteJSON(w io.Writer) error {
+	b, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// WriteDot writes graph in Graphviz DOT format.  Dangling arcs are drawn dashed and red.
+func (g *Graph) WriteDot(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "digraph loop {")
+	fmt.Fprintln(bw, "\trankdir=LR;")
+	fmt.Fprintln(bw, "\tnode [shape=box];")
+	for i := range g.Nodes {
+		n := &g.Nodes[i]
+		attrs := fmt.Sprintf("label=%s", dotQuote(n.Name+"\n"+n.Kind.String()))
+		switch {
+		case n.Kind&NodeInputPoller != 0:
+			attrs += ", shape=invhouse"
+		case n.Kind&(NodeIn|NodeOut) == 0:
+			attrs += ", shape=ellipse"
+		}
+		fmt.Fprintf(bw, "\t%s [%s];\n", dotQuote(n.Name), attrs)
+	}
+	for i := range g.Nodes {
+		n := &g.Nodes[i]
+		for _, a := range n.Next {
+			attrs := fmt.Sprintf("label=\"%d\"", a.Index)
+			if a.Dangling {
+				attrs += ", style=dashed, color=red"
+			}
+			fmt.Fprintf(bw, "\t%s -> %s [%s];\n", dotQuote(n.Name), dotQuote(a.Name), attrs)
+		}
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+func (l *Loop) showGraph(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var (
+		matching      string
+		asDot, asJSON bool
+	)
+	for !in.End() {
+		switch {
+		case in.Parse("dot"):
+			asDot = true
+		case in.Parse("json"):
+			asJSON = true
+		case in.Parse("%v", &matching):
+		default:
+			in.ParseError()
+		}
+	}
+	g := l.Graph()
+	if matching != "" {
+		var re *regexp.Regexp
+		if re, err = regexp.Compile(matching); err != nil {
+			return
+		}
+		g = g.Matching(re)
+	}
+	switch {
+	case asDot:
+		err = g.WriteDot(w)
+	case asJSON:
+		err = g.WriteJSON(w)
+	default:
+		g.Write(w)
+		if d := g.Dangling(); len(d) > 0 {
+			fmt.Fprintf(w, "%d dangling next arcs\n", len(d))
+		}
+	}
+	return
+}
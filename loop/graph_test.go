@@ -0,0 +1,99 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loop
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+type graphTestIn struct{ In }
+type graphTestOut struct {
+	Out
+	next graphTestIn
+}
+
+// Input poller.
+type graphTestPoller struct{ Node }
+
+func (n *graphTestPoller) MakeLoopOut() LooperOut         { return &graphTestOut{} }
+func (n *graphTestPoller) LoopInput(l *Loop, o LooperOut) {}
+
+// Node receiving and sending vectors.
+type graphTestInOut struct{ Node }
+
+func (n *graphTestInOut) MakeLoopIn() LooperIn                             { return &graphTestIn{} }
+func (n *graphTestInOut) MakeLoopOut() LooperOut                           { return &graphTestOut{} }
+func (n *graphTestInOut) LoopInputOutput(l *Loop, i LooperIn, o LooperOut) {}
+
+// Output node.
+type graphTestOutput struct{ Node }
+
+func (n *graphTestOutput) MakeLoopIn() LooperIn           { return &graphTestIn{} }
+func (n *graphTestOutput) LoopOutput(l *Loop, i LooperIn) {}
+
+func TestGraph(t *testing.T) {
+	l := &Loop{}
+	rx := &graphTestPoller{}
+	rx.Next = []string{"process"}
+	process := &graphTestInOut{}
+	process.Next = []string{"tx", "missing", "rx"}
+	tx := &graphTestOutput{}
+	l.RegisterNode(rx, "rx")
+	l.RegisterNode(process, "process")
+	l.RegisterNode(tx, "tx")
+
+	g := l.Graph()
+	want := []GraphNode{
+		{Name: "rx", Index: 0, Kind: NodeInputPoller | NodeOut, Next: []GraphArc{{Name: "process"}}},
+		{Name: "process", Index: 1, Kind: NodeIn | NodeOut, Next: []GraphArc{
+			{Name: "tx"},
+			{Name: "missing", Index: 1, Dangling: true},
+			// Poller is not an input node.
+			{Name: "rx", Index: 2, Dangling: true},
+		}},
+		{Name: "tx", Index: 2, Kind: NodeIn},
+	}
+	if !reflect.DeepEqual(g.Nodes, want) {
+		t.Fatalf("graph %+v", g.Nodes)
+	}
+	if d := g.Dangling(); len(d) != 2 || d[0] != "process -> missing" {
+		t.Fatalf("dangling %v", d)
+	}
+
+	var b bytes.Buffer
+	if err := g.Matching(regexp.MustCompile("^p")).WriteDot(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{`"process" -> "tx" [label="0"];`, `"process" -> "missing" [label="1", style=dashed, color=red];`} {
+		if !strings.Contains(b.String(), s) {
+			t.Fatalf("dot missing %s:\n%s", s, b.String())
+		}
+	}
+	if strings.Contains(b.String(), `"rx" ->`) {
+		t.Fatalf("dot has unmatched node:\n%s", b.String())
+	}
+
+	b.Reset()
+	if err := g.WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+	var x struct {
+		Nodes []struct {
+			Name string
+			Kind string
+		}
+	}
+	if err := json.Unmarshal(b.Bytes(), &x); err != nil {
+		t.Fatal(err)
+	}
+	if len(x.Nodes) != 3 || x.Nodes[0].Kind != "input-poller,out" {
+		t.Fatalf("json %+v", x)
+	}
+}
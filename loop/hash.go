@@ -0,0 +1,99 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loop
+
+import (
+	"github.com/platinasystems/elib"
+	"github.com/platinasystems/elib/cli"
+
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// Named hash tables shown by `show hash'.
+type hashMain struct {
+	hashMu     sync.Mutex
+	hashByName map[string]*elib.Hash
+}
+
+// RegisterHash makes hash table visible to `show hash' and `clear hash' under given name.
+func (l *Loop) RegisterHash(name string, h *elib.Hash) {
+	m := &l.hashMain
+	m.hashMu.Lock()
+	defer m.hashMu.Unlock()
+	if m.hashByName == nil {
+		m.hashByName = make(map[string]*elib.Hash)
+	}
+	m.hashByName[name] = h
+}
+
+func (l *Loop) UnregisterHash(name string) {
+	m := &l.hashMain
+	m.hashMu.Lock()
+	defer m.hashMu.Unlock()
+	delete(m.hashByName, name)
+}
+
+// Call f for each registered hash whose name matches regexp in sorted order.
+func (l *Loop) foreachHash(re *regexp.Regexp, f func(name string, h *elib.Hash)) {
+	m := &l.hashMain
+	m.hashMu.Lock()
+	defer m.hashMu.Unlock()
+	names := make([]string, 0, len(m.hashByName))
+	for name := range m.hashByName {
+		if re == nil || re.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f(name, m.hashByName[name])
+	}
+}
+
+func parseHashArgs(in *cli.Input) (re *regexp.Regexp, detail bool, err error) {
+	var matching string
+	for !in.End() {
+		switch {
+		case in.Parse("d%*etail"):
+			detail = true
+		case in.Parse("%v", &matching):
+		default:
+			in.ParseError()
+		}
+	}
+	if matching != "" {
+		re, err = regexp.Compile(matching)
+	}
+	return
+}
+
+func (l *Loop) showHash(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	re, detail, err := parseHashArgs(in)
+	if err != nil {
+		return
+	}
+	l.foreachHash(re, func(name string, h *elib.Hash) {
+		s := h.Stats()
+		if !detail {
+			fmt.Fprintf(w, "%s: %s\n", name, &s)
+			return
+		}
+		fmt.Fprintf(w, "%s:\n", name)
+		s.Write(w)
+	})
+	return
+}
+
+func (l *Loop) clearHash(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	re, _, err := parseHashArgs(in)
+	if err != nil {
+		return
+	}
+	l.foreachHash(re, func(name string, h *elib.Hash) { h.ClearStats() })
+	return
+}
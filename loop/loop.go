@@ -12,6 +12,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -32,6 +34,7 @@ type Node struct {
 	nextIndexByNodeName     map[string]uint
 	inputStats, outputStats nodeStats
 	elogNodeName            elog.StringRef
+	elogTrack               uint
 	e                       eventNode
 	s                       nodeState
 }
@@ -49,6 +52,7 @@ func (n *Node) GetNoder() Noder          { return n.noder }
 func (n *Node) Index() uint              { return n.index }
 func (n *Node) Name() string             { return n.name }
 func (n *Node) ElogName() elog.StringRef { return n.elogNodeName }
+func (n *Node) ElogTrack() uint          { return n.elogTrack }
 func (n *Node) GetLoop() *Loop           { return n.l }
 func (n *Node) ThreadId() uint           { return n.activePollerIndex }
 func nodeName(n Noder) string            { return n.GetNode().name }
@@ -70,6 +74,8 @@ type Loop struct {
 	noders      []Noder
 	nodes       []*Node
 	noderByName map[string]Noder
+	// Indices of unregistered nodes; nil entries in noders and nodes.
+	freeNodeIndices []uint
 
 	loopIniters []Initer
 	loopExiters []Exiter
@@ -78,6 +84,9 @@ type Loop struct {
 	activePollerState activePollerState
 	activePollerPool  activePollerPool
 	pollerStats       pollerStats
+	// Held by loop while data pollers run so that node graph changes can wait for
+	// pollers to be quiescent.
+	pollerLock sync.Mutex
 
 	wg sync.WaitGroup
 
@@ -89,15 +98,20 @@ type Loop struct {
 	secsPerCycle           float64
 	timeDurationPerCycle   float64
 	timeLastRuntimeClear   time.Time
+	// Current time for Config.VirtualTime.
+	virtualTime uint64
 
 	Cli Cli
 	Config
 	eventMain
+	hashMain
 	loggerMain
+	metricsMain
 	nodeStateMain
 	panicMain
 }
 
+// GetNode and GetNoder return nil for indices of unregistered nodes.
 func (l *Loop) GetNode(i uint) *Node       { return l.nodes[i] }
 func (l *Loop) GetNoder(i uint) Noder      { return l.noders[i] }
 func (l *Loop) Seconds(t cpu.Time) float64 { return float64(t) * l.secsPerCycle }
@@ -123,6 +137,22 @@ func (l *Loop) timerInit() {
 	l.timeDurationPerCycle = l.secsPerCycle * float64(time.Second)
 	l.startTime = cpu.TimeNow()
 	l.timeLastRuntimeClear = time.Now()
+	atomic.StoreUint64(&l.virtualTime, uint64(l.startTime))
+}
+
+// TimeNow returns current cpu time or, with virtual time, loop's simulated time.
+func (l *Loop) TimeNow() cpu.Time {
+	if l.VirtualTime {
+		return cpu.Time(atomic.LoadUint64(&l.virtualTime))
+	}
+	return cpu.TimeNow()
+}
+
+// Advance virtual time; only called by loop.
+func (l *Loop) advanceVirtualTime(t cpu.Time) {
+	if uint64(t) > atomic.LoadUint64(&l.virtualTime) {
+		atomic.StoreUint64(&l.virtualTime, uint64(t))
+	}
 }
 
 func (l *Loop) TimeDiff(t0, t1 cpu.Time) float64 { return float64(t1-t0) * l.secsPerCycle }
@@ -182,6 +212,15 @@ func (l *Loop) doExit() {
 type Config struct {
 	LogWriter         io.Writer
 	QuitAfterDuration float64
+	// When non-zero timed events are kept in a hierarchical timing wheel with ticks of
+	// (at least) given number of seconds instead of a heap.
+	TimingWheelTick float64
+	// When set loop runs on a simulated clock: time stands still while nodes run and, when
+	// loop is idle, jumps to time of next timed event.  Timed events then happen in
+	// deterministic order without real delays.  Data pollers still run in real time.
+	VirtualTime bool
+	// Detection and handling of event handlers stuck in events.
+	Watchdog WatchdogConfig
 }
 
 type loopQuit struct {
@@ -238,6 +277,14 @@ func (l *Loop) Run() {
 	l.doPanic()
 }
 
+// Simulate runs loop with virtual time and returns once given number of simulated seconds
+// have elapsed.  Used to test nodes built on timed events without real delays.
+func (l *Loop) Simulate(secs float64) {
+	l.VirtualTime = true
+	l.QuitAfterDuration = secs
+	l.Run()
+}
+
 type panicMain struct {
 	panicErr   interface{}
 	debugStack []byte
@@ -246,10 +293,14 @@ type panicMain struct {
 func (l *Loop) Panic(err interface{}, stack []byte) {
 	l.panicErr = err
 	l.debugStack = stack
+	// Capture event log window around panic.
+	elog.FireTrigger("panic")
 }
 func (l *Loop) isPanic() bool { return l.panicErr != nil }
 func (l *Loop) doPanic() {
 	if l.isPanic() {
+		// Save "panic" trigger snapshot before process exits.
+		elog.FlushTriggers()
 		fmt.Fprintln(os.Stderr, "panic:", l.panicErr)
 		os.Stderr.Write(l.debugStack)
 	}
@@ -344,11 +395,6 @@ func (s *pollerStats) VectorRate() float64 {
 
 func (l *Loop) addDataNode(r Noder) {
 	n := r.GetNode()
-	n.noder = r
-	n.index = uint(len(l.noders))
-	n.activePollerIndex = ^uint(0)
-	l.noders = append(l.noders, r)
-	l.nodes = append(l.nodes, n)
 	if l.noderByName == nil {
 		l.noderByName = make(map[string]Noder)
 	}
@@ -356,6 +402,25 @@ func (l *Loop) addDataNode(r Noder) {
 		panic(fmt.Errorf("%s: more than one node with this name", n.name))
 	}
 	l.noderByName[n.name] = r
+	n.noder = r
+	n.activePollerIndex = ^uint(0)
+	// Re-use index of unregistered node.
+	if i := len(l.freeNodeIndices); i > 0 {
+		n.index = l.freeNodeIndices[i-1]
+		l.freeNodeIndices = l.freeNodeIndices[:i-1]
+		l.noders[n.index] = r
+		l.nodes[n.index] = n
+	} else {
+		n.index = uint(len(l.noders))
+		l.noders = append(l.noders, r)
+		l.nodes = append(l.nodes, n)
+	}
+	l.validateActiveNodes(n.index)
+}
+
+func (n *Node) isRegistered() bool {
+	l := n.l
+	return l != nil && n.index < uint(len(l.nodes)) && l.nodes[n.index] == n
 }
 
 func isDataPoller(n Noder) (x inLooper, ok bool) { x, ok = n.(inLooper); return }
@@ -364,12 +429,8 @@ func (l *Loop) RegisterNode(n Noder, format string, args ...interface{}) {
 	x := n.GetNode()
 	x.name = fmt.Sprintf(format, args...)
 	x.elogNodeName = elog.SetString(x.name)
+	x.elogTrack = elog.NewTrack("%s", x.name)
 	x.l = l
-	for i := range x.Next {
-		if _, err := l.AddNamedNext(n, x.Next[i]); err != nil {
-			panic(err)
-		}
-	}
 
 	start := l.registrationsNeedStart
 	if d, isOut := n.(outNoder); isOut {
@@ -390,6 +451,13 @@ func (l *Loop) RegisterNode(n Noder, format string, args ...interface{}) {
 		l.addDataNode(n)
 	}
 
+	for i := range x.Next {
+		if _, err := l.AddNamedNext(n, x.Next[i]); err != nil {
+			panic(err)
+		}
+	}
+	l.initActiveNode(x)
+
 	if p, ok := n.(Initer); ok {
 		l.loopIniters = append(l.loopIniters, p)
 		if start {
@@ -400,3 +468,84 @@ func (l *Loop) RegisterNode(n Noder, format string, args ...interface{}) {
 		l.loopExiters = append(l.loopExiters, p)
 	}
 }
+
+// UnregisterNode removes node registered with RegisterNode.  Node may not be the next of any
+// other node (use ReplaceNamedNext to rewire arcs first) and must not be processing or have
+// suspended events or vectors.  Node's data poller is quiesced and its poller and event handler
+// goroutines are stopped; events still queued for node are dropped.  Node's LoopExit is called
+// and node may then be registered again.  Waits for running data pollers to finish so it must
+// not be called from a data poller.
+func (l *Loop) UnregisterNode(r Noder) (err error) {
+	l.pollerLock.Lock()
+	defer l.pollerLock.Unlock()
+	x := r.GetNode()
+	if !x.isRegistered() || x.l != l {
+		err = fmt.Errorf("unregister %s: node not registered", x.name)
+		return
+	}
+	var refs []string
+	for _, n := range l.nodes {
+		if n == nil || n == x {
+			continue
+		}
+		if _, ok := n.nextIndexByNodeName[x.name]; ok {
+			refs = append(refs, n.name)
+		}
+	}
+	if len(refs) > 0 {
+		err = fmt.Errorf("unregister %s: still next of %s", x.name, strings.Join(refs, ", "))
+		return
+	}
+	if e := &x.e; x.hasEventHandler() && (e.isActive() || e.activeCount > 0 || e.s.isSuspended()) {
+		err = fmt.Errorf("unregister %s: event handler busy", x.name)
+		return
+	}
+	if x.IsSuspended() {
+		err = fmt.Errorf("unregister %s: data poller suspended", x.name)
+		return
+	}
+
+	if _, ok := isDataPoller(r); ok {
+		l.dataPollers = slices.DeleteFunc(l.dataPollers, func(p inLooper) bool { return p.GetNode() == x })
+		x.quiescePoller()
+		x.ft.stop()
+	}
+	if x.hasEventHandler() {
+		l.eventHandlerLock.Lock()
+		l.eventHandlers = slices.DeleteFunc(l.eventHandlers, func(p Noder) bool { return p.GetNode() == x })
+		l.eventHandlerNodes = slices.DeleteFunc(l.eventHandlerNodes, func(n *Node) bool { return n == x })
+		l.eventHandlerLock.Unlock()
+		x.e.ft.stop()
+	}
+	l.loopIniters = slices.DeleteFunc(l.loopIniters, func(p Initer) bool { return p.GetNode() == x })
+	if p, ok := r.(Exiter); ok {
+		l.loopExiters = slices.DeleteFunc(l.loopExiters, func(q Exiter) bool { return q == p })
+		p.LoopExit(l)
+	}
+
+	i := x.index
+	for _, p := range l.activePollerPool.entries {
+		if p != nil && i < uint(len(p.activeNodes)) {
+			p.activeNodes[i] = activeNode{index: uint32(i)}
+		}
+	}
+	delete(l.noderByName, x.name)
+	l.noders[i] = nil
+	l.nodes[i] = nil
+	l.freeNodeIndices = append(l.freeNodeIndices, i)
+	elog.F("loop unregister node %v", x.elogNodeName)
+
+	// Reset node state so that node may be registered again.
+	x.index = ^uint(0)
+	x.activePollerIndex = ^uint(0)
+	x.nextNodes = nil
+	x.nextIndexByNodeName = nil
+	x.initOnce = sync.Once{}
+	x.startEventHandlerOnce = sync.Once{}
+	x.ft = fromToNode{}
+	x.e = eventNode{}
+	x.s = nodeState{}
+	x.inputStats.zero()
+	x.outputStats.zero()
+	return
+}
@@ -0,0 +1,123 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loop
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type rewireIn struct{ In }
+type rewireOut struct {
+	Out
+	Outs []rewireIn
+}
+
+// Poller sending one vector to each given next index each time it is activated.
+type rewirePoller struct {
+	Node
+	sendTo []uint
+}
+
+func (n *rewirePoller) MakeLoopOut() LooperOut { return &rewireOut{} }
+func (n *rewirePoller) LoopInit(l *Loop)       { n.Activate(true) }
+func (n *rewirePoller) LoopInput(l *Loop, lo LooperOut) {
+	o := lo.(*rewireOut)
+	for _, x := range n.sendTo {
+		o.Outs[x].SetLen(l, 1)
+	}
+	n.Activate(false)
+}
+
+type rewireOutput struct {
+	Node
+	vectors uint
+	exited  bool
+}
+
+func (n *rewireOutput) MakeLoopIn() LooperIn { return &rewireIn{} }
+func (n *rewireOutput) LoopOutput(l *Loop, i LooperIn) {
+	n.vectors += i.GetIn().InLen()
+}
+func (n *rewireOutput) LoopExit(l *Loop) { n.exited = true }
+
+// Node doing given functions as timed events.
+type rewireCtl struct {
+	Node
+	at map[float64]func()
+}
+
+func (n *rewireCtl) LoopInit(l *Loop) {
+	for dt, f := range n.at {
+		n.SignalEventAfter(&rewireEvent{f: f}, n, dt)
+	}
+}
+
+type rewireEvent struct{ f func() }
+
+func (e *rewireEvent) String() string { return "rewire" }
+func (e *rewireEvent) EventAction()   { e.f() }
+
+func TestUnregisterNode(t *testing.T) {
+	l := &Loop{}
+	rx := &rewirePoller{sendTo: []uint{0}}
+	rx.Next = []string{"feature"}
+	feature, tx := &rewireOutput{}, &rewireOutput{}
+	ctl := &rewireCtl{}
+	l.RegisterNode(rx, "rx")
+	l.RegisterNode(feature, "feature")
+	l.RegisterNode(tx, "tx")
+	l.RegisterNode(ctl, "ctl")
+
+	feature2, feature3 := &rewireOutput{}, &rewireOutput{}
+	var errs []string
+	check := func(err error, want string) {
+		if (err == nil) != (want == "") || err != nil && !strings.Contains(err.Error(), want) {
+			errs = append(errs, fmt.Sprintf("expected %q got %v", want, err))
+		}
+	}
+	ctl.at = map[float64]func(){
+		1: func() {
+			check(l.UnregisterNode(feature), "still next of rx")
+			// Add node while loop is running with active poller allocated.
+			l.RegisterNode(feature2, "feature2")
+			_, err := l.AddNamedNext(rx, "feature2")
+			check(err, "")
+			check(l.ReplaceNamedNext(rx, 0, "feature2"), "already next with index 1")
+			check(l.ReplaceNamedNext(rx, 0, "tx"), "")
+			check(l.UnregisterNode(feature), "")
+			check(l.UnregisterNode(feature), "not registered")
+			check(l.UnregisterNode(ctl), "event handler busy")
+			rx.sendTo = []uint{0, 1}
+			rx.Activate(true)
+		},
+		2: func() { l.RegisterNode(feature3, "feature3") },
+	}
+	l.Simulate(3)
+
+	if len(errs) > 0 {
+		t.Fatal(strings.Join(errs, "\n"))
+	}
+	if feature.vectors != 1 || tx.vectors != 1 || feature2.vectors != 1 {
+		t.Fatalf("vectors feature %d tx %d feature2 %d", feature.vectors, tx.vectors, feature2.vectors)
+	}
+	if !feature.exited {
+		t.Fatal("LoopExit not called on unregister")
+	}
+	if i := feature3.Index(); i != 1 {
+		t.Fatalf("index of unregistered node not re-used: %d", i)
+	}
+	var names []string
+	for _, n := range l.Graph().Nodes {
+		names = append(names, n.Name)
+	}
+	if got := strings.Join(names, " "); got != "rx feature3 tx ctl feature2" {
+		t.Fatalf("graph nodes %s", got)
+	}
+	if d := l.Graph().Dangling(); len(d) != 0 {
+		t.Fatalf("dangling %v", d)
+	}
+}
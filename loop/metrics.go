@@ -0,0 +1,329 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loop
+
+import (
+	"github.com/platinasystems/elib/cli"
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/elib/elog"
+
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Loop runtime statistics exported in OpenMetrics text format for monitoring systems to scrape.
+
+type MetricType string
+
+const (
+	MetricCounter MetricType = "counter"
+	MetricGauge   MetricType = "gauge"
+)
+
+type MetricLabel struct {
+	Name, Value string
+}
+
+type MetricSample struct {
+	Labels []MetricLabel
+	Value  float64
+}
+
+// MetricFamily is a set of samples of one metric with different labels.
+// Samples of counters are written with _total suffix added to name.
+type MetricFamily struct {
+	Name string
+	Type MetricType
+	// Optional unit (e.g. seconds); name must end with _UNIT.
+	Unit    string
+	Help    string
+	Samples []MetricSample
+}
+
+func (f *MetricFamily) Add(v float64, labels ...MetricLabel) {
+	f.Samples = append(f.Samples, MetricSample{Labels: labels, Value: v})
+}
+
+// MetricsCollector returns metrics to add to loop's metrics.
+// CollectMetrics is called in main loop context while data pollers and event handlers are not running.
+type MetricsCollector interface {
+	CollectMetrics(l *Loop) []MetricFamily
+}
+
+type metricsMain struct {
+	metricsMu         sync.Mutex
+	metricsCollectors map[string]MetricsCollector
+}
+
+// RegisterMetrics adds metrics from given collector to loop's metrics under given name.
+func (l *Loop) RegisterMetrics(name string, c MetricsCollector) {
+	m := &l.metricsMain
+	m.metricsMu.Lock()
+	defer m.metricsMu.Unlock()
+	if m.metricsCollectors == nil {
+		m.metricsCollectors = make(map[string]MetricsCollector)
+	}
+	m.metricsCollectors[name] = c
+}
+
+func (l *Loop) UnregisterMetrics(name string) {
+	m := &l.metricsMain
+	m.metricsMu.Lock()
+	defer m.metricsMu.Unlock()
+	delete(m.metricsCollectors, name)
+}
+
+func (l *Loop) collectorMetrics() (fs []MetricFamily) {
+	m := &l.metricsMain
+	m.metricsMu.Lock()
+	defer m.metricsMu.Unlock()
+	names := make([]string, 0, len(m.metricsCollectors))
+	for name := range m.metricsCollectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fs = append(fs, m.metricsCollectors[name].CollectMetrics(l)...)
+	}
+	return
+}
+
+func nodeLabel(n *Node) MetricLabel { return MetricLabel{Name: "node", Value: n.name} }
+
+// Metrics returns loop and registered collector metrics.  Must be called in event context.
+func (l *Loop) Metrics() (fs []MetricFamily) {
+	l.flushAllActivePollerStats()
+
+	var (
+		calls         = MetricFamily{Name: "loop_node_calls", Type: MetricCounter, Help: "Number of node calls."}
+		vectors       = MetricFamily{Name: "loop_node_vectors", Type: MetricCounter, Help: "Number of vectors processed by node."}
+		suspends      = MetricFamily{Name: "loop_node_suspends", Type: MetricCounter, Help: "Number of node suspends."}
+		clocks        = MetricFamily{Name: "loop_node_clocks", Type: MetricCounter, Help: "Cpu clocks spent in node."}
+		clocksPerVec  = MetricFamily{Name: "loop_node_clocks_per_vector", Type: MetricGauge, Help: "Cpu clocks per vector since runtime statistics were cleared."}
+		suspendSecs   = MetricFamily{Name: "loop_node_suspend_seconds", Type: MetricCounter, Unit: "seconds", Help: "Time node spent suspended."}
+		pollerState   = MetricFamily{Name: "loop_node_active", Type: MetricGauge, Help: "Data poller activity count."}
+		events        = MetricFamily{Name: "loop_event_node_events", Type: MetricCounter, Help: "Number of events handled by node."}
+		eventSuspends = MetricFamily{Name: "loop_event_node_suspends", Type: MetricCounter, Help: "Number of event suspends."}
+		eventClocks   = MetricFamily{Name: "loop_event_node_clocks", Type: MetricCounter, Help: "Cpu clocks spent handling events."}
+		eventSuspSecs = MetricFamily{Name: "loop_event_node_suspend_seconds", Type: MetricCounter, Unit: "seconds", Help: "Time events spent suspended."}
+		eventQueue    = MetricFamily{Name: "loop_event_node_queue_length", Type: MetricGauge, Help: "Events queued for node's event handler."}
+		eventStalls   = MetricFamily{Name: "loop_event_node_stalls", Type: MetricCounter, Help: "Number of watchdog stalls reported for node."}
+	)
+
+	nodes := make([]*Node, 0, len(l.nodes))
+	for _, n := range l.nodes {
+		if n != nil {
+			nodes = append(nodes, n)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].name < nodes[j].name })
+
+	for _, n := range nodes {
+		r := n.noder
+		_, isIn := r.(inLooper)
+		_, isOut := r.(outLooper)
+		_, isInOut := r.(inOutLooper)
+		dirs := [2]bool{isIn || isInOut, isOut || isInOut}
+		ns := [2]*nodeStats{&n.inputStats, &n.outputStats}
+		for j, dir := range [2]string{"input", "output"} {
+			if !dirs[j] {
+				continue
+			}
+			labels := []MetricLabel{nodeLabel(n), {Name: "dir", Value: dir}}
+			var s, c stats
+			s.add_raw(ns[j])
+			c.add(ns[j])
+			calls.Add(float64(s.calls), labels...)
+			vectors.Add(float64(s.vectors), labels...)
+			suspends.Add(float64(s.suspends), labels...)
+			clocks.Add(float64(s.clocks), labels...)
+			clocksPerVec.Add(c.clocksPerVector(), labels...)
+			suspendSecs.Add(l.Seconds(cpu.Time(s.suspendClocks)), labels...)
+		}
+		if isIn {
+			pollerState.Add(float64(n.ActiveCount()), nodeLabel(n))
+		}
+		if n.hasEventHandler() {
+			var s stats
+			s.add_raw(&n.e.eventStats)
+			events.Add(float64(s.vectors), nodeLabel(n))
+			eventSuspends.Add(float64(s.suspends), nodeLabel(n))
+			eventClocks.Add(float64(s.clocks), nodeLabel(n))
+			eventSuspSecs.Add(l.Seconds(cpu.Time(s.suspendClocks)), nodeLabel(n))
+			eventQueue.Add(float64(len(n.e.rxEvents)), nodeLabel(n))
+			eventStalls.Add(float64(atomic.LoadUint64(&n.e.stalls)), nodeLabel(n))
+		}
+	}
+
+	fs = append(fs, calls, vectors, suspends, clocks, clocksPerVec, suspendSecs, pollerState,
+		events, eventSuspends, eventClocks, eventSuspSecs, eventQueue, eventStalls)
+
+	g := func(name, help string, v float64) {
+		f := MetricFamily{Name: name, Type: MetricGauge, Help: help}
+		f.Add(v)
+		fs = append(fs, f)
+	}
+	g("loop_poller_vector_rate", "Vectors per poll averaged over recent polls.", l.pollerStats.VectorRate())
+	g("loop_active_pollers", "Number of allocated active pollers.", float64(l.activePollerPool.Elts()))
+	g("loop_event_queue_length", "Events queued for main loop.", float64(len(l.events)))
+	l.timedEventPoolLock.Lock()
+	g("loop_timed_events", "Number of pending timed events.", float64(l.timedEventPool.Elts()))
+	l.timedEventPoolLock.Unlock()
+
+	fs = append(fs, l.collectorMetrics()...)
+	return
+}
+
+type metricsEvent struct {
+	l    *Loop
+	done chan []MetricFamily
+}
+
+func (e *metricsEvent) String() string { return "collect metrics" }
+func (e *metricsEvent) EventAction()   { e.done <- e.l.Metrics() }
+
+var ErrMetricsTimeout = errors.New("timeout waiting for loop to collect metrics")
+
+// Maximum time to wait for main loop to collect metrics.
+const metricsTimeout = 10 * time.Second
+
+// CollectMetrics has main loop collect metrics and returns them.  May be called from any goroutine.
+func (l *Loop) CollectMetrics() (fs []MetricFamily, err error) {
+	if l.events == nil {
+		err = fmt.Errorf("loop not running")
+		return
+	}
+	x := &metricsEvent{l: l, done: make(chan []MetricFamily, 1)}
+	l.signalEvent(l.getLoopEvent(x, nil, elog.PointerToFirstArg(&l)))
+	select {
+	case fs = <-x.done:
+	case <-time.After(metricsTimeout):
+		err = ErrMetricsTimeout
+	}
+	return
+}
+
+func metricsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func metricsValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// WriteOpenMetrics writes metric families in OpenMetrics text format terminated by # EOF.
+func WriteOpenMetrics(w io.Writer, fs []MetricFamily) error {
+	bw := bufio.NewWriter(w)
+	for i := range fs {
+		f := &fs[i]
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.Name, f.Type)
+		if f.Unit != "" {
+			fmt.Fprintf(bw, "# UNIT %s %s\n", f.Name, f.Unit)
+		}
+		if f.Help != "" {
+			fmt.Fprintf(bw, "# HELP %s %s\n", f.Name, metricsEscape(f.Help))
+		}
+		name := f.Name
+		if f.Type == MetricCounter {
+			name += "_total"
+		}
+		for _, s := range f.Samples {
+			bw.WriteString(name)
+			if len(s.Labels) > 0 {
+				bw.WriteByte('{')
+				for j, l := range s.Labels {
+					if j > 0 {
+						bw.WriteByte(',')
+					}
+					fmt.Fprintf(bw, "%s=\"%s\"", l.Name, metricsEscape(l.Value))
+				}
+				bw.WriteByte('}')
+			}
+			fmt.Fprintf(bw, " %s\n", metricsValue(s.Value))
+		}
+	}
+	bw.WriteString("# EOF\n")
+	return bw.Flush()
+}
+
+const OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// MetricsHandler returns HTTP handler serving loop's metrics in OpenMetrics text format.
+func (l *Loop) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fs, err := l.CollectMetrics()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", OpenMetricsContentType)
+		WriteOpenMetrics(w, fs)
+	})
+}
+
+// ServeMetrics serves loop's metrics over HTTP (path /metrics) on given address until listener is closed.
+// Address is either a unix socket path (containing /) or TCP host:port.
+func (l *Loop) ServeMetrics(address string) (ln net.Listener, err error) {
+	network := "tcp"
+	if strings.Contains(address, "/") {
+		network = "unix"
+		// Remove socket left over from previous run.
+		os.Remove(address)
+	}
+	if ln, err = net.Listen(network, address); err != nil {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", l.MetricsHandler())
+	go http.Serve(ln, mux)
+	return
+}
+
+func (l *Loop) showMetrics(c cli.Commander, w cli.Writer, in *cli.Input) (err error) {
+	var matching string
+	for !in.End() {
+		switch {
+		case in.Parse("%v", &matching):
+		default:
+			in.ParseError()
+		}
+	}
+	fs := l.Metrics()
+	if matching != "" {
+		var re *regexp.Regexp
+		if re, err = regexp.Compile(matching); err != nil {
+			return
+		}
+		var m []MetricFamily
+		for i := range fs {
+			if re.MatchString(fs[i].Name) {
+				m = append(m, fs[i])
+			}
+		}
+		fs = m
+	}
+	return WriteOpenMetrics(w, fs)
+}
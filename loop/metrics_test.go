@@ -0,0 +1,137 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loop
+
+import (
+	"github.com/platinasystems/elib/cpu"
+
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteOpenMetrics(t *testing.T) {
+	c := MetricFamily{Name: "x_seconds", Type: MetricCounter, Unit: "seconds", Help: "Help with \\ and\nnewline."}
+	c.Add(1.5, MetricLabel{Name: "node", Value: `a"b`}, MetricLabel{Name: "dir", Value: "input"})
+	g := MetricFamily{Name: "y", Type: MetricGauge}
+	g.Add(math.Inf(1))
+	var b bytes.Buffer
+	if err := WriteOpenMetrics(&b, []MetricFamily{c, g}); err != nil {
+		t.Fatal(err)
+	}
+	want := `# TYPE x_seconds counter
+# UNIT x_seconds seconds
+# HELP x_seconds Help with \\ and\nnewline.
+x_seconds_total{node="a\"b",dir="input"} 1.5
+# TYPE y gauge
+y +Inf
+# EOF
+`
+	if b.String() != want {
+		t.Fatalf("got\n%s\nexpected\n%s", b.String(), want)
+	}
+}
+
+type testCollector struct{}
+
+func (testCollector) CollectMetrics(l *Loop) []MetricFamily {
+	f := MetricFamily{Name: "test_widgets", Type: MetricGauge}
+	f.Add(42)
+	return []MetricFamily{f}
+}
+
+// Node whose event suspends until resumed by event sent to resumer node.
+type suspendNode struct {
+	Node
+	resumer Node
+	ready   chan struct{}
+}
+
+type suspendEvent struct {
+	Event
+	n *suspendNode
+}
+
+func (e *suspendEvent) String() string { return "suspend test" }
+func (e *suspendEvent) EventAction() {
+	n := e.n
+	n.SignalEventAfter(&resumeEvent{e}, &n.resumer, .01)
+	e.Suspend()
+	close(n.ready)
+}
+
+type resumeEvent struct{ e *suspendEvent }
+
+func (e *resumeEvent) String() string { return "resume test" }
+func (e *resumeEvent) EventAction()   { e.e.Resume() }
+
+func (n *suspendNode) LoopInit(l *Loop) { n.SignalEvent(&suspendEvent{n: n}, n) }
+
+func TestServeMetrics(t *testing.T) {
+	l := &Loop{}
+	n := &suspendNode{ready: make(chan struct{})}
+	l.RegisterNode(n, "suspender")
+	l.RegisterNode(&n.resumer, "resumer")
+	l.RegisterMetrics("test", testCollector{})
+	done := make(chan struct{})
+	go func() {
+		l.Run()
+		close(done)
+	}()
+	<-n.ready
+
+	path := filepath.Join(t.TempDir(), "metrics.sock")
+	ln, err := l.ServeMetrics(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	c := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return net.Dial("unix", path)
+		},
+	}}
+	r, err := c.Get("http://loop/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Quit()
+	<-done
+
+	s := string(b)
+	if ct := r.Header.Get("Content-Type"); ct != OpenMetricsContentType {
+		t.Fatalf("content type %s", ct)
+	}
+	for _, want := range []string{
+		`loop_event_node_events_total{node="resumer"} 1`,
+		`loop_event_node_events_total{node="suspender"} 1`,
+		`loop_event_node_suspends_total{node="suspender"} 1`,
+		"# TYPE loop_poller_vector_rate gauge\n",
+		"test_widgets 42\n",
+	} {
+		if !strings.Contains(s, want) {
+			t.Fatalf("missing %s in\n%s", want, s)
+		}
+	}
+	if !strings.HasSuffix(s, "# EOF\n") {
+		t.Fatalf("missing # EOF:\n%s", s)
+	}
+	var s0 stats
+	s0.add_raw(&n.e.eventStats)
+	if secs := l.Seconds(cpu.Time(s0.suspendClocks)); secs < .005 {
+		t.Fatalf("suspended for %g secs", secs)
+	}
+}
@@ -10,12 +10,10 @@ import (
 	"github.com/platinasystems/elib/elog"
 
 	"fmt"
-	"os"
 	"runtime"
 	"runtime/debug"
 	"sync"
 	"sync/atomic"
-	"time"
 )
 
 type fromToNode struct {
@@ -28,45 +26,25 @@ func (x *fromToNode) init() {
 	x.fromNode = make(chan bool, 1)
 }
 
-func (x *fromToNode) signalNode()    { x.toNode <- struct{}{} }
-func (x *fromToNode) waitNode() bool { return <-x.fromNode }
-func (x *fromToNode) waitNode_with_timeout(d time.Duration, node_name string, actor_name string, ch_length int) bool {
-	//fmt.Printf("poller.go waitNode_with_timeout() start, node: %s, actor: %s, channel length = %d\n", node_name, actor_name, ch_length) //debug print
-	select {
-	case done := <-x.fromNode:
-		//fmt.Printf("poller.go waitNode_with_timeout() done, node: %s, actor: %s, channel length = %d\n", node_name, actor_name, ch_length)
-		return done
-	case <-time.After(d):
-		if true {
-			fmt.Printf("poller.go waitNode_with_timeout() timeout, node: %s, actor: %s, channel length = %d, os.Exit(3)\n", node_name, actor_name, ch_length)
-		}
-		if true {
-			os.Exit(3)
-		}
-	}
-	return false
+func newFromToNode() (x *fromToNode) {
+	x = &fromToNode{}
+	x.init()
+	return
 }
 
+func (x *fromToNode) signalNode()       { x.toNode <- struct{}{} }
+func (x *fromToNode) waitNode() bool    { return <-x.fromNode }
 func (x *fromToNode) signalLoop(v bool) { x.fromNode <- v }
 func (x *fromToNode) waitLoop()         { <-x.toNode }
-func (x *fromToNode) waitLoop_with_timeout(d time.Duration, node_name string, actor_name string, ch_length int) {
-	//fmt.Printf("poller.go waitLoop_with_timeout() start, node: %s, actor: %s, channel length = %d\n", node_name, actor_name, ch_length)
-	start := time.Now()
-	select {
-	case <-x.toNode:
-		if false { // debug print
-			t := time.Since(start)
-			fmt.Printf("poller.go waitLoop_with_timeout() done, node: %s, actor: %s, channel length = %d, in %s\n", node_name, actor_name, ch_length, t.String())
-		}
-		return
-	case <-time.After(d):
-		//panic("  poller.go waitLoop_with_timeout() timeout")  //doesn't seem enough to exit vnet, still hangs
-		if true {
-			fmt.Printf("poller.go waitLoop_with_timeout() timeout, node: %s, actor: %s, channel length = %d, os.Exit(3)\n", node_name, actor_name, ch_length)
-		}
-		if true {
-			os.Exit(3)
-		}
+
+// Returns false when node has been stopped.
+func (x *fromToNode) waitLoopRunning() (ok bool) { _, ok = <-x.toNode; return }
+
+// Stops node goroutine waiting for loop and waits for it to acknowledge with signalLoop.
+func (x *fromToNode) stop() {
+	if x.toNode != nil {
+		close(x.toNode)
+		<-x.fromNode
 	}
 }
 
@@ -294,7 +272,7 @@ func (l *Loop) AddSuspendActivity(in *In, i int, lim *SuspendLimits) {
 		}
 
 		// Signal polling done to main loop.
-		n.inputStats.current.suspends++
+		atomic.AddUint64(&n.inputStats.current.suspends, 1)
 		n.poller_elog(poller_elog_suspended)
 		if poll_active {
 			a.toLoop <- struct{}{}
@@ -307,21 +285,11 @@ func (l *Loop) AddSuspendActivity(in *In, i int, lim *SuspendLimits) {
 			<-a.fromLoop
 		} else {
 			n.ft.waitLoop()
-			if false { //debug print
-				actor_name := "nil"
-				t := 10 * time.Second
-				if n.CurrentEvent().e != nil {
-					if n.CurrentEvent().e.actor != nil {
-						actor_name = n.CurrentEvent().e.actor.String()
-					}
-				}
-				n.ft.waitLoop_with_timeout(t, n.name+"(AddSuspendActivity)", actor_name, len(n.e.rxEvents))
-			}
 		}
 		// Don't charge node for time suspended.
 		// Reduce from output side since its tx that suspends not rx.
 		dt := cpu.TimeNow() - t0
-		n.outputStats.current.clocks -= uint64(dt)
+		n.inputStats.current.suspended(&n.outputStats.current, dt)
 		n.poller_elog(poller_elog_resumed)
 	}
 	if did_resume {
@@ -537,6 +505,39 @@ func (n *Node) maybeFreeActive() {
 	}
 }
 
+// Makes data poller node inactive and frees its active poller for UnregisterNode.
+func (n *Node) quiescePoller() {
+	m := &n.l.nodeStateMain
+	m.mu.Lock()
+	for i := range m.activePending {
+		pending := m.activePending[i][:0]
+		for _, p := range m.activePending[i] {
+			if p.nodeIndex != n.index {
+				pending = append(pending, p)
+			}
+		}
+		m.activePending[i] = pending
+	}
+	n.s.is_pending = false
+	m.mu.Unlock()
+
+	for {
+		old_state, _, _, _ := n.s.get()
+		new_state := makeNodePollerState(0, 0, poller_inactive)
+		if !n.s.compare_and_swap(old_state, new_state) {
+			continue
+		}
+		n.poller_elog_state(poller_elog_free_active, old_state, new_state)
+		if old_state.needs_poll() {
+			n.changeActive(false)
+		}
+		break
+	}
+	if n.activePollerIndex != ^uint(0) {
+		n.freeActivePoller()
+	}
+}
+
 func (n *Node) maybeClearResume() {
 	for {
 		old_state, active, suspend, state := n.s.get()
@@ -558,6 +559,9 @@ func (a *activePoller) flushActivePollerStats(l *Loop) {
 	for i := range a.activeNodes {
 		an := &a.activeNodes[i]
 		n := l.nodes[an.index]
+		if n == nil {
+			continue
+		}
 
 		n.inputStats.current.add_raw(&an.inputStats)
 		an.inputStats.zero()
@@ -625,18 +629,10 @@ func (l *Loop) dataPoll(p inLooper) {
 	}()
 	for {
 		n.poller_elog(poller_elog_node_wait)
-		n.ft.waitLoop()
-		if false { //debug print
-			actor_name := "nil"
-			t := 10 * time.Second
-			if n.CurrentEvent() != nil {
-				if n.CurrentEvent().e != nil {
-					if n.CurrentEvent().e.actor != nil {
-						actor_name = n.CurrentEvent().e.actor.String()
-					}
-				}
-			}
-			n.ft.waitLoop_with_timeout(t, n.name+"(dataPoll)", actor_name, len(n.e.rxEvents))
+		if !n.ft.waitLoopRunning() {
+			// Node unregistered.
+			n.ft.signalLoop(true)
+			return
 		}
 		n.poller_elog(poller_elog_node_wake)
 		ap := n.getActivePoller()
@@ -659,6 +655,8 @@ func (s *nodePollerState) needs_poll() bool {
 }
 
 func (l *Loop) doPollers() {
+	l.pollerLock.Lock()
+	defer l.pollerLock.Unlock()
 	pending := l.nodeStateMain.getAllocPending(l)
 	for _, p := range pending {
 		n := l.nodes[p.nodeIndex]
@@ -701,16 +699,6 @@ func (l *Loop) doPollers() {
 				<-a.toLoop
 			} else {
 				done = n.ft.waitNode()
-				if false {
-					actor_name := "nil"
-					t := 3 * time.Second
-					if n.e.currentEvent.e != nil {
-						if n.e.currentEvent.e.actor != nil {
-							actor_name = n.e.currentEvent.e.actor.String()
-						}
-					}
-					done = n.ft.waitNode_with_timeout(t, n.name+"(doPollers)", actor_name, len(n.e.rxEvents))
-				}
 			}
 			n.poller_elog(poller_elog_wait_done)
 			n.maybeClearResume()
@@ -0,0 +1,101 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loop
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// Node sending periodic hellos using timed events.
+type helloNode struct {
+	Node
+	period float64
+	// Simulated times of hellos.
+	times []float64
+}
+
+type helloEvent struct{ n *helloNode }
+
+func (e *helloEvent) String() string { return fmt.Sprintf("hello %s", e.n.name) }
+func (e *helloEvent) EventAction() {
+	n := e.n
+	n.times = append(n.times, n.l.TimeDiff(n.l.startTime, n.l.TimeNow()))
+	n.SignalEventAfter(e, n, n.period)
+}
+
+func (n *helloNode) LoopInit(l *Loop) { n.SignalEventAfter(&helloEvent{n: n}, n, n.period) }
+
+func TestSimulate(t *testing.T) {
+	l := &Loop{}
+	fast, slow := &helloNode{period: .25}, &helloNode{period: 1}
+	l.RegisterNode(fast, "fast")
+	l.RegisterNode(slow, "slow")
+	start := time.Now()
+	l.Simulate(10.1)
+	if dt := time.Since(start); dt > 5*time.Second {
+		t.Fatalf("simulation took %v", dt)
+	}
+	for _, n := range []*helloNode{fast, slow} {
+		if got, want := len(n.times), int(10/n.period); got != want {
+			t.Fatalf("%s: %d hellos, expected %d", n.name, got, want)
+		}
+		for i, x := range n.times {
+			if want := float64(i+1) * n.period; math.Abs(x-want) > 1e-6 {
+				t.Fatalf("%s: hello %d at %g, expected %g", n.name, i, x, want)
+			}
+		}
+	}
+	if dt := l.TimeDiff(l.startTime, l.TimeNow()); math.Abs(dt-10.1) > 1e-6 {
+		t.Fatalf("simulation ended at %g", dt)
+	}
+}
+
+// Node whose event suspends with timeout and is never resumed by anyone else.
+type timeoutNode struct {
+	Node
+	resumed float64
+}
+
+type timeoutEvent struct {
+	Event
+	n *timeoutNode
+}
+
+func (e *timeoutEvent) String() string { return "suspend timeout test" }
+func (e *timeoutEvent) EventAction() {
+	n := e.n
+	e.SuspendWTimeout(2 * time.Second)
+	n.resumed = n.l.TimeDiff(n.l.startTime, n.l.TimeNow())
+}
+
+func (n *timeoutNode) LoopInit(l *Loop) { n.SignalEvent(&timeoutEvent{n: n}, n) }
+
+func TestSimulateSuspendTimeout(t *testing.T) {
+	l := &Loop{}
+	var stalls []*WatchdogStall
+	l.Watchdog = WatchdogConfig{
+		Policy:  WatchdogRestartNode,
+		OnStall: func(s *WatchdogStall) { stalls = append(stalls, s) },
+	}
+	n := &timeoutNode{}
+	l.RegisterNode(n, "suspend")
+	start := time.Now()
+	l.Simulate(5)
+	if dt := time.Since(start); dt > time.Second {
+		t.Fatalf("simulation took %v", dt)
+	}
+	if len(stalls) != 1 || !stalls[0].Suspended {
+		t.Fatalf("stalls %v", stalls)
+	}
+	if dt := stalls[0].Duration; math.Abs(dt.Seconds()-2) > 1e-6 {
+		t.Fatalf("stall after %v", dt)
+	}
+	if math.Abs(n.resumed-2) > 1e-6 {
+		t.Fatalf("resumed at %g", n.resumed)
+	}
+}
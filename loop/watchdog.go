@@ -0,0 +1,340 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loop
+
+import (
+	"github.com/platinasystems/elib"
+	"github.com/platinasystems/elib/cpu"
+	"github.com/platinasystems/elib/elog"
+
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Watchdog: detects event handlers which spend too long in an event (or suspended
+// in SuspendWTimeout) and reports and handles them according to configured policy.
+
+type WatchdogPolicy uint8
+
+const (
+	// Report stall and keep waiting; stall is reported again after each further timeout.
+	WatchdogLog WatchdogPolicy = iota
+	// Report stall and abandon stuck event: loop continues as if event was done and node gets
+	// a new event handler goroutine for its remaining events.  The stuck goroutine exits if its
+	// event action ever returns and must not use node's event after that.
+	// For SuspendWTimeout the suspended event is resumed instead.
+	WatchdogRestartNode
+	// Report stall, save event log and exit process.
+	WatchdogCrash
+)
+
+var watchdogPolicyNames = [...]string{
+	WatchdogLog:         "log",
+	WatchdogRestartNode: "restart-node",
+	WatchdogCrash:       "crash",
+}
+
+func (p WatchdogPolicy) String() string { return elib.StringerHex(watchdogPolicyNames[:], int(p)) }
+
+const DefaultWatchdogTimeout = 30 * time.Second
+
+type WatchdogConfig struct {
+	// Time an event handler may spend in one event before stall is reported.
+	// Zero means DefaultWatchdogTimeout; negative disables watchdog.
+	Timeout time.Duration
+	Policy  WatchdogPolicy
+	// Called for each stall before policy is applied.
+	OnStall func(s *WatchdogStall)
+}
+
+func (c *WatchdogConfig) timeout() time.Duration {
+	if c.Timeout == 0 {
+		return DefaultWatchdogTimeout
+	}
+	return c.Timeout
+}
+
+type WatchdogStall struct {
+	Node string
+	// Actor of node's current event.
+	Actor string
+	// Time node has been in event (or suspended).
+	Duration time.Duration
+	// Number of events queued for node.
+	RxEvents int
+	// Event is suspended in SuspendWTimeout and has not been resumed.
+	Suspended bool
+	Policy    WatchdogPolicy
+	// Stack of stuck event handler goroutine.
+	Stack []byte
+}
+
+func (s *WatchdogStall) String() string {
+	what := "in event"
+	if s.Suspended {
+		what = "suspended"
+	}
+	return fmt.Sprintf("watchdog: %s %s for %v, actor %s, %d events queued, policy %v",
+		s.Node, what, s.Duration, s.Actor, s.RxEvents, s.Policy)
+}
+
+type watchdog_elog struct {
+	name      elog.StringRef `elog:"node"`
+	ms        uint32         `elog:"ms"`
+	rxEvents  uint32         `elog:"queued"`
+	suspended bool           `elog:"suspended"`
+	policy    WatchdogPolicy `elog:"policy"`
+}
+
+func init() { elog.RegisterType(&watchdog_elog{}) }
+
+func (e *watchdog_elog) Elog(l *elog.Log) {
+	what := "in event"
+	if e.suspended {
+		what = "suspended"
+	}
+	l.Logf("loop watchdog %v %s %dms, %d queued, %v", e.name, what, e.ms, e.rxEvents, e.policy)
+}
+
+// TimeInEvent returns time node's event handler has been running its current event
+// or zero when it is not running an event.
+func (n *Node) TimeInEvent() (dt time.Duration) {
+	if t := atomic.LoadInt64(&n.e.eventStart); t != 0 {
+		dt = time.Duration(time.Now().UnixNano() - t)
+	}
+	return
+}
+
+func (n *eventNode) setInEvent(in bool) {
+	var t int64
+	if in {
+		t = time.Now().UnixNano()
+	}
+	atomic.StoreInt64(&n.eventStart, t)
+}
+
+// Returns id of calling goroutine from first line of its stack trace.
+func goroutineId() (id uint64) {
+	var b [64]byte
+	s := b[:runtime.Stack(b[:], false)]
+	s = bytes.TrimPrefix(s, []byte("goroutine "))
+	if i := bytes.IndexByte(s, ' '); i > 0 {
+		id, _ = strconv.ParseUint(string(s[:i]), 10, 64)
+	}
+	return
+}
+
+// Returns stack trace of goroutine with given id.
+func goroutineStack(id uint64) []byte {
+	b := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(b, true)
+		if n < len(b) {
+			b = b[:n]
+			break
+		}
+		b = make([]byte, 2*len(b))
+	}
+	prefix := []byte(fmt.Sprintf("goroutine %d [", id))
+	for len(b) > 0 {
+		s := b
+		if i := bytes.Index(b, []byte("\n\n")); i >= 0 {
+			s, b = b[:i+1], b[i+2:]
+		} else {
+			b = nil
+		}
+		if bytes.HasPrefix(s, prefix) {
+			return s
+		}
+	}
+	return nil
+}
+
+func (d *Node) watchdogStall(suspended bool, dt time.Duration) (s *WatchdogStall) {
+	n := &d.e
+	s = &WatchdogStall{
+		Node:      d.name,
+		Actor:     "nil",
+		Duration:  dt,
+		RxEvents:  len(n.rxEvents),
+		Suspended: suspended,
+		Policy:    d.l.Watchdog.Policy,
+		Stack:     goroutineStack(atomic.LoadUint64(&n.goid)),
+	}
+	n.handlerLock.Lock()
+	if e := n.currentEvent.e; n.inAction && e != nil && e.actor != nil {
+		s.Actor = e.actor.String()
+	}
+	n.handlerLock.Unlock()
+	return
+}
+
+// Exits process for WatchdogCrash; replaced by tests.
+var watchdogExit = os.Exit
+
+func (l *Loop) reportStall(d *Node, s *WatchdogStall) {
+	atomic.AddUint64(&d.e.stalls, 1)
+	if elog.Enabled() {
+		elog.AddTrack(&watchdog_elog{
+			name:      d.elogNodeName,
+			ms:        uint32(s.Duration / time.Millisecond),
+			rxEvents:  uint32(s.RxEvents),
+			suspended: s.Suspended,
+			policy:    s.Policy,
+		}, d.elogTrack)
+	}
+	if f := l.Watchdog.OnStall; f != nil {
+		f(s)
+	} else {
+		l.Logln(s)
+	}
+	if s.Policy == WatchdogCrash {
+		err := fmt.Errorf("%v", s)
+		elog.Panic(err)
+		l.Panic(err, s.Stack)
+		l.doPanic()
+		watchdogExit(3)
+	}
+}
+
+// Waits for active event node to finish (true) or suspend (false) its event.
+// Called by main loop; stalls are handled according to watchdog policy.
+func (l *Loop) waitEventNode(d *Node) (done bool) {
+	n := &d.e
+	timeout := l.Watchdog.timeout()
+	if timeout < 0 {
+		return n.ft.waitNode()
+	}
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	for {
+		select {
+		case done = <-n.ft.fromNode:
+			return
+		case <-t.C:
+		}
+		s := d.watchdogStall(false, d.TimeInEvent())
+		l.reportStall(d, s)
+		if s.Policy == WatchdogRestartNode && d.restartEventHandler() {
+			return true
+		}
+		t.Reset(timeout)
+	}
+}
+
+// Called by event handler before running event action.
+func (n *eventNode) startAction(e *nodeEvent) {
+	n.handlerLock.Lock()
+	defer n.handlerLock.Unlock()
+	n.currentEvent.e = e
+	n.inAction = true
+	n.setInEvent(true)
+}
+
+// Called by event handler when event action returns (or panics).
+// Returns false when handler has been abandoned by watchdog; it must then not touch node.
+func (n *eventNode) endAction(gen uint32) (ok bool) {
+	n.handlerLock.Lock()
+	defer n.handlerLock.Unlock()
+	if ok = n.generation == gen; ok {
+		n.inAction = false
+	}
+	return
+}
+
+// Marks node suspended.  Returns false for duplicate suspends and for events abandoned by watchdog.
+func (x *Event) setSuspend() (ok bool) {
+	d := x.e.d
+	n := &d.e
+	n.handlerLock.Lock()
+	defer n.handlerLock.Unlock()
+	if n.generation != x.e.generation {
+		n.logsi(d, event_elog_suspend, n.getSequence(), "ignore abandoned suspend")
+		return
+	}
+	if !n.isActive() {
+		panic("suspending inactive node")
+	}
+	if was := n.s.setSuspend(d, true); was {
+		n.logsi(d, event_elog_suspend, n.getSequence(), "ignore duplicate suspend")
+		return
+	}
+	return true
+}
+
+// Abandons node's stuck event handler goroutine and starts a new one.
+// Returns false when handler finished its event action before it could be abandoned.
+func (d *Node) restartEventHandler() (ok bool) {
+	n := &d.e
+	n.handlerLock.Lock()
+	defer n.handlerLock.Unlock()
+	if !n.inAction {
+		return
+	}
+	// Stuck goroutine keeps its event and channels; new goroutine gets new channels so
+	// that neither can receive signals meant for the other.
+	n.generation++
+	n.inAction = false
+	n.setInEvent(false)
+	n.s.setDone(d)
+	n.currentEvent.e = nil
+	n.activeCount--
+	n.ft = newFromToNode()
+	elog.F("loop watchdog restarting event handler %v", d.elogNodeName)
+	go d.l.eventHandler(d.noder)
+	return true
+}
+
+// Timed event reporting a stall when event suspended with SuspendWTimeout has not been
+// resumed after timeout.  Runs in loop so suspension is timed on loop's (possibly virtual) clock.
+type suspendTimeout struct {
+	d        *Node
+	x        *Event
+	sequence uint32
+	t0       cpu.Time
+	timeout  time.Duration
+}
+
+func (e *suspendTimeout) String() string { return "suspend timeout " + e.d.name }
+
+func (x *Event) startSuspendTimeout(timeout time.Duration) {
+	d := x.e.d
+	e := &suspendTimeout{
+		d:        d,
+		x:        x,
+		sequence: atomic.AddUint32(&d.e.suspendSequence, 1),
+		t0:       d.l.TimeNow(),
+		timeout:  timeout,
+	}
+	e.signal()
+}
+
+func (e *suspendTimeout) signal() {
+	l := e.d.l
+	l.signalEventAfter(l.getLoopEvent(e, nil, elog.PointerToFirstArg(&e)), e.timeout.Seconds())
+}
+
+func (e *suspendTimeout) EventAction() {
+	d := e.d
+	n := &d.e
+	// Event resumed (or suspended again) before timeout?
+	if atomic.LoadUint32(&n.suspendSequence) != e.sequence || !n.s.isSuspended() {
+		return
+	}
+	l := d.l
+	dt := time.Duration(l.TimeDiff(e.t0, l.TimeNow()) * float64(time.Second))
+	s := d.watchdogStall(true, dt)
+	l.reportStall(d, s)
+	if s.Policy == WatchdogRestartNode {
+		e.x.Resume()
+	} else {
+		e.signal()
+	}
+}
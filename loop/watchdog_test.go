@@ -0,0 +1,165 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package loop
+
+import (
+	"github.com/platinasystems/elib/elog"
+
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Node whose first event blocks until released; second event is handled by restarted event handler.
+type stuckNode struct {
+	Node
+	release, handled, exited chan struct{}
+}
+
+type stuckEvent struct {
+	Event
+	n *stuckNode
+}
+
+func (e *stuckEvent) String() string { return "stuck test" }
+func (e *stuckEvent) EventAction() {
+	blockInEvent(e.n.release)
+	// Abandoned event must not suspend node now owned by restarted handler.
+	e.Suspend()
+	close(e.n.exited)
+}
+
+func blockInEvent(c chan struct{}) { <-c }
+
+type afterStuckEvent struct{ n *stuckNode }
+
+func (e *afterStuckEvent) String() string { return "after stuck test" }
+func (e *afterStuckEvent) EventAction()   { close(e.n.handled) }
+
+func (n *stuckNode) LoopInit(l *Loop) {
+	n.SignalEvent(&stuckEvent{n: n}, n)
+	n.SignalEvent(&afterStuckEvent{n: n}, n)
+}
+
+func TestWatchdogRestartNode(t *testing.T) {
+	l := &Loop{}
+	n := &stuckNode{release: make(chan struct{}), handled: make(chan struct{}), exited: make(chan struct{})}
+	stalls := make(chan *WatchdogStall, 1)
+	l.Watchdog = WatchdogConfig{
+		Timeout: 50 * time.Millisecond,
+		Policy:  WatchdogRestartNode,
+		OnStall: func(s *WatchdogStall) { stalls <- s },
+	}
+	l.RegisterNode(n, "stuck")
+	done := make(chan struct{})
+	go func() {
+		l.Run()
+		close(done)
+	}()
+
+	var s *WatchdogStall
+	select {
+	case s = <-stalls:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no stall reported")
+	}
+	select {
+	case <-n.handled:
+	case <-time.After(10 * time.Second):
+		t.Fatal("event not handled after restart")
+	}
+	// Abandoned goroutine returns from its event and exits.
+	close(n.release)
+	select {
+	case <-n.exited:
+	case <-time.After(10 * time.Second):
+		t.Fatal("abandoned event did not return")
+	}
+	if n.e.s.isSuspended() {
+		t.Fatal("abandoned event suspended node")
+	}
+	l.Quit()
+	<-done
+
+	if s.Node != "stuck" || s.Actor != "stuck test" || s.Suspended || s.Policy != WatchdogRestartNode {
+		t.Fatalf("stall %v", s)
+	}
+	if s.Duration <= 0 {
+		t.Fatalf("stall duration %v", s.Duration)
+	}
+	if !strings.Contains(string(s.Stack), "blockInEvent") {
+		t.Fatalf("stack missing blocked function:\n%s", s.Stack)
+	}
+	if n.e.stalls != 1 {
+		t.Fatalf("stalls %d", n.e.stalls)
+	}
+}
+
+// Node whose only event blocks until released.
+type crashNode struct {
+	Node
+	release chan struct{}
+}
+
+type crashEvent struct{ n *crashNode }
+
+func (e *crashEvent) String() string { return "crash test" }
+func (e *crashEvent) EventAction()   { <-e.n.release }
+
+func (n *crashNode) LoopInit(l *Loop) { n.SignalEvent(&crashEvent{n: n}, n) }
+
+func TestWatchdogCrash(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "panic.elog")
+	tr := &elog.Trigger{Name: "watchdog-test", On: "panic", Pre: 100, Post: 100, Action: elog.TriggerSnapshot, File: file}
+	if err := elog.AddTrigger(tr); err != nil {
+		t.Fatal(err)
+	}
+	defer elog.DelTrigger(tr.Name)
+
+	// Snapshot must be saved by the time process would exit.
+	type exit struct {
+		code  int
+		saved bool
+	}
+	exits := make(chan exit, 1)
+	defer func(f func(int)) { watchdogExit = f }(watchdogExit)
+	watchdogExit = func(code int) {
+		_, err := os.Stat(file)
+		exits <- exit{code: code, saved: err == nil && tr.LastView() != nil}
+	}
+
+	l := &Loop{}
+	n := &crashNode{release: make(chan struct{})}
+	l.Watchdog = WatchdogConfig{
+		Timeout: 50 * time.Millisecond,
+		Policy:  WatchdogCrash,
+		OnStall: func(s *WatchdogStall) {},
+	}
+	l.RegisterNode(n, "crash")
+	done := make(chan struct{})
+	go func() {
+		l.Run()
+		close(done)
+	}()
+
+	var x exit
+	select {
+	case x = <-exits:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no crash")
+	}
+	// Loop quits on panic once stuck event returns.
+	close(n.release)
+	<-done
+
+	if x.code != 3 || !x.saved {
+		t.Fatalf("exit %d, snapshot saved %v", x.code, x.saved)
+	}
+	if !l.isPanic() {
+		t.Fatal("no panic recorded")
+	}
+}
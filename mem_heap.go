@@ -168,3 +168,40 @@ func (h *MemHeap) String() string {
 		MemorySize(u.Free<<cpu.Log2CacheLineBytes),
 		MemorySize(max<<cpu.Log2CacheLineBytes))
 }
+
+// GetFragStats returns heap usage and free block statistics in bytes.
+func (h *MemHeap) GetFragStats() (s HeapFragStats) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s = h.heap.GetFragStats()
+	s.Used <<= cpu.Log2CacheLineBytes
+	s.Free <<= cpu.Log2CacheLineBytes
+	s.LargestFree <<= cpu.Log2CacheLineBytes
+	// Shift histogram bins from cache lines to bytes.
+	var sizes [64]uint64
+	copy(sizes[cpu.Log2CacheLineBytes:], s.FreeSizes[:])
+	s.FreeSizes = sizes
+	return
+}
+
+// Compact moves allocated blocks towards start of heap copying their data so that free space
+// becomes contiguous.  Blocks keep their id and their alignment up to 2^log2MaxAlign bytes.
+// F (if non-nil) is called with heap lock held after each block is copied with old and new byte offset
+// so caller can update any references (e.g. DMA addresses) to block.
+// Caller must make sure that blocks are not accessed (e.g. by hardware) during compaction.
+func (h *MemHeap) Compact(log2MaxAlign uint, f func(id Index, oldOffset, newOffset, size uint)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if log2MaxAlign < cpu.Log2CacheLineBytes {
+		log2MaxAlign = cpu.Log2CacheLineBytes
+	}
+	h.heap.Compact(log2MaxAlign-cpu.Log2CacheLineBytes, func(id Index, o, n, size uint) {
+		o <<= cpu.Log2CacheLineBytes
+		n <<= cpu.Log2CacheLineBytes
+		size <<= cpu.Log2CacheLineBytes
+		copy(h.data[n:n+size], h.data[o:o+size])
+		if f != nil {
+			f(id, o, n, size)
+		}
+	})
+}
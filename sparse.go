@@ -50,17 +50,7 @@ func (s *Sparse) elts() Index {
 func (s *Sparse) Set(sparse Index) (dense Index) {
 	i, m := bitmapIndex(uint(sparse))
 
-	l := len(s.valid)
-	s.valid.Validate(i)
-	s.count.Validate(i)
-
-	if l > 0 && len(s.valid) > l {
-		if e := s.eltsBefore(l - 1); e != 0 {
-			for j := l; j < len(s.valid); j++ {
-				s.count[j] = int32(e)
-			}
-		}
-	}
+	s.grow(i)
 
 	v := s.valid[i]
 	if v&m != 0 {
@@ -84,6 +74,127 @@ func (s *Sparse) Unset(sparse Index) (valid bool) {
 	return
 }
 
+// Recompute counts for words after start; count[start] must be correct.
+func (s *Sparse) recount(start uint) {
+	for i := start + 1; i < uint(len(s.count)); i++ {
+		s.count[i] = int32(s.eltsBefore(int(i) - 1))
+	}
+}
+
+// Grow valid and count vectors to include word i.
+func (s *Sparse) grow(i uint) {
+	l := uint(len(s.valid))
+	s.valid.Validate(i)
+	s.count.Validate(i)
+	if l > 0 && uint(len(s.valid)) > l {
+		s.recount(l - 1)
+	}
+}
+
+// SparseFromSorted returns sparse array mapping given sparse indices to dense indices 0, 1, 2, ...
+// Indices must be sorted in increasing order; duplicates are ignored.
+func SparseFromSorted(sparse []Index) (s *Sparse) {
+	s = &Sparse{}
+	if len(sparse) == 0 {
+		return
+	}
+	n, _ := bitmapIndex(uint(sparse[len(sparse)-1]))
+	s.valid.Validate(n)
+	s.count.Validate(n)
+	for _, x := range sparse {
+		i, m := bitmapIndex(uint(x))
+		s.valid[i] |= m
+	}
+	s.recount(0)
+	return
+}
+
+// SetMany sets all given sparse indices updating counts once.
+// Returns number of indices which were not already set.
+// Dense indices of existing elements may change.
+func (s *Sparse) SetMany(sparse []Index) (n uint) {
+	if len(sparse) == 0 {
+		return
+	}
+	start, max := ^uint(0), uint(0)
+	for _, x := range sparse {
+		i, _ := bitmapIndex(uint(x))
+		if i < start {
+			start = i
+		}
+		if i > max {
+			max = i
+		}
+	}
+	s.grow(max)
+	for _, x := range sparse {
+		i, m := bitmapIndex(uint(x))
+		if s.valid[i]&m == 0 {
+			s.valid[i] |= m
+			n++
+		}
+	}
+	s.recount(start)
+	return
+}
+
+// UnsetMany unsets all given sparse indices updating counts once.
+// Returns number of indices which were set.
+func (s *Sparse) UnsetMany(sparse []Index) (n uint) {
+	start := ^uint(0)
+	for _, x := range sparse {
+		i, m := bitmapIndex(uint(x))
+		if i >= uint(len(s.valid)) || s.valid[i]&m == 0 {
+			continue
+		}
+		s.valid[i] &^= m
+		n++
+		if i < start {
+			start = i
+		}
+	}
+	if n > 0 {
+		s.recount(start)
+	}
+	return
+}
+
+// GetSparse returns sparse index for given dense index.
+func (s *Sparse) GetSparse(dense Index) (sparse Index, valid bool) {
+	if len(s.count) == 0 || dense >= s.elts() {
+		sparse = MaxIndex
+		return
+	}
+	// Find last word with count <= dense.
+	lo, hi := 0, len(s.count)
+	for hi-lo > 1 {
+		if m := (lo + hi) / 2; Index(s.count[m]) <= dense {
+			lo = m
+		} else {
+			hi = m
+		}
+	}
+	// Next word has count > dense so dense is in this word.
+	v := s.valid[lo]
+	for k := dense - Index(s.count[lo]); k > 0; k-- {
+		v &= v - 1
+	}
+	sparse = Index(uint(lo)*WordBits + MinLog2(v.FirstSet()))
+	valid = true
+	return
+}
+
+// Foreach calls f for each valid sparse index and its dense index in increasing order.
+func (s *Sparse) Foreach(f func(sparse, dense Index)) {
+	for i := range s.valid {
+		dense := Index(s.count[i])
+		for v := s.valid[i]; v != 0; v &= v - 1 {
+			f(Index(uint(i)*WordBits+MinLog2(v.FirstSet())), dense)
+			dense++
+		}
+	}
+}
+
 func (s *Sparse) String() string {
 	return fmt.Sprintf("%d elts", s.elts())
 }
@@ -0,0 +1,101 @@
+// Copyright 2016 Platina Systems, Inc. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package elib
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestSparse(t *testing.T) {
+	c := testSparse{
+		iterations:         1000,
+		nObjects:           100,
+		validateEvery:      1,
+		log2SparseIndexMax: 12,
+	}
+	if err := runSparseTest(&c); err != nil {
+		t.Error(err)
+	}
+}
+
+func checkSparse(t *testing.T, s *Sparse, model map[Index]bool) {
+	if err := s.validate(); err != nil {
+		t.Fatal(err)
+	}
+	var want []Index
+	for x := range model {
+		want = append(want, x)
+	}
+	sort.Slice(want, func(i, j int) bool { return want[i] < want[j] })
+	for d, x := range want {
+		if got, ok := s.Get(x); !ok || got != Index(d) {
+			t.Fatalf("get 0x%x: dense %d %v want %d", x, got, ok, d)
+		}
+		if got, ok := s.GetSparse(Index(d)); !ok || got != x {
+			t.Fatalf("get sparse %d: 0x%x %v want 0x%x", d, got, ok, x)
+		}
+	}
+	if _, ok := s.GetSparse(Index(len(want))); ok {
+		t.Fatalf("get sparse %d beyond end valid", len(want))
+	}
+	n := 0
+	s.Foreach(func(x, d Index) {
+		if d != Index(n) || x != want[n] {
+			t.Fatalf("foreach %d: 0x%x %d want 0x%x", n, x, d, want[n])
+		}
+		n++
+	})
+	if n != len(want) {
+		t.Fatalf("foreach visited %d want %d", n, len(want))
+	}
+}
+
+func TestSparseBatch(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	model := make(map[Index]bool)
+	var sorted []Index
+	for i := 0; i < 500; i++ {
+		x := Index(rng.Intn(1 << 14))
+		if !model[x] {
+			model[x] = true
+			sorted = append(sorted, x)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	s := SparseFromSorted(sorted)
+	checkSparse(t, s, model)
+
+	for iter := 0; iter < 50; iter++ {
+		var xs []Index
+		for i := 0; i < 1+rng.Intn(100); i++ {
+			xs = append(xs, Index(rng.Intn(1<<(10+rng.Intn(6)))))
+		}
+		nWant := uint(0)
+		if iter%2 == 0 {
+			for _, x := range xs {
+				if !model[x] {
+					model[x] = true
+					nWant++
+				}
+			}
+			if n := s.SetMany(xs); n != nWant {
+				t.Fatalf("set many %d want %d", n, nWant)
+			}
+		} else {
+			for _, x := range xs {
+				if model[x] {
+					delete(model, x)
+					nWant++
+				}
+			}
+			if n := s.UnsetMany(xs); n != nWant {
+				t.Fatalf("unset many %d want %d", n, nWant)
+			}
+		}
+		checkSparse(t, s, model)
+	}
+}
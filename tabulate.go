@@ -200,3 +200,24 @@ func Tabulate(x interface{}) (tab *table) {
 }
 
 func TabulateWrite(w io.Writer, x interface{}) { Tabulate(x).Write(w) }
+
+// TabulateRows makes table with given column names and rows of pre-formatted strings.
+func TabulateRows(names []string, rows [][]string) (tab *table) {
+	tab = &table{}
+	tab.cols = make([]col, len(names))
+	for c := range tab.cols {
+		tab.cols[c].name = names[c]
+		tab.cols[c].maxLen = len(names[c]) + 2
+	}
+	tab.rows = make([]row, len(rows))
+	for r := range rows {
+		tab.rows[r].cols = make([]string, len(names))
+		copy(tab.rows[r].cols, rows[r])
+		for c, v := range tab.rows[r].cols {
+			if l := len(v) + 2; l > tab.cols[c].maxLen {
+				tab.cols[c].maxLen = l
+			}
+		}
+	}
+	return
+}